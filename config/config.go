@@ -25,6 +25,7 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -161,6 +162,137 @@ type (
 		Port    int           `validate:"required,number"`
 		Timeout time.Duration `validate:"required"`
 	}
+	// ImageOptimConfig 图片优化配置
+	ImageOptimConfig struct {
+		// 优化方式，tiny：优先使用tiny服务，不可用时使用本地处理，local：仅使用本地处理
+		Optimizer string `validate:"required,oneof=tiny local"`
+		// 连续失败次数达到此值则熔断tiny服务
+		MaxFailures int `validate:"required,min=1"`
+		// 熔断时长，熔断期间直接使用本地处理
+		BreakDuration time.Duration `validate:"required"`
+	}
+	// PasswordConfig 密码hash配置
+	PasswordConfig struct {
+		// hash算法，argon2id或bcrypt
+		Algorithm string `validate:"required,oneof=argon2id bcrypt"`
+		// argon2id的迭代次数
+		Argon2Time uint32 `validate:"required,min=1"`
+		// argon2id使用的内存，单位KB
+		Argon2Memory uint32 `validate:"required,min=1024"`
+		// argon2id的并行数
+		Argon2Threads uint8 `validate:"required,min=1"`
+		// bcrypt的cost
+		BcryptCost int `validate:"required,min=4,max=31"`
+	}
+	// AccountConfig 账户相关配置
+	AccountConfig struct {
+		// 重置密码的链接，其中的{token}替换为重置令牌
+		PasswordResetURL string `validate:"required,startswith=http"`
+		// 重置密码令牌的有效期
+		PasswordResetTTL time.Duration `validate:"required"`
+		// 验证邮箱的链接，其中的{token}替换为验证令牌
+		EmailVerifyURL string `validate:"required,startswith=http"`
+		// 验证邮箱令牌的有效期
+		EmailVerifyTTL time.Duration `validate:"required"`
+		// 重新发送验证邮件的间隔
+		EmailVerifyInterval time.Duration `validate:"required"`
+		// 确认风险登录的链接，其中的{token}替换为确认令牌
+		LoginConfirmURL string `validate:"required,startswith=http"`
+		// 确认风险登录令牌的有效期
+		LoginConfirmTTL time.Duration `validate:"required"`
+		// 两步验证（TOTP）显示的发行方
+		TOTPIssuer string `validate:"required"`
+		// 用于加密两步验证的密钥及计算恢复码的hash
+		TOTPKey string `validate:"required"`
+		// 拥有这些权限的账户必须启用两步验证
+		TOTPRequiredPermissions []string
+		// 申请注销后的宽限期，宽限期内登录则取消注销
+		DeletionGracePeriod time.Duration `validate:"required"`
+		// 管理员模拟登录的有效期
+		ImpersonationTTL time.Duration `validate:"required"`
+	}
+	// AuthTokenConfig 访问令牌（bearer token）配置
+	AuthTokenConfig struct {
+		// 访问令牌的有效期
+		AccessTTL time.Duration `validate:"required"`
+		// 刷新令牌的有效期
+		RefreshTTL time.Duration `validate:"required"`
+		// 用于签名令牌的key，使用第一个签名，校验时可使用任意一个（便于更换）
+		Keys []string `validate:"required,min=1"`
+	}
+	// OIDCProviderConfig OpenID Connect provider配置
+	OIDCProviderConfig struct {
+		// provider名称，用于路由中
+		Name string `validate:"required,alphanum"`
+		// 显示名称
+		DisplayName string `validate:"required"`
+		// issuer地址，用于获取discovery文档
+		Issuer       string `validate:"required,startswith=http"`
+		ClientID     string `validate:"required"`
+		ClientSecret string
+		// 除openid外申请的scope
+		Scopes []string
+		// ID token中角色所在的字段
+		RolesClaim string
+		// ID token中的角色与用户角色的映射，映射中的用户角色由provider管理
+		RoleMapping map[string]string `validate:"dive,keys,required,endkeys,oneof=normal admin su"`
+		// 是否允许根据provider已验证的邮箱关联已验证邮箱的账户
+		LinkByEmail bool
+	}
+	// OIDCConfig OpenID Connect登录配置
+	OIDCConfig struct {
+		// 回调地址，其中的{provider}替换为provider名称
+		RedirectURL string `validate:"required,startswith=http"`
+		// 登录成功后跳转的地址
+		SuccessURL string `validate:"required,startswith=http"`
+		// 请求provider的超时
+		Timeout   time.Duration `validate:"required"`
+		Providers []OIDCProviderConfig
+	}
+	// LoginRiskConfig 登录风险检测配置
+	LoginRiskConfig struct {
+		// 对比的最近登录记录数
+		HistoryLimit int `validate:"required,min=1"`
+		// 在此间隔内更换国家登录视为不可能的移动速度
+		TravelInterval time.Duration `validate:"required"`
+		// 统计同一IP登录账户数的时间窗口
+		IPAccountWindow time.Duration `validate:"required"`
+		// 同一IP登录账户数达到此值视为异常
+		IPAccountLimit int `validate:"required,min=2"`
+		// 风险分值达到此值需要完成两步验证或邮件确认，0表示不要求
+		StepUpScore int `validate:"min=0,max=100"`
+		// 风险分值达到此值邮件通知用户，0表示不通知
+		NotifyScore int `validate:"min=0,max=100"`
+	}
+	// LoginDefenseConfig 登录防护配置
+	LoginDefenseConfig struct {
+		// 统计登录失败次数的滑动窗口
+		Window time.Duration `validate:"required"`
+		// 窗口内同一账户失败次数达到此值则锁定
+		AccountLimit int `validate:"required,min=1"`
+		// 窗口内同一IP失败次数达到此值则锁定
+		IPLimit int `validate:"required,min=1"`
+		// 窗口内同一网段失败次数达到此值则锁定
+		SubnetLimit int `validate:"required,min=1"`
+		// 锁定时长
+		LockTTL time.Duration `validate:"required"`
+		// 失败后再次登录需等待的基础时长，每次失败翻倍
+		BackoffBase time.Duration `validate:"required"`
+		// 失败后再次登录需等待的最长时长
+		BackoffMax time.Duration `validate:"required"`
+		// 失败次数达到此值需要使用更长的图形验证码
+		CaptchaThreshold int `validate:"required,min=1"`
+	}
+	// AuditLogConfig 审计日志配置
+	AuditLogConfig struct {
+		// 审计日志保留时长，超过则定时清除
+		Retention time.Duration `validate:"required"`
+	}
+	// NovelReviewConfig 小说书评配置
+	NovelReviewConfig struct {
+		// 发表书评需要至少阅读的章节数
+		MinReadChapters int `validate:"min=0"`
+	}
 )
 
 func (configs NovelConfigs) Find(name string) NovelConfig {
@@ -411,3 +543,148 @@ func GetTinyConfig() TinyConfig {
 	mustValidate(&tinyConfig)
 	return tinyConfig
 }
+
+// GetImageOptimConfig 获取图片优化配置
+func GetImageOptimConfig() ImageOptimConfig {
+	prefix := "imageOptim."
+	imageOptimConfig := ImageOptimConfig{
+		Optimizer:     defaultViperX.GetString(prefix + "optimizer"),
+		MaxFailures:   defaultViperX.GetInt(prefix + "maxFailures"),
+		BreakDuration: defaultViperX.GetDuration(prefix + "breakDuration"),
+	}
+	mustValidate(&imageOptimConfig)
+	return imageOptimConfig
+}
+
+// GetLoginRiskConfig 获取登录风险检测配置
+func GetLoginRiskConfig() LoginRiskConfig {
+	prefix := "loginRisk."
+	loginRiskConfig := LoginRiskConfig{
+		HistoryLimit:    defaultViperX.GetInt(prefix + "historyLimit"),
+		TravelInterval:  defaultViperX.GetDuration(prefix + "travelInterval"),
+		IPAccountWindow: defaultViperX.GetDuration(prefix + "ipAccountWindow"),
+		IPAccountLimit:  defaultViperX.GetInt(prefix + "ipAccountLimit"),
+		StepUpScore:     defaultViperX.GetInt(prefix + "stepUpScore"),
+		NotifyScore:     defaultViperX.GetInt(prefix + "notifyScore"),
+	}
+	mustValidate(&loginRiskConfig)
+	return loginRiskConfig
+}
+
+// GetLoginDefenseConfig 获取登录防护配置
+func GetLoginDefenseConfig() LoginDefenseConfig {
+	prefix := "loginDefense."
+	loginDefenseConfig := LoginDefenseConfig{
+		Window:           defaultViperX.GetDuration(prefix + "window"),
+		AccountLimit:     defaultViperX.GetInt(prefix + "accountLimit"),
+		IPLimit:          defaultViperX.GetInt(prefix + "ipLimit"),
+		SubnetLimit:      defaultViperX.GetInt(prefix + "subnetLimit"),
+		LockTTL:          defaultViperX.GetDuration(prefix + "lockTTL"),
+		BackoffBase:      defaultViperX.GetDuration(prefix + "backoffBase"),
+		BackoffMax:       defaultViperX.GetDuration(prefix + "backoffMax"),
+		CaptchaThreshold: defaultViperX.GetInt(prefix + "captchaThreshold"),
+	}
+	mustValidate(&loginDefenseConfig)
+	return loginDefenseConfig
+}
+
+// GetAuditLogConfig 获取审计日志配置
+func GetAuditLogConfig() AuditLogConfig {
+	prefix := "auditLog."
+	auditLogConfig := AuditLogConfig{
+		Retention: defaultViperX.GetDuration(prefix + "retention"),
+	}
+	mustValidate(&auditLogConfig)
+	return auditLogConfig
+}
+
+// GetNovelReviewConfig 获取小说书评配置
+func GetNovelReviewConfig() NovelReviewConfig {
+	prefix := "novelReview."
+	novelReviewConfig := NovelReviewConfig{
+		MinReadChapters: defaultViperX.GetInt(prefix + "minReadChapters"),
+	}
+	mustValidate(&novelReviewConfig)
+	return novelReviewConfig
+}
+
+// GetPasswordConfig 获取密码hash配置
+func GetPasswordConfig() PasswordConfig {
+	prefix := "password."
+	passwordConfig := PasswordConfig{
+		Algorithm:     defaultViperX.GetString(prefix + "algorithm"),
+		Argon2Time:    defaultViperX.GetUint32(prefix + "argon2Time"),
+		Argon2Memory:  defaultViperX.GetUint32(prefix + "argon2Memory"),
+		Argon2Threads: uint8(defaultViperX.GetUint(prefix + "argon2Threads")),
+		BcryptCost:    defaultViperX.GetInt(prefix + "bcryptCost"),
+	}
+	mustValidate(&passwordConfig)
+	return passwordConfig
+}
+
+// GetAccountConfig 获取账户相关配置
+func GetAccountConfig() AccountConfig {
+	prefix := "account."
+	accountConfig := AccountConfig{
+		PasswordResetURL:        defaultViperX.GetString(prefix + "passwordResetURL"),
+		PasswordResetTTL:        defaultViperX.GetDuration(prefix + "passwordResetTTL"),
+		EmailVerifyURL:          defaultViperX.GetString(prefix + "emailVerifyURL"),
+		EmailVerifyTTL:          defaultViperX.GetDuration(prefix + "emailVerifyTTL"),
+		EmailVerifyInterval:     defaultViperX.GetDuration(prefix + "emailVerifyInterval"),
+		LoginConfirmURL:         defaultViperX.GetString(prefix + "loginConfirmURL"),
+		LoginConfirmTTL:         defaultViperX.GetDuration(prefix + "loginConfirmTTL"),
+		TOTPIssuer:              defaultViperX.GetString(prefix + "totpIssuer"),
+		TOTPKey:                 defaultViperX.GetString(prefix + "totpKey"),
+		TOTPRequiredPermissions: defaultViperX.GetStringSlice(prefix + "totpRequiredPermissions"),
+		DeletionGracePeriod:     defaultViperX.GetDuration(prefix + "deletionGracePeriod"),
+		ImpersonationTTL:        defaultViperX.GetDuration(prefix + "impersonationTTL"),
+	}
+	mustValidate(&accountConfig)
+	return accountConfig
+}
+
+// GetOIDCConfig 获取OpenID Connect登录的配置
+func GetOIDCConfig() OIDCConfig {
+	prefix := "oidc."
+	oidcConfig := OIDCConfig{
+		RedirectURL: defaultViperX.GetString(prefix + "redirectURL"),
+		SuccessURL:  defaultViperX.GetString(prefix + "successURL"),
+		Timeout:     defaultViperX.GetDuration(prefix + "timeout"),
+	}
+	names := make([]string, 0)
+	for name := range defaultViperX.GetStringMap(prefix + "providers") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		providerPrefix := prefix + "providers." + name + "."
+		oidcConfig.Providers = append(oidcConfig.Providers, OIDCProviderConfig{
+			Name:         name,
+			DisplayName:  defaultViperX.GetString(providerPrefix + "displayName"),
+			Issuer:       defaultViperX.GetString(providerPrefix + "issuer"),
+			ClientID:     defaultViperX.GetString(providerPrefix + "clientID"),
+			ClientSecret: defaultViperX.GetStringFromENV(providerPrefix + "clientSecret"),
+			Scopes:       defaultViperX.GetStringSlice(providerPrefix + "scopes"),
+			RolesClaim:   defaultViperX.GetString(providerPrefix + "rolesClaim"),
+			RoleMapping:  defaultViperX.GetStringMapString(providerPrefix + "roleMapping"),
+			LinkByEmail:  defaultViperX.GetBool(providerPrefix + "linkByEmail"),
+		})
+	}
+	mustValidate(&oidcConfig)
+	for index := range oidcConfig.Providers {
+		mustValidate(&oidcConfig.Providers[index])
+	}
+	return oidcConfig
+}
+
+// GetAuthTokenConfig 获取访问令牌的配置
+func GetAuthTokenConfig() AuthTokenConfig {
+	prefix := "authToken."
+	authTokenConfig := AuthTokenConfig{
+		AccessTTL:  defaultViperX.GetDuration(prefix + "accessTTL"),
+		RefreshTTL: defaultViperX.GetDuration(prefix + "refreshTTL"),
+		Keys:       defaultViperX.GetStringSlice(prefix + "keys"),
+	}
+	mustValidate(&authTokenConfig)
+	return authTokenConfig
+}
@@ -116,3 +116,105 @@ func TestGetMinioConfig(t *testing.T) {
 	assert.Equal("test123456", minioConfig.SecretAccessKey)
 	assert.False(minioConfig.SSL)
 }
+
+func TestGetImageOptimConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	imageOptimConfig := GetImageOptimConfig()
+	assert.Equal("tiny", imageOptimConfig.Optimizer)
+	assert.Equal(5, imageOptimConfig.MaxFailures)
+	assert.Equal(time.Minute, imageOptimConfig.BreakDuration)
+}
+
+func TestGetAuditLogConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	auditLogConfig := GetAuditLogConfig()
+	assert.Equal(90*24*time.Hour, auditLogConfig.Retention)
+}
+
+func TestGetNovelReviewConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	novelReviewConfig := GetNovelReviewConfig()
+	assert.Equal(3, novelReviewConfig.MinReadChapters)
+}
+
+func TestGetPasswordConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	passwordConfig := GetPasswordConfig()
+	assert.Equal("argon2id", passwordConfig.Algorithm)
+	assert.Equal(uint32(3), passwordConfig.Argon2Time)
+	assert.Equal(uint32(65536), passwordConfig.Argon2Memory)
+	assert.Equal(uint8(2), passwordConfig.Argon2Threads)
+	assert.Equal(12, passwordConfig.BcryptCost)
+}
+
+func TestGetAccountConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	accountConfig := GetAccountConfig()
+	assert.Equal("http://127.0.0.1:8080/#/password-reset?token={token}", accountConfig.PasswordResetURL)
+	assert.Equal(30*time.Minute, accountConfig.PasswordResetTTL)
+	assert.Equal("http://127.0.0.1:8080/#/email-verify?token={token}", accountConfig.EmailVerifyURL)
+	assert.Equal(24*time.Hour, accountConfig.EmailVerifyTTL)
+	assert.Equal(60*time.Second, accountConfig.EmailVerifyInterval)
+	assert.Equal("http://127.0.0.1:8080/#/login-confirm?token={token}", accountConfig.LoginConfirmURL)
+	assert.Equal(15*time.Minute, accountConfig.LoginConfirmTTL)
+	assert.Equal("elite", accountConfig.TOTPIssuer)
+	assert.Equal("octopus", accountConfig.TOTPKey)
+	assert.Equal([]string{
+		"user.create",
+		"user.update",
+		"user.impersonate",
+		"config.update",
+	}, accountConfig.TOTPRequiredPermissions)
+	assert.Equal(168*time.Hour, accountConfig.DeletionGracePeriod)
+	assert.Equal(30*time.Minute, accountConfig.ImpersonationTTL)
+}
+
+func TestGetOIDCConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	oidcConfig := GetOIDCConfig()
+	assert.Equal("http://127.0.0.1:7001/users/v1/oidc/{provider}/callback", oidcConfig.RedirectURL)
+	assert.Equal("http://127.0.0.1:8080/#/", oidcConfig.SuccessURL)
+	assert.Equal(10*time.Second, oidcConfig.Timeout)
+	assert.Empty(oidcConfig.Providers)
+}
+
+func TestGetLoginRiskConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	loginRiskConfig := GetLoginRiskConfig()
+	assert.Equal(20, loginRiskConfig.HistoryLimit)
+	assert.Equal(2*time.Hour, loginRiskConfig.TravelInterval)
+	assert.Equal(24*time.Hour, loginRiskConfig.IPAccountWindow)
+	assert.Equal(5, loginRiskConfig.IPAccountLimit)
+	assert.Equal(60, loginRiskConfig.StepUpScore)
+	assert.Equal(40, loginRiskConfig.NotifyScore)
+}
+
+func TestGetLoginDefenseConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	loginDefenseConfig := GetLoginDefenseConfig()
+	assert.Equal(15*time.Minute, loginDefenseConfig.Window)
+	assert.Equal(5, loginDefenseConfig.AccountLimit)
+	assert.Equal(20, loginDefenseConfig.IPLimit)
+	assert.Equal(50, loginDefenseConfig.SubnetLimit)
+	assert.Equal(30*time.Minute, loginDefenseConfig.LockTTL)
+	assert.Equal(time.Second, loginDefenseConfig.BackoffBase)
+	assert.Equal(30*time.Second, loginDefenseConfig.BackoffMax)
+	assert.Equal(3, loginDefenseConfig.CaptchaThreshold)
+}
+
+func TestGetAuthTokenConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	authTokenConfig := GetAuthTokenConfig()
+	assert.Equal(2*time.Hour, authTokenConfig.AccessTTL)
+	assert.Equal(240*time.Hour, authTokenConfig.RefreshTTL)
+	assert.Equal([]string{"lobster"}, authTokenConfig.Keys)
+}
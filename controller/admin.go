@@ -20,6 +20,8 @@ import (
 	"github.com/vicanso/elite/cache"
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/validate"
 	"github.com/vicanso/elton"
 )
 
@@ -29,6 +31,19 @@ type (
 	findSessionResp struct {
 		Data string `json:"data"`
 	}
+	// adminUserSessionParams 账户session查询参数
+	adminUserSessionParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
+	// adminLoginLockParams 解除登录锁定参数
+	adminLoginLockParams struct {
+		Category string `json:"category" validate:"required,xLoginDefenseCategory"`
+		Value    string `json:"value" validate:"required,xLoginDefenseValue"`
+	}
+	// adminLoginLockListResp 登录锁定列表响应
+	adminLoginLockListResp struct {
+		Locks []*service.LoginDefenseLock `json:"locks"`
+	}
 )
 
 func init() {
@@ -46,6 +61,28 @@ func init() {
 		newTrackerMiddleware(cs.ActionAdminCleanSession),
 		ctrl.cleanSessionByID,
 	)
+	// 查询账户的session列表
+	g.GET(
+		"/v1/users/{account}/sessions",
+		ctrl.listUserSessions,
+	)
+	// 退出账户所有设备的登录
+	g.DELETE(
+		"/v1/users/{account}/sessions",
+		newTrackerMiddleware(cs.ActionAdminLogoutEverywhere),
+		ctrl.logoutEverywhere,
+	)
+	// 查询当前锁定的账户、IP与网段
+	g.GET(
+		"/v1/login-locks",
+		ctrl.listLoginLocks,
+	)
+	// 解除登录锁定
+	g.DELETE(
+		"/v1/login-locks",
+		newTrackerMiddleware(cs.ActionAdminLoginUnlock),
+		ctrl.unlockLogin,
+	)
 }
 
 // findSessionByID find session by id
@@ -71,3 +108,65 @@ func (*adminCtrl) cleanSessionByID(c *elton.Context) (err error) {
 	c.NoContent()
 	return
 }
+
+// listUserSessions list sessions of account
+func (*adminCtrl) listUserSessions(c *elton.Context) (err error) {
+	params := adminUserSessionParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	sessions, err := listUserSessionInfos(c.Context(), params.Account, "")
+	if err != nil {
+		return
+	}
+	c.Body = &userSessionListResp{
+		Sessions: sessions,
+	}
+	return
+}
+
+// logoutEverywhere destroy all sessions of account
+func (*adminCtrl) logoutEverywhere(c *elton.Context) (err error) {
+	params := adminUserSessionParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	err = service.DestroyUserSessions(c.Context(), params.Account)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// listLoginLocks list login locks
+func (*adminCtrl) listLoginLocks(c *elton.Context) (err error) {
+	locks, err := service.ListLoginDefenseLocks(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &adminLoginLockListResp{
+		Locks: locks,
+	}
+	return
+}
+
+// unlockLogin unlock login of account, ip or subnet
+func (*adminCtrl) unlockLogin(c *elton.Context) (err error) {
+	params := adminLoginLockParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	err = service.UnlockLoginDefense(c.Context(), service.LoginDefenseTarget{
+		Category: params.Category,
+		Value:    params.Value,
+	})
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
@@ -17,19 +17,51 @@ package controller
 import (
 	"time"
 
+	"github.com/vicanso/elite/flags"
 	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/session"
 	"github.com/vicanso/elite/util"
 	"github.com/vicanso/elton"
 )
 
 type applicationCtrl struct{}
 
+// 响应相关定义
+type (
+	// applicationFeatureFlagsResp 功能开关响应
+	applicationFeatureFlagsResp struct {
+		Flags map[string]string `json:"flags"`
+	}
+)
+
 func init() {
 	g := router.NewGroup("/applications")
 	ctrl := applicationCtrl{}
 
 	g.GET("/v1/setting", ctrl.getSetting)
 
+	// 当前用户（设备）的功能开关
+	g.GET(
+		"/v1/feature-flags",
+		loadUserSession,
+		ctrl.listFeatureFlag,
+	)
+}
+
+// newFeatureFlagSubject 获取当前请求功能开关判断的对象
+func newFeatureFlagSubject(c *elton.Context, us *session.UserSession) *flags.Subject {
+	subject := &flags.Subject{
+		DeviceID:   util.GetDeviceID(c),
+		AppVersion: util.GetAppVersion(c),
+		Platform:   util.GetPlatform(c),
+	}
+	if us.IsLogin() {
+		info := us.MustGetInfo()
+		subject.Account = info.Account
+		subject.Roles = info.Roles
+		subject.Groups = info.Groups
+	}
+	return subject
 }
 
 func (*applicationCtrl) getSetting(c *elton.Context) (err error) {
@@ -53,3 +85,12 @@ func (*applicationCtrl) getSetting(c *elton.Context) (err error) {
 	c.Body = setting
 	return
 }
+
+// listFeatureFlag 获取当前用户（设备）所有功能开关的值
+func (*applicationCtrl) listFeatureFlag(c *elton.Context) (err error) {
+	c.NoCache()
+	c.Body = &applicationFeatureFlagsResp{
+		Flags: flags.EvaluateAll(c.Context()),
+	}
+	return
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 审计日志查询，记录由ent hook写入
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/auditlog"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+)
+
+type auditLogCtrl struct{}
+
+// 接口参数定义
+type (
+	// auditLogListParams 审计日志查询参数
+	auditLogListParams struct {
+		listParams
+
+		Begin time.Time `json:"begin"`
+		End   time.Time `json:"end"`
+		// 操作者
+		Actor string `json:"actor" validate:"omitempty,xUserAccount"`
+		// 操作的数据类型
+		EntityType string `json:"entityType" validate:"omitempty,xAuditEntityType"`
+		// 操作的数据ID
+		EntityID string `json:"entityID" validate:"omitempty,xAuditEntityID"`
+	}
+)
+
+// 接口响应定义
+type (
+	// auditLogListResp 审计日志列表响应
+	auditLogListResp struct {
+		AuditLogs []*ent.AuditLog `json:"auditLogs"`
+		Count     int             `json:"count"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/audit-logs", loadUserSession)
+
+	ctrl := auditLogCtrl{}
+
+	// 审计日志查询
+	g.GET(
+		"/v1",
+		requirePermission(schema.PermissionAuditRead),
+		ctrl.list,
+	)
+}
+
+// where 审计日志的where筛选
+func (params *auditLogListParams) where(query *ent.AuditLogQuery) *ent.AuditLogQuery {
+	if params.Actor != "" {
+		query = query.Where(auditlog.ActorEQ(params.Actor))
+	}
+	if params.EntityType != "" {
+		query = query.Where(auditlog.EntityTypeEQ(params.EntityType))
+	}
+	if params.EntityID != "" {
+		id, _ := strconv.Atoi(params.EntityID)
+		query = query.Where(auditlog.EntityIDEQ(id))
+	}
+	if !params.Begin.IsZero() {
+		query = query.Where(auditlog.CreatedAtGTE(params.Begin))
+	}
+	if !params.End.IsZero() {
+		query = query.Where(auditlog.CreatedAtLTE(params.End))
+	}
+	return query
+}
+
+// queryAll 查询审计日志
+func (params *auditLogListParams) queryAll(ctx context.Context) (auditLogs []*ent.AuditLog, err error) {
+	query := getEntClient().AuditLog.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算审计日志总数
+func (params *auditLogListParams) count(ctx context.Context) (count int, err error) {
+	query := getEntClient().AuditLog.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// list 审计日志列表
+func (*auditLogCtrl) list(c *elton.Context) (err error) {
+	params := auditLogListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	auditLogs, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &auditLogListResp{
+		Count:     count,
+		AuditLogs: auditLogs,
+	}
+	return
+}
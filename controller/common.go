@@ -158,7 +158,12 @@ func (*commonCtrl) getCaptcha(c *elton.Context) (err error) {
 	if fontColor == "" {
 		fontColor = "102,102,102"
 	}
-	info, err := service.GetCaptcha(c.Context(), fontColor, bgColor)
+	length := service.CaptchaLength
+	// 登录失败较多时需要使用更长的图形验证码
+	if c.QueryParam("level") == captchaLevelStrong {
+		length = service.CaptchaStrongLength
+	}
+	info, err := service.GetCaptchaWithLength(c.Context(), fontColor, bgColor, length)
 	if err != nil {
 		return
 	}
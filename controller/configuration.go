@@ -12,18 +12,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// 应用相关配置，包括IP拦截、路由mock、路由并发限制等配置信息
+// 应用相关配置，包括IP拦截、路由mock、路由并发限制等配置信息，
+// 每次变更均保存为新的版本，可对比版本差异或回滚
 
 package controller
 
 import (
 	"context"
+	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/ent"
 	"github.com/vicanso/elite/ent/configuration"
 	confSchema "github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/ent/configurationversion"
 	"github.com/vicanso/elite/router"
 	"github.com/vicanso/elite/schema"
 	"github.com/vicanso/elite/service"
@@ -41,6 +45,27 @@ type (
 		Configurations []*ent.Configuration `json:"configurations"`
 		Count          int                  `json:"count"`
 	}
+	// configurationSchemaListResp 配置schema列表响应
+	configurationSchemaListResp struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	}
+	// configurationVersionListResp 配置版本列表响应
+	configurationVersionListResp struct {
+		Versions []*ent.ConfigurationVersion `json:"versions"`
+		Count    int                         `json:"count"`
+	}
+	// configurationUpcomingChange 即将发生的配置变更
+	configurationUpcomingChange struct {
+		ID       int                 `json:"id"`
+		Name     string              `json:"name"`
+		Category confSchema.Category `json:"category"`
+		Action   string              `json:"action"`
+		At       time.Time           `json:"at"`
+	}
+	// configurationUpcomingChangeListResp 即将发生的配置变更列表响应
+	configurationUpcomingChangeListResp struct {
+		Changes []*configurationUpcomingChange `json:"changes"`
+	}
 )
 
 // 参数相关定义
@@ -63,6 +88,13 @@ type (
 		Data      string              `json:"data" validate:"omitempty,xConfigurationData"`
 		StartedAt time.Time           `json:"startedAt"`
 		EndedAt   time.Time           `json:"endedAt"`
+		// 变更原因
+		Reason string `json:"reason" validate:"omitempty,xConfigurationVersionReason"`
+	}
+	// configurationValidateParams 配置数据校验参数
+	configurationValidateParams struct {
+		Category confSchema.Category `json:"category" validate:"required,xConfigurationCategory"`
+		Data     string              `json:"data" validate:"required,xConfigurationData"`
 	}
 
 	// configurationListParmas 配置查询参数
@@ -72,6 +104,21 @@ type (
 		Name     string              `json:"name" validate:"omitempty,xConfigurationName"`
 		Category confSchema.Category `json:"category" validate:"omitempty,xConfigurationCategory"`
 	}
+	// configurationVersionListParams 配置版本查询参数
+	configurationVersionListParams struct {
+		listParams
+
+		// ID 配置id，由route param中获取并设置，因此不设置validate
+		ID int `json:"id"`
+	}
+	// configurationVersionDiffParams 配置版本对比参数
+	configurationVersionDiffParams struct {
+		From string `json:"from" validate:"omitempty,xConfigurationVersion"`
+	}
+	// configurationUpcomingChangeListParams 即将发生的配置变更查询参数
+	configurationUpcomingChangeListParams struct {
+		listParams
+	}
 )
 
 const (
@@ -79,18 +126,22 @@ const (
 )
 
 func init() {
-	g := router.NewGroup("/configurations", loadUserSession, shouldBeSu)
+	g := router.NewGroup("/configurations", loadUserSession)
 	ctrl := configurationCtrl{}
 
 	// 查询配置
 	g.GET(
 		"/v1",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
 		ctrl.list,
 	)
 
 	// 添加配置
 	g.POST(
 		"/v1",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigWrite),
+		requirePermission(schema.PermissionConfigUpdate),
 		newTrackerMiddleware(cs.ActionConfigurationAdd),
 		ctrl.add,
 	)
@@ -98,21 +149,81 @@ func init() {
 	// 获取当前有效配置
 	g.GET(
 		"/v1/current-valid",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
 		ctrl.getCurrentValid,
 	)
 
 	// 更新配置
 	g.PATCH(
 		"/v1/{id}",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigWrite),
+		requirePermission(schema.PermissionConfigUpdate),
 		newTrackerMiddleware(cs.ActionConfigurationUpdate),
 		ctrl.update,
 	)
 
+	// 各分类配置数据的schema
+	g.GET(
+		"/v1/schemas",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
+		ctrl.listSchema,
+	)
+
+	// 校验配置数据（不保存）
+	g.POST(
+		"/v1/validation",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigWrite),
+		requirePermission(schema.PermissionConfigUpdate),
+		ctrl.validateData,
+	)
+
+	// 即将发生的配置变更（生效或失效）
+	g.GET(
+		"/v1/upcoming-changes",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
+		ctrl.listUpcomingChange,
+	)
+
 	// 查询单个配置
 	g.GET(
 		"/v1/{id}",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
 		ctrl.findByID,
 	)
+
+	// 配置版本列表
+	g.GET(
+		"/v1/{id}/versions",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
+		ctrl.listVersion,
+	)
+	// 配置指定版本
+	g.GET(
+		"/v1/{id}/versions/{version}",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
+		ctrl.getVersion,
+	)
+	// 配置版本对比
+	g.GET(
+		"/v1/{id}/versions/{version}/diff",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigRead),
+		requirePermission(schema.PermissionConfigRead),
+		ctrl.diffVersion,
+	)
+	// 配置回滚至指定版本
+	g.POST(
+		"/v1/{id}/versions/{version}/rollback",
+		newCheckScopesMiddleware(schema.APIKeyScopeConfigWrite),
+		requirePermission(schema.PermissionConfigUpdate),
+		newTrackerMiddleware(cs.ActionConfigurationRollback),
+		ctrl.rollback,
+	)
 }
 
 // validateBeforeSave 保存前校验
@@ -137,15 +248,15 @@ func (params *configurationAddParams) save(ctx context.Context, owner string) (c
 	if err != nil {
 		return
 	}
-	return getEntClient().Configuration.Create().
-		SetName(params.Name).
-		SetStatus(params.Status).
-		SetCategory(params.Category).
-		SetData(params.Data).
-		SetOwner(owner).
-		SetStartedAt(params.StartedAt).
-		SetEndedAt(params.EndedAt).
-		Save(ctx)
+	return configurationSrv.Add(ctx, service.ConfigurationSaveParams{
+		Name:      params.Name,
+		Category:  params.Category,
+		Status:    params.Status,
+		Data:      params.Data,
+		StartedAt: params.StartedAt,
+		EndedAt:   params.EndedAt,
+		Author:    owner,
+	})
 }
 
 // where 将查询条件中的参数转换为对应的where条件
@@ -180,30 +291,40 @@ func (params *configurationListParmas) count(ctx context.Context) (count int, er
 	return query.Count(ctx)
 }
 
-// update 更新配置信息
-func (params *configurationUpdateParams) updateOneID(ctx context.Context, id int) (configuration *ent.Configuration, err error) {
-	updateOne := getEntClient().Configuration.
-		UpdateOneID(id)
-	if !params.StartedAt.IsZero() {
-		updateOne = updateOne.SetStartedAt(params.StartedAt)
-	}
-	if !params.EndedAt.IsZero() {
-		updateOne = updateOne.SetEndedAt(params.EndedAt)
-	}
-	if params.Name != "" {
-		updateOne = updateOne.SetName(params.Name)
-	}
+// updateOneID 更新配置信息，并生成新的版本
+func (params *configurationUpdateParams) updateOneID(ctx context.Context, id int, author string) (configuration *ent.Configuration, err error) {
+	return configurationSrv.Update(ctx, id, service.ConfigurationSaveParams{
+		Name:      params.Name,
+		Category:  params.Category,
+		Status:    params.Status,
+		Data:      params.Data,
+		StartedAt: params.StartedAt,
+		EndedAt:   params.EndedAt,
+		Author:    author,
+		Reason:    params.Reason,
+	})
+}
 
-	if params.Status != 0 {
-		updateOne = updateOne.SetStatus(params.Status)
-	}
-	if params.Category != "" {
-		updateOne = updateOne.SetCategory(params.Category)
-	}
-	if params.Data != "" {
-		updateOne = updateOne.SetData(params.Data)
-	}
-	return updateOne.Save(ctx)
+// where 将查询条件转换为where
+func (params *configurationVersionListParams) where(query *ent.ConfigurationVersionQuery) *ent.ConfigurationVersionQuery {
+	return query.Where(configurationversion.Configuration(params.ID))
+}
+
+// queryAll 查询配置版本
+func (params *configurationVersionListParams) queryAll(ctx context.Context) (versions []*ent.ConfigurationVersion, err error) {
+	query := getEntClient().ConfigurationVersion.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算配置版本总数
+func (params *configurationVersionListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().ConfigurationVersion.Query()
+	query = params.where(query)
+	return query.Count(ctx)
 }
 
 // add 添加配置
@@ -258,7 +379,8 @@ func (*configurationCtrl) update(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
-	configuration, err := params.updateOneID(c.Context(), id)
+	us := getUserSession(c)
+	configuration, err := params.updateOneID(c.Context(), id, us.MustGetInfo().Account)
 	if err != nil {
 		return
 	}
@@ -286,3 +408,146 @@ func (*configurationCtrl) getCurrentValid(c *elton.Context) (err error) {
 	c.Body = service.GetCurrentValidConfiguration()
 	return
 }
+
+// listSchema 获取各分类配置数据的schema
+func (*configurationCtrl) listSchema(c *elton.Context) (err error) {
+	c.CacheMaxAge(time.Minute)
+	c.Body = &configurationSchemaListResp{
+		Schemas: service.GetConfigurationSchemas(),
+	}
+	return
+}
+
+// validateData 校验配置数据，用于保存前检查
+func (*configurationCtrl) validateData(c *elton.Context) (err error) {
+	params := configurationValidateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = service.ValidateConfigurationData(params.Category, params.Data)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// listUpcomingChange 查询即将发生的配置变更，按时间排序
+func (*configurationCtrl) listUpcomingChange(c *elton.Context) (err error) {
+	params := configurationUpcomingChangeListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	result, err := configurationSrv.ListUpcomingChanges(c.Context(), params.GetLimit())
+	if err != nil {
+		return
+	}
+	changes := make([]*configurationUpcomingChange, len(result))
+	for index, item := range result {
+		changes[index] = &configurationUpcomingChange{
+			ID:       item.Configuration.ID,
+			Name:     item.Configuration.Name,
+			Category: item.Configuration.Category,
+			Action:   item.Action,
+			At:       item.At,
+		}
+	}
+	c.Body = &configurationUpcomingChangeListResp{
+		Changes: changes,
+	}
+	return
+}
+
+// getConfigurationVersionFromParams 从route params中获取配置id与版本号
+func getConfigurationVersionFromParams(c *elton.Context) (id, version int, err error) {
+	id, err = getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	version, err = strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// listVersion 查询配置版本
+func (*configurationCtrl) listVersion(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := configurationVersionListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	params.ID = id
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	versions, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &configurationVersionListResp{
+		Versions: versions,
+		Count:    count,
+	}
+	return
+}
+
+// getVersion 获取配置的指定版本
+func (*configurationCtrl) getVersion(c *elton.Context) (err error) {
+	id, version, err := getConfigurationVersionFromParams(c)
+	if err != nil {
+		return
+	}
+	result, err := configurationSrv.GetVersion(c.Context(), id, version)
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
+
+// diffVersion 对比配置版本，默认与上一版本对比
+func (*configurationCtrl) diffVersion(c *elton.Context) (err error) {
+	id, version, err := getConfigurationVersionFromParams(c)
+	if err != nil {
+		return
+	}
+	params := configurationVersionDiffParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	from, _ := strconv.Atoi(params.From)
+	diff, err := configurationSrv.DiffVersion(c.Context(), id, from, version)
+	if err != nil {
+		return
+	}
+	c.Body = diff
+	return
+}
+
+// rollback 配置回滚至指定版本
+func (*configurationCtrl) rollback(c *elton.Context) (err error) {
+	id, version, err := getConfigurationVersionFromParams(c)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	configuration, err := configurationSrv.Rollback(c.Context(), id, version, us.MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	c.Body = configuration
+	return
+}
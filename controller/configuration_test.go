@@ -52,7 +52,7 @@ func TestConfigurationParams(t *testing.T) {
 			Category:  category,
 			StartedAt: now(),
 			EndedAt:   now(),
-			Data:      "test",
+			Data:      "192.168.1.1",
 		}
 		conf, err := params.save(context.Background(), "treexie")
 		assert.Nil(err)
@@ -103,7 +103,7 @@ func TestConfigurationParams(t *testing.T) {
 		newTime := now()
 		status := schema.StatusEnabled
 		category := confSchema.CategoryMockTime
-		data := "mock time"
+		data := newTime.Format(time.RFC3339)
 		params := configurationUpdateParams{
 			StartedAt: newTime,
 			EndedAt:   newTime,
@@ -111,7 +111,7 @@ func TestConfigurationParams(t *testing.T) {
 			Category:  category,
 			Data:      data,
 		}
-		conf, err := params.updateOneID(context.Background(), configID)
+		conf, err := params.updateOneID(context.Background(), configID, "treexie")
 		assert.Nil(err)
 		assert.Equal(status, conf.Status)
 		assert.Equal(category, conf.Category)
@@ -15,12 +15,19 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 
 	"github.com/rs/zerolog"
+	"github.com/tidwall/gjson"
 	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/flags"
 	"github.com/vicanso/elite/helper"
 	"github.com/vicanso/elite/log"
 	"github.com/vicanso/elite/middleware"
@@ -37,26 +44,45 @@ import (
 
 type listParams = helper.EntListParams
 
+const (
+	errLoginDefenseCategory = "loginDefense"
+	// errCodeStrongCaptcha 需要更长图形验证码的出错码，客户端需要重新获取验证码
+	errCodeStrongCaptcha = "strongCaptcha"
+	// captchaLevelStrong 获取更长的图形验证码
+	captchaLevelStrong = "strong"
+)
+
+// adminRoles 管理员角色列表
+var adminRoles = []string{
+	schema.UserRoleSu,
+	schema.UserRoleAdmin,
+}
+
 var (
 	getEntClient = helper.EntGetClient
 	now          = util.NowString
 
 	getUserSession = session.NewUserSession
 	// 加载用户session
-	loadUserSession = elton.Compose(session.New(), sessionHandle)
+	loadUserSession = newLoadUserSessionMiddleware()
 	// 判断用户是否登录
 	shouldBeLogin = checkLoginMiddleware
 	// 判断用户是否未登录
 	shouldBeAnonymous = checkAnonymousMiddleware
-	// 判断用户是否admin权限
-	shouldBeAdmin = newCheckRolesMiddleware([]string{
-		schema.UserRoleSu,
-		schema.UserRoleAdmin,
-	})
+	// 判断用户是否admin权限，且权限要求时已完成两步验证
+	shouldBeAdmin = elton.Compose(newCheckRolesMiddleware(adminRoles), checkTwoFactorMiddleware)
+	// 判断用户是否可启用两步验证（管理员角色或拥有权限），不校验两步验证
+	shouldBeTwoFactorEnrollable = checkTwoFactorEnrollableMiddleware
+	// 判断用户是否拥有权限，且权限要求时已完成两步验证
+	requirePermission = newCheckPermissionMiddleware
+	// 判断用户是否已验证邮箱
+	shouldBeEmailVerified = checkEmailVerifiedMiddleware
+	// 判断是否非模拟登录（用于创建或修改凭证的接口）
+	shouldNotImpersonate = checkNotImpersonatingMiddleware
 	// shouldBeSu 判断用户是否su权限
-	shouldBeSu = newCheckRolesMiddleware([]string{
+	shouldBeSu = elton.Compose(newCheckRolesMiddleware([]string{
 		schema.UserRoleSu,
-	})
+	}), checkTwoFactorMiddleware)
 
 	// 创建新的并发控制中间件
 	newConcurrentLimit = middleware.NewConcurrentLimit
@@ -64,6 +90,10 @@ var (
 	newIPLimit = middleware.NewIPLimit
 	// 创建出错限制中间件
 	newErrorLimit = middleware.NewErrorLimit
+	// 创建冷却时间限制中间件
+	newCooldownLimit = middleware.NewCooldownLimit
+	// 登录防护，按账户、IP与网段限制登录失败
+	loginDefense = newLoginDefenseMiddleware()
 	// noCacheIfRequestNoCache 请求参数指定no cache，则设置no-cache
 	noCacheIfRequestNoCache = middleware.NewNoCacheWithCondition("cacheControl", "no-cache")
 
@@ -97,12 +127,37 @@ func isLogin(c *elton.Context) bool {
 	return us.IsLogin()
 }
 
+// hasPermission 判断是否拥有权限（权限要求时需已完成两步验证），
+// 需要先加载session，未加载则返回false
+func hasPermission(c *elton.Context, permission string) bool {
+	us := session.NewUserSession(c)
+	if us == nil || !us.IsLogin() {
+		return false
+	}
+	info := us.MustGetInfo()
+	return util.ContainsString(info.Permissions, permission) && isTwoFactorSatisfied(info)
+}
+
+// isTwoFactorRequired 判断是否必须启用两步验证，拥有敏感权限的账户必须启用
+func isTwoFactorRequired(info session.UserInfo) bool {
+	return util.ContainsAny(accountConfig.TOTPRequiredPermissions, info.Permissions)
+}
+
+// isTwoFactorSatisfied 判断是否满足两步验证的要求，
+// 拥有敏感权限时需已完成两步验证
+func isTwoFactorSatisfied(info session.UserInfo) bool {
+	if info.TwoFactorVerified {
+		return true
+	}
+	return !isTwoFactorRequired(info)
+}
+
 func validateLogin(c *elton.Context) (err error) {
 	if !isLogin(c) {
 		err = hes.New("请先登录", errUserCategory)
 		return
 	}
-	return
+	return checkPasswordResetRequired(c, getUserSession(c).MustGetInfo())
 }
 
 // checkLoginMiddleware 校验是否登录中间件
@@ -114,6 +169,105 @@ func checkLoginMiddleware(c *elton.Context) (err error) {
 	return c.Next()
 }
 
+// newLoginDefenseMiddleware 创建登录防护中间件，已锁定或未到重试时间则拒绝登录，
+// 失败较多时要求更长的图形验证码，仅账户或密码错误时记录失败次数，
+// 成功则清除账户的失败记录
+func newLoginDefenseMiddleware() elton.Handler {
+	return func(c *elton.Context) (err error) {
+		ctx := c.Context()
+		account := gjson.GetBytes(c.RequestBody, "account").String()
+		targets := service.NewLoginDefenseTargets(account, c.RealIP())
+		status, err := service.GetLoginDefenseStatus(ctx, targets)
+		if err != nil {
+			return
+		}
+		if status.Lock != nil {
+			err = hes.NewWithStatusCode(fmt.Sprintf("登录失败次数过多已被临时锁定，请于%s后再试或联系管理员", status.Lock.ExpiredAt.Format("15:04:05")), http.StatusForbidden, errLoginDefenseCategory)
+			return
+		}
+		if status.RetryAfter > 0 {
+			seconds := int(math.Ceil(status.RetryAfter.Seconds()))
+			c.SetHeader("Retry-After", strconv.Itoa(seconds))
+			err = hes.NewWithStatusCode(fmt.Sprintf("登录失败次数过多，请%d秒后再试", seconds), http.StatusTooManyRequests, errLoginDefenseCategory)
+			return
+		}
+		if status.StrongCaptcha && len(middleware.GetCaptchaValue(c)) < service.CaptchaStrongLength {
+			he := hes.New("登录失败次数过多，请使用新的图形验证码", errLoginDefenseCategory)
+			he.Code = errCodeStrongCaptcha
+			err = he
+			return
+		}
+		err = c.Next()
+		if err == errAccountOrPasswordInvalid {
+			e := service.AddLoginFailure(ctx, targets)
+			if e != nil {
+				log.Default().Error().
+					Err(e).
+					Str("account", account).
+					Msg("add login failure fail")
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		if account != "" {
+			e := service.ClearLoginFailures(ctx, service.LoginDefenseTarget{
+				Category: cs.LoginDefenseAccount,
+				Value:    account,
+			})
+			if e != nil {
+				log.Default().Error().
+					Err(e).
+					Str("account", account).
+					Msg("clear login failures fail")
+			}
+		}
+		return
+	}
+}
+
+// checkEmailVerifiedMiddleware 校验是否已登录且邮箱已验证
+func checkEmailVerifiedMiddleware(c *elton.Context) (err error) {
+	err = validateLogin(c)
+	if err != nil {
+		return
+	}
+	u, err := getEntClient().User.Query().
+		Where(user.Account(getUserSession(c).MustGetInfo().Account)).
+		First(c.Context())
+	if err != nil {
+		return
+	}
+	if u.EmailVerifiedAt == nil {
+		err = hes.NewWithStatusCode("请先验证邮箱", http.StatusForbidden, errUserCategory)
+		return
+	}
+	return c.Next()
+}
+
+// isImpersonating 判断是否模拟登录中
+func isImpersonating(c *elton.Context) bool {
+	us := getUserSession(c)
+	if us == nil || !us.IsLogin() {
+		return false
+	}
+	return us.MustGetInfo().Impersonator != nil
+}
+
+// errImpersonatingForbidden 模拟登录时禁止创建或修改凭证
+var errImpersonatingForbidden = hes.NewWithStatusCode("模拟登录中不可使用该功能", http.StatusForbidden, errUserCategory)
+
+// checkNotImpersonatingMiddleware 模拟登录时禁止使用，用于创建或修改凭证（如API key、两步验证）的接口，
+// 避免模拟登录结束后管理员仍可通过其创建的凭证访问该账户
+func checkNotImpersonatingMiddleware(c *elton.Context) (err error) {
+	if isImpersonating(c) {
+		err = errImpersonatingForbidden
+		return
+	}
+	return c.Next()
+}
+
 // checkAnonymousMiddleware 判断是匿名状态
 func checkAnonymousMiddleware(c *elton.Context) (err error) {
 	if isLogin(c) {
@@ -144,6 +298,140 @@ func newCheckRolesMiddleware(validRoles []string) elton.Handler {
 	}
 }
 
+// checkTwoFactorEnrollableMiddleware 校验是否可启用两步验证，
+// 管理员角色或拥有权限（可能要求两步验证）的账户才可启用
+func checkTwoFactorEnrollableMiddleware(c *elton.Context) (err error) {
+	err = validateLogin(c)
+	if err != nil {
+		return
+	}
+	info := getUserSession(c).MustGetInfo()
+	if !util.ContainsAny(adminRoles, info.Roles) && len(info.Permissions) == 0 {
+		err = hes.NewWithStatusCode("禁止使用该功能", http.StatusForbidden, errUserCategory)
+		return
+	}
+	return c.Next()
+}
+
+// newCheckScopesMiddleware 创建API key权限范围校验中间件，需要在角色校验之前使用。
+// 使用API key时为匿名状态，仅在权限范围校验通过后才设置为key所属的账户，
+// 因此未声明权限范围的路由无法使用API key访问；非API key的请求则直接跳过
+func newCheckScopesMiddleware(scopes ...string) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		value, ok := c.Get(cs.APIKey)
+		if !ok {
+			return c.Next()
+		}
+		info := value.(*apiKeyInfo)
+		for _, scope := range scopes {
+			if !util.ContainsString(info.key.Scopes, scope) {
+				err = hes.NewWithStatusCode("API key无此权限", http.StatusForbidden, errUserCategory)
+				return
+			}
+		}
+		// 是否满足两步验证以创建key时为准，账户之后被授予要求两步验证的权限时，
+		// 未完成两步验证创建的key无法访问相应的接口
+		userInfo := session.UserInfo{
+			Account:           info.user.Account,
+			ID:                info.user.ID,
+			TwoFactorVerified: info.key.TwoFactorVerified,
+		}
+		err = fillUserPermissions(c.Context(), &userInfo, info.user)
+		if err != nil {
+			return
+		}
+		err = getUserSession(c).SetInfo(userInfo)
+		if err != nil {
+			return
+		}
+		tracerInfo := tracer.GetTracerInfo()
+		tracerInfo.Account = info.user.Account
+		tracer.SetTracerInfo(tracerInfo)
+		c.WithContext(helper.NewAuditContext(c.Context(), &helper.AuditActor{
+			Account: info.user.Account,
+			IP:      c.RealIP(),
+			TraceID: c.ID,
+		}))
+		return c.Next()
+	}
+}
+
+// newCheckPermissionMiddleware 创建用户权限校验中间件，权限要求时需已完成两步验证
+func newCheckPermissionMiddleware(permission string) elton.Handler {
+	return elton.Compose(func(c *elton.Context) (err error) {
+		err = validateLogin(c)
+		if err != nil {
+			return
+		}
+		userInfo, err := getUserSession(c).GetInfo()
+		if err != nil {
+			return
+		}
+		if !util.ContainsString(userInfo.Permissions, permission) {
+			err = hes.NewWithStatusCode("禁止使用该功能", http.StatusForbidden, errUserCategory)
+			return
+		}
+		return c.Next()
+	}, checkTwoFactorMiddleware)
+}
+
+// fillUserPermissions 根据用户的角色与分组设置session中的角色及权限
+func fillUserPermissions(ctx context.Context, info *session.UserInfo, u *ent.User) (err error) {
+	// 需要先获取版本，避免获取权限后版本更新导致未重新获取
+	version, err := service.GetRBACVersion(ctx)
+	if err != nil {
+		return
+	}
+	roles, permissions, err := service.ResolveUserPermissions(ctx, u.Roles, u.Groups)
+	if err != nil {
+		return
+	}
+	info.Roles = roles
+	info.Groups = u.Groups
+	info.Permissions = permissions
+	info.PermissionVersion = version
+	return
+}
+
+// refreshUserPermissions 权限配置有更新时重新获取session中的角色及权限
+func refreshUserPermissions(c *elton.Context, us *session.UserSession) (err error) {
+	info, err := us.GetInfo()
+	if err != nil {
+		return
+	}
+	version, err := service.GetRBACVersion(c.Context())
+	if err != nil {
+		return
+	}
+	if version == info.PermissionVersion {
+		return
+	}
+	u, err := getEntClient().User.Query().
+		Where(user.Account(info.Account)).
+		First(c.Context())
+	if err != nil {
+		// 账户已不存在，则清除登录状态
+		if ent.IsNotFound(err) {
+			return us.SetInfo(session.UserInfo{})
+		}
+		return
+	}
+	err = fillUserPermissions(c.Context(), &info, u)
+	if err != nil {
+		return
+	}
+	return us.SetInfo(info)
+}
+
+// checkTwoFactorMiddleware 校验两步验证，需要在角色校验之后使用
+func checkTwoFactorMiddleware(c *elton.Context) (err error) {
+	if !isTwoFactorSatisfied(getUserSession(c).MustGetInfo()) {
+		err = hes.NewWithStatusCode("请先启用并完成两步验证", http.StatusForbidden, errUserCategory)
+		return
+	}
+	return c.Next()
+}
+
 // newTrackerMiddleware 初始化用户行为跟踪中间件
 func newTrackerMiddleware(action string) elton.Handler {
 	marshalString := func(data interface{}) string {
@@ -154,10 +442,15 @@ func newTrackerMiddleware(action string) elton.Handler {
 		Mask: cs.MaskRegExp,
 		OnTrack: func(info *M.TrackerInfo, c *elton.Context) {
 			account := ""
+			impersonator := ""
 			tid := util.GetTrackID(c)
 			us := session.NewUserSession(c)
 			if us != nil && us.IsLogin() {
-				account = us.MustGetInfo().Account
+				info := us.MustGetInfo()
+				account = info.Account
+				if info.IsImpersonating() {
+					impersonator = info.Impersonator.Account
+				}
 			}
 			ip := c.RealIP()
 			sid := util.GetSessionID(c)
@@ -186,6 +479,11 @@ func newTrackerMiddleware(action string) elton.Handler {
 				Str("ip", ip).
 				Str("sid", sid).
 				Int("result", info.Result)
+			// 模拟登录时记录管理员账号
+			if impersonator != "" {
+				fields[cs.FieldImpersonator] = impersonator
+				event = event.Str("impersonator", impersonator)
+			}
 			if len(info.Query) != 0 {
 				event = event.Dict("query", log.MapStringString(info.Query))
 			}
@@ -220,20 +518,151 @@ func getIDFromParams(c *elton.Context) (id int, err error) {
 	return
 }
 
+// apiKeySessionHandle API key认证，使用不保存的临时session，
+// 在权限范围校验通过后才设置账户信息（见newCheckScopesMiddleware）
+func apiKeySessionHandle(c *elton.Context) error {
+	key := c.GetRequestHeader(cs.HeaderAPIKey)
+	if key == "" {
+		return c.Next()
+	}
+	info, err := getAPIKeyInfo(c.Context(), key)
+	if err != nil {
+		return err
+	}
+	session.NewTemporary(c)
+	c.Set(cs.APIKey, info)
+	updateAPIKeyLastUsed(info.key, c.RealIP())
+	return c.Next()
+}
+
+// authTokenSessionHandle 访问令牌认证，根据令牌加载其绑定的session，
+// 无访问令牌时则由后续的cookie session处理
+func authTokenSessionHandle(c *elton.Context) error {
+	token := getBearerToken(c)
+	if token == "" {
+		return c.Next()
+	}
+	claims, err := service.VerifyAuthToken(c.Context(), token, service.AuthTokenAccess)
+	if err != nil {
+		return err
+	}
+	commit, err := session.Load(c, claims.SID)
+	if err != nil {
+		return err
+	}
+	// session已退出登录或已更换账户，则令牌无效
+	us := getUserSession(c)
+	if !us.IsLogin() || us.MustGetInfo().Account != claims.Account {
+		return service.ErrAuthTokenInvalid
+	}
+	c.Set(cs.AuthTokenClaims, claims)
+	err = c.Next()
+	if err != nil {
+		return err
+	}
+	return commit()
+}
+
+// newLoadUserSessionMiddleware 创建加载用户session的中间件，
+// 全局中间件（如维护判断）可能已加载session，已加载则不再重复处理
+func newLoadUserSessionMiddleware() elton.Handler {
+	load := elton.Compose(apiKeySessionHandle, authTokenSessionHandle, session.New(), sessionHandle)
+	return func(c *elton.Context) error {
+		if c.GetBool(cs.UserSessionLoaded) {
+			return c.Next()
+		}
+		c.Set(cs.UserSessionLoaded, true)
+		return load(c)
+	}
+}
+
+// LoadUserSession 加载用户session，用于路由分组之外的全局中间件
+func LoadUserSession(c *elton.Context) error {
+	return loadUserSession(c)
+}
+
+// HasPermission 判断是否拥有权限（权限要求时需已完成两步验证），需先加载用户session
+func HasPermission(c *elton.Context, permission string) bool {
+	return hasPermission(c, permission)
+}
+
 // sessionHandle session的相关处理
 func sessionHandle(c *elton.Context) error {
 	interData, _ := service.GetSessionInterceptorData()
 
 	us := session.NewUserSession(c)
 	account := ""
+	// 模拟登录已超时，则恢复为管理员
 	if us.IsLogin() {
-		account = us.MustGetInfo().Account
+		impersonator := us.MustGetInfo().Impersonator
+		if impersonator != nil && impersonator.IsExpired() {
+			err := restoreImpersonator(c, us)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if us.IsLogin() {
+		info := us.MustGetInfo()
+		// session所属的账户，模拟登录时为管理员
+		sessionAccount := info.Account
+		revoked, err := service.IsUserSessionRevoked(c.Context(), info.Account, info.LoginAt)
+		if err != nil {
+			return err
+		}
+		// 模拟登录时管理员的session失效也需要清除
+		if !revoked && info.IsImpersonating() {
+			sessionAccount = info.Impersonator.Account
+			revoked, err = service.IsUserSessionRevoked(c.Context(), sessionAccount, info.Impersonator.LoginAt)
+			if err != nil {
+				return err
+			}
+		}
+		// session已失效（如重置密码），则清除并视为未登录
+		if revoked {
+			err = us.SetInfo(session.UserInfo{})
+			if err != nil {
+				return err
+			}
+			_ = service.RemoveUserSession(c.Context(), sessionAccount, us.ID())
+		} else {
+			account = info.Account
+			// 更新session的最近活跃时间，出错不影响请求的处理
+			err = service.UpdateUserSessionActive(c.Context(), sessionAccount, us.ID())
+			if err != nil {
+				log.Default().Error().
+					Err(err).
+					Str("account", sessionAccount).
+					Msg("update user session active fail")
+			}
+			err = refreshUserPermissions(c, us)
+			if err != nil {
+				return err
+			}
+			if info.IsImpersonating() {
+				trackImpersonation(c, info)
+			}
+		}
 	}
 
 	// 设置账号信息
 	info := tracer.GetTracerInfo()
 	info.Account = account
+	info.Impersonator = ""
+	if account != "" && us.MustGetInfo().IsImpersonating() {
+		info.Impersonator = us.MustGetInfo().Impersonator.Account
+	}
 	tracer.SetTracerInfo(info)
+	// 设置审计日志的操作者
+	c.WithContext(helper.NewAuditContext(c.Context(), &helper.AuditActor{
+		Account:      info.Account,
+		Impersonator: info.Impersonator,
+		IP:           c.RealIP(),
+		TraceID:      c.ID,
+	}))
+
+	// 设置功能开关判断的对象，可通过flags.Enabled(c.Context(), name)判断
+	c.WithContext(flags.NewContext(c.Context(), newFeatureFlagSubject(c, us)))
 
 	// 如果无配置，则直接跳过
 	if interData == nil {
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
 	"github.com/vicanso/elite/schema"
 	"github.com/vicanso/elite/session"
 	"github.com/vicanso/elton"
@@ -100,6 +102,36 @@ func TestCheckAnonymous(t *testing.T) {
 	assert.Equal("已是登录状态，请先退出登录", err.(*hes.Error).Message)
 }
 
+func TestCheckNotImpersonating(t *testing.T) {
+	assert := assert.New(t)
+	c, us := newContextAndUserSession()
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+	err := us.SetInfo(session.UserInfo{
+		Account: "treexie",
+	})
+	assert.Nil(err)
+	err = checkNotImpersonatingMiddleware(c)
+	assert.Nil(err)
+	assert.True(done)
+
+	// 模拟登录中
+	done = false
+	err = us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Impersonator: &session.Impersonator{
+			Account: "admin",
+		},
+	})
+	assert.Nil(err)
+	err = checkNotImpersonatingMiddleware(c)
+	assert.Equal("模拟登录中不可使用该功能", err.(*hes.Error).Message)
+	assert.False(done)
+}
+
 func TestNewCheckRolesMiddleware(t *testing.T) {
 	assert := assert.New(t)
 	fn := newCheckRolesMiddleware([]string{
@@ -136,6 +168,155 @@ func TestNewCheckRolesMiddleware(t *testing.T) {
 	assert.True(done)
 }
 
+func TestCheckTwoFactorMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	c, us := newContextAndUserSession()
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+
+	// 权限不要求两步验证
+	err := us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Permissions: []string{
+			schema.PermissionNovelUpdate,
+		},
+	})
+	assert.Nil(err)
+	err = checkTwoFactorMiddleware(c)
+	assert.Nil(err)
+	assert.True(done)
+
+	// 权限要求两步验证但未完成
+	done = false
+	err = us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Permissions: []string{
+			schema.PermissionNovelUpdate,
+			schema.PermissionConfigUpdate,
+		},
+	})
+	assert.Nil(err)
+	err = checkTwoFactorMiddleware(c)
+	assert.Equal("请先启用并完成两步验证", err.(*hes.Error).Message)
+	assert.False(done)
+
+	// 已完成两步验证
+	err = us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Permissions: []string{
+			schema.PermissionConfigUpdate,
+		},
+		TwoFactorVerified: true,
+	})
+	assert.Nil(err)
+	err = checkTwoFactorMiddleware(c)
+	assert.Nil(err)
+	assert.True(done)
+}
+
+func TestNewCheckPermissionMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	c, us := newContextAndUserSession()
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+	fn := newCheckPermissionMiddleware(schema.PermissionNovelUpdate)
+
+	// 未登录
+	err := fn(c)
+	assert.Equal("请先登录", err.(*hes.Error).Message)
+	assert.False(done)
+
+	// 无该权限
+	err = us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Roles: []string{
+			schema.UserRoleAdmin,
+		},
+		Permissions: []string{
+			schema.PermissionUserRead,
+		},
+	})
+	assert.Nil(err)
+	err = fn(c)
+	assert.Equal("禁止使用该功能", err.(*hes.Error).Message)
+	assert.False(done)
+
+	// 拥有该权限
+	err = us.SetInfo(session.UserInfo{
+		Account: "treexie",
+		Roles: []string{
+			schema.UserRoleAdmin,
+		},
+		Permissions: []string{
+			schema.PermissionNovelUpdate,
+		},
+	})
+	assert.Nil(err)
+	err = fn(c)
+	assert.Nil(err)
+	assert.True(done)
+}
+
+func TestNewCheckScopesMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	c, us := newContextAndUserSession()
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+	fn := newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite)
+
+	// 非API key请求直接跳过
+	err := fn(c)
+	assert.Nil(err)
+	assert.True(done)
+	assert.False(us.IsLogin())
+
+	// API key无此权限
+	done = false
+	c.Set(cs.APIKey, &apiKeyInfo{
+		key: &ent.APIKey{
+			Scopes: []string{
+				schema.APIKeyScopeNovelRead,
+			},
+		},
+		user: &ent.User{
+			Account: "treexie",
+		},
+	})
+	err = fn(c)
+	assert.Equal("API key无此权限", err.(*hes.Error).Message)
+	assert.False(done)
+	assert.False(us.IsLogin())
+
+	// API key有此权限，设置为所属账户
+	c.Set(cs.APIKey, &apiKeyInfo{
+		key: &ent.APIKey{
+			Scopes: []string{
+				schema.APIKeyScopeNovelWrite,
+			},
+		},
+		user: &ent.User{
+			Account: "treexie",
+			Roles: []string{
+				schema.UserRoleAdmin,
+			},
+		},
+	})
+	err = fn(c)
+	assert.Nil(err)
+	assert.True(done)
+	assert.Equal("treexie", us.MustGetInfo().Account)
+	assert.Equal([]string{schema.UserRoleAdmin}, us.MustGetInfo().Roles)
+}
+
 func TestGetIDFromParams(t *testing.T) {
 	assert := assert.New(t)
 	c := elton.NewContext(nil, nil)
@@ -145,3 +326,30 @@ func TestGetIDFromParams(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(1, id)
 }
+
+func TestCheckPasswordResetRequired(t *testing.T) {
+	assert := assert.New(t)
+	c, us := newContextAndUserSession()
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+	err := us.SetInfo(session.UserInfo{
+		Account:               "treexie",
+		PasswordResetRequired: true,
+	})
+	assert.Nil(err)
+
+	// 要求修改密码时禁止访问其它路由
+	c.Route = "/users/v1/me/api-keys"
+	err = checkLoginMiddleware(c)
+	assert.Equal(errCodePasswordResetRequired, err.(*hes.Error).Code)
+	assert.False(done)
+
+	// 允许访问修改密码
+	c.Route = "/users/v1/me/password"
+	err = checkLoginMiddleware(c)
+	assert.Nil(err)
+	assert.True(done)
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -30,7 +31,10 @@ import (
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/ent"
 	"github.com/vicanso/elite/ent/chapter"
+	"github.com/vicanso/elite/ent/chapterrevision"
 	entNovel "github.com/vicanso/elite/ent/novel"
+	"github.com/vicanso/elite/ent/novelmoderation"
+	"github.com/vicanso/elite/ent/novelreport"
 	"github.com/vicanso/elite/ent/predicate"
 	"github.com/vicanso/elite/log"
 	"github.com/vicanso/elite/novel"
@@ -49,6 +53,9 @@ type novelCtrl struct{}
 const eliteCoverBucket = "elite-covers"
 const errNovelCategory = "novel"
 
+// 章节段落默认每次返回的数量
+const defaultNovelParagraphLimit = 50
+
 // 接口参数定义
 type (
 	// novelListParams 小说查询参数
@@ -58,10 +65,14 @@ type (
 		Keyword  string `json:"keyword" validate:"omitempty,xKeyword"`
 		IDS      string `json:"ids" validate:"omitempty,xNovelIDS"`
 		Category string `json:"category" validate:"omitempty,xNovelCategory"`
+		// Status 仅管理员可按状态查询
+		Status string `json:"status" validate:"omitempty,xNovelStatus"`
 
 		// 以下字段搜索时生成
 		AuthorKeyword string `json:"authorKeyword"`
 		NameKeyword   string `json:"nameKeyword"`
+		// 是否管理员查询，管理员可查询已禁止的小说
+		canModerate bool
 	}
 	// novelUpdateParams 更新小说参数
 	novelUpdateParams struct {
@@ -81,6 +92,25 @@ type (
 	// novelChapterUpdateParams 章节更新参数
 	novelChapterUpdateParams struct {
 		Content string `json:"content" validate:"required"`
+		Reason  string `json:"reason" validate:"omitempty,xNovelChapterRevisionReason"`
+	}
+	// novelChapterParagraphsParams 章节段落查询参数
+	novelChapterParagraphsParams struct {
+		Offset string `json:"offset" validate:"omitempty,xNovelParagraphOffset"`
+		Limit  string `json:"limit" validate:"omitempty,xNovelParagraphLimit"`
+	}
+	// novelChapterRevisionListParams 章节修订记录查询参数
+	novelChapterRevisionListParams struct {
+		listParams
+
+		// ID 小说id，由route param中获取并设置，因此不设置validate
+		ID int `json:"id"`
+		// No 章节序号，由route param中获取并设置，因此不设置validate
+		No int `json:"no"`
+	}
+	// novelChapterRevisionDiffParams 章节修订版本对比参数
+	novelChapterRevisionDiffParams struct {
+		From string `json:"from" validate:"omitempty,xNovelChapterRevisionVersion"`
 	}
 	// novelCoverParams 小说封面参数
 	novelCoverParams struct {
@@ -89,6 +119,36 @@ type (
 		Height  string `json:"height" validate:"omitempty,xNovelCoverHeight"`
 		Quality string `json:"quality" validate:"required,xNovelCoverQuality"`
 	}
+	// novelModerateParams 小说审核参数
+	novelModerateParams struct {
+		IDS    []int  `json:"ids" validate:"required,min=1,max=100"`
+		Action string `json:"action" validate:"required,xNovelModerationAction"`
+		Reason string `json:"reason" validate:"required,xNovelModerationReason"`
+	}
+	// novelModerationListParams 小说审核记录查询参数
+	novelModerationListParams struct {
+		listParams
+
+		Novel string `json:"novel" validate:"omitempty,xNovelID"`
+	}
+	// novelReportAddParams 小说举报参数
+	novelReportAddParams struct {
+		Chapter  int    `json:"chapter" validate:"omitempty,min=0"`
+		Category string `json:"category" validate:"required,xNovelReportCategory"`
+		Content  string `json:"content" validate:"omitempty,xNovelReportContent"`
+	}
+	// novelReportListParams 小说举报查询参数
+	novelReportListParams struct {
+		listParams
+
+		Novel  string `json:"novel" validate:"omitempty,xNovelID"`
+		Status string `json:"status" validate:"omitempty,xNovelReportStatus"`
+	}
+	// novelReportHandleParams 小说举报处理参数
+	novelReportHandleParams struct {
+		IDS    []int `json:"ids" validate:"required,min=1,max=100"`
+		Status int   `json:"status" validate:"required,xNovelReportStatus"`
+	}
 )
 
 // 接口响应定义
@@ -110,6 +170,29 @@ type (
 	novelCategorySummaryListResp struct {
 		Summaries novel.CategorySummaries `json:"summaries"`
 	}
+	// novelModerateResp 小说审核响应
+	novelModerateResp struct {
+		Count int `json:"count"`
+	}
+	// novelModerationListResp 小说审核记录列表响应
+	novelModerationListResp struct {
+		Moderations []*ent.NovelModeration `json:"moderations"`
+		Count       int                    `json:"count"`
+	}
+	// novelChapterRevisionListResp 章节修订记录列表响应
+	novelChapterRevisionListResp struct {
+		Revisions []*ent.ChapterRevision `json:"revisions"`
+		Count     int                    `json:"count"`
+	}
+	// novelReportListResp 小说举报列表响应
+	novelReportListResp struct {
+		Reports []*ent.NovelReport `json:"reports"`
+		Count   int                `json:"count"`
+	}
+	// novelReportHandleResp 小说举报处理响应
+	novelReportHandleResp struct {
+		Count int `json:"count"`
+	}
 )
 
 func init() {
@@ -120,11 +203,47 @@ func init() {
 	// 小说查询
 	g.GET(
 		"/v1",
+		loadUserSession,
 		ctrl.list,
 	)
+	// 小说审核（禁止/解除禁止）
+	g.POST(
+		"/v1/moderations",
+		newTrackerMiddleware(cs.ActionNovelModerate),
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelModerate),
+		ctrl.moderate,
+	)
+	// 小说审核记录
+	g.GET(
+		"/v1/moderations",
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelRead),
+		requirePermission(schema.PermissionNovelModerate),
+		ctrl.listModeration,
+	)
+	// 小说举报列表
+	g.GET(
+		"/v1/reports",
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelRead),
+		requirePermission(schema.PermissionNovelReport),
+		ctrl.listReport,
+	)
+	// 批量处理小说举报
+	g.PATCH(
+		"/v1/reports",
+		newTrackerMiddleware(cs.ActionNovelReportHandle),
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelReport),
+		ctrl.handleReport,
+	)
 	// 单本小说查询
 	g.GET(
 		"/v1/{id}",
+		loadUserSession,
 		ctrl.findByID,
 	)
 	// 单本小说更新
@@ -132,35 +251,91 @@ func init() {
 		"/v1/{id}",
 		newTrackerMiddleware(cs.ActionNovelUpdate),
 		loadUserSession,
-		shouldBeAdmin,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelUpdate),
 		ctrl.updateByID,
 	)
 	// 小说章节查询
 	g.GET(
 		"/v1/{id}/chapters",
+		loadUserSession,
 		ctrl.listChapter,
 	)
 	// 小说章节内容
 	g.GET(
 		"/v1/{id}/chapters/{no}",
+		loadUserSession,
 		ctrl.getChapterDetail,
 	)
+	// 小说章节段落（分页）
+	g.GET(
+		"/v1/{id}/chapters/{no}/paragraphs",
+		loadUserSession,
+		ctrl.getChapterParagraphs,
+	)
 	// 小说章节内容
 	g.PATCH(
 		"/v1/{id}/chapters/{no}",
+		newTrackerMiddleware(cs.ActionNovelChapterUpdate),
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelUpdate),
 		ctrl.updateChapterDetail,
 	)
+	// 章节修订记录
+	g.GET(
+		"/v1/{id}/chapters/{no}/revisions",
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelRead),
+		requirePermission(schema.PermissionNovelUpdate),
+		ctrl.listChapterRevision,
+	)
+	// 章节指定版本的修订记录
+	g.GET(
+		"/v1/{id}/chapters/{no}/revisions/{version}",
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelRead),
+		requirePermission(schema.PermissionNovelUpdate),
+		ctrl.getChapterRevision,
+	)
+	// 章节修订版本对比
+	g.GET(
+		"/v1/{id}/chapters/{no}/revisions/{version}/diff",
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelRead),
+		requirePermission(schema.PermissionNovelUpdate),
+		ctrl.diffChapterRevision,
+	)
+	// 章节回滚至指定版本
+	g.POST(
+		"/v1/{id}/chapters/{no}/revisions/{version}/rollback",
+		newTrackerMiddleware(cs.ActionNovelChapterRollback),
+		loadUserSession,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelUpdate),
+		ctrl.rollbackChapter,
+	)
 	// 小说封面
 	g.GET(
 		"/v1/{id}/cover",
+		loadUserSession,
 		ctrl.getCover,
 	)
+	// 举报小说
+	g.POST(
+		"/v1/{id}/reports",
+		newTrackerMiddleware(cs.ActionNovelReport),
+		loadUserSession,
+		newIPLimit(10, time.Minute, cs.ActionNovelReport),
+		ctrl.addReport,
+	)
 
 	// 更新所有章节
 	g.POST(
 		"/v1/update-all-chapters",
 		loadUserSession,
-		shouldBeAdmin,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelPublish),
 		ctrl.updateAllChapters,
 	)
 
@@ -168,7 +343,8 @@ func init() {
 	g.POST(
 		"/v1/publish-all",
 		loadUserSession,
-		shouldBeAdmin,
+		newCheckScopesMiddleware(schema.APIKeyScopeNovelWrite),
+		requirePermission(schema.PermissionNovelPublish),
 		ctrl.publishAll,
 	)
 
@@ -213,6 +389,14 @@ func (params *novelListParams) where(query *ent.NovelQuery) *ent.NovelQuery {
 		query = query.Where(entNovel.IDIn(ids...))
 	}
 
+	// 无审核权限不可查询已禁止的小说
+	if !params.canModerate {
+		query = query.Where(entNovel.StatusNEQ(schema.NovelStatusBan))
+	} else if params.Status != "" {
+		status, _ := strconv.Atoi(params.Status)
+		query = query.Where(entNovel.Status(status))
+	}
+
 	return query
 }
 
@@ -300,6 +484,11 @@ func (params *novelUpdateParams) update(ctx context.Context) (err error) {
 		update = update.SetSummary(params.Summary)
 	}
 	if params.Status != 0 {
+		// 禁止状态需要通过审核接口设置，以便记录审核日志
+		if params.Status == schema.NovelStatusBan {
+			err = hes.New("禁止小说请使用审核接口", errNovelCategory)
+			return
+		}
 		update = update.SetStatus(params.Status)
 	}
 	result, err := update.Save(ctx)
@@ -313,6 +502,137 @@ func (params *novelUpdateParams) update(ctx context.Context) (err error) {
 	return
 }
 
+// validateNovelAvailable 校验小说是否可访问，已禁止的小说仅有审核权限可访问
+func validateNovelAvailable(c *elton.Context, id int) (err error) {
+	if hasPermission(c, schema.PermissionNovelModerate) {
+		return
+	}
+	banned, err := novelSrv.IsBanned(c.Context(), id)
+	if err != nil {
+		return
+	}
+	if banned {
+		err = hes.NewWithStatusCode("该小说已下架", http.StatusNotFound, errNovelCategory)
+		return
+	}
+	return
+}
+
+// recordChapterRead 记录登录用户已阅读的章节，用于判断是否可发表书评，记录失败则忽略
+func recordChapterRead(c *elton.Context, id, no int) {
+	us := getUserSession(c)
+	if us == nil || !us.IsLogin() {
+		return
+	}
+	err := novelSrv.RecordChapterRead(c.Context(), us.MustGetInfo().Account, id, no)
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Int("novel", id).
+			Int("no", no).
+			Msg("record chapter read fail")
+	}
+}
+
+// setNovelCacheMaxAge 设置小说相关接口的缓存时间，
+// 有审核权限可访问已禁止的小说，因此其响应不可缓存
+func setNovelCacheMaxAge(c *elton.Context, age time.Duration) {
+	if hasPermission(c, schema.PermissionNovelModerate) {
+		c.NoCache()
+		return
+	}
+	c.CacheMaxAge(age)
+}
+
+// where 将查询条件转换为where
+func (params *novelModerationListParams) where(query *ent.NovelModerationQuery) *ent.NovelModerationQuery {
+	if params.Novel != "" {
+		id, _ := strconv.Atoi(params.Novel)
+		query = query.Where(novelmoderation.Novel(id))
+	}
+	return query
+}
+
+// queryAll 查询小说审核记录
+func (params *novelModerationListParams) queryAll(ctx context.Context) ([]*ent.NovelModeration, error) {
+	query := getEntClient().NovelModeration.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算小说审核记录总数
+func (params *novelModerationListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().NovelModeration.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// where 将查询条件转换为where
+func (params *novelChapterRevisionListParams) where(query *ent.ChapterRevisionQuery) *ent.ChapterRevisionQuery {
+	return query.Where(chapterrevision.Novel(params.ID)).
+		Where(chapterrevision.No(params.No))
+}
+
+// queryAll 查询章节修订记录
+func (params *novelChapterRevisionListParams) queryAll(ctx context.Context) (revisions []*ent.ChapterRevision, err error) {
+	query := getEntClient().ChapterRevision.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	fields := params.GetFields()
+	// 如果指定了select的字段（一般不需要返回内容）
+	if len(fields) != 0 {
+		revisions = make([]*ent.ChapterRevision, 0)
+		err = query.Select(fields[0], fields[1:]...).Scan(ctx, &revisions)
+		if err != nil {
+			return
+		}
+		return
+	}
+	return query.All(ctx)
+}
+
+// count 计算章节修订记录总数
+func (params *novelChapterRevisionListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().ChapterRevision.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// where 将查询条件转换为where
+func (params *novelReportListParams) where(query *ent.NovelReportQuery) *ent.NovelReportQuery {
+	if params.Novel != "" {
+		id, _ := strconv.Atoi(params.Novel)
+		query = query.Where(novelreport.Novel(id))
+	}
+	if params.Status != "" {
+		status, _ := strconv.Atoi(params.Status)
+		query = query.Where(novelreport.Status(status))
+	}
+	return query
+}
+
+// queryAll 查询小说举报记录
+func (params *novelReportListParams) queryAll(ctx context.Context) ([]*ent.NovelReport, error) {
+	query := getEntClient().NovelReport.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算小说举报记录总数
+func (params *novelReportListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().NovelReport.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
 // getChapterDetail 获取章节内容
 func (*novelCtrl) getChapterDetail(c *elton.Context) (err error) {
 	id, err := getIDFromParams(c)
@@ -323,11 +643,58 @@ func (*novelCtrl) getChapterDetail(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
 	result, err := novelSrv.GetChapterDetail(id, no)
 	if err != nil {
 		return
 	}
-	c.CacheMaxAge(10 * time.Minute)
+	recordChapterRead(c, id, no)
+	setNovelCacheMaxAge(c, 10*time.Minute)
+	c.Body = result
+	return
+}
+
+// getChapterParagraphs 获取章节段落，支持按段落分页，
+// 响应的ETag由内容hash生成，客户端可使用If-None-Match获取304
+func (*novelCtrl) getChapterParagraphs(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	no, err := strconv.Atoi(c.Param("no"))
+	if err != nil {
+		return
+	}
+	params := novelChapterParagraphsParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	offset, _ := strconv.Atoi(params.Offset)
+	limit := defaultNovelParagraphLimit
+	if params.Limit != "" {
+		limit, _ = strconv.Atoi(params.Limit)
+	}
+	result, err := novelSrv.GetChapterParagraphs(c.Context(), novel.ChapterParagraphsParams{
+		NovelID: id,
+		No:      no,
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return
+	}
+	recordChapterRead(c, id, no)
+	// 设置ETag之后，eTag中间件不再重新生成，由fresh中间件判断是否返回304
+	c.SetHeader(elton.HeaderETag, result.ETag())
+	setNovelCacheMaxAge(c, 10*time.Minute)
 	c.Body = result
 	return
 }
@@ -347,7 +714,14 @@ func (*novelCtrl) updateChapterDetail(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
-	_, err = novelSrv.UpdateChapterContent(id, no, params.Content)
+	us := getUserSession(c)
+	_, err = novelSrv.UpdateChapterContent(novel.ChapterUpdateParams{
+		NovelID: id,
+		No:      no,
+		Content: params.Content,
+		Editor:  us.MustGetInfo().Account,
+		Reason:  params.Reason,
+	})
 	if err != nil {
 		return
 	}
@@ -356,6 +730,103 @@ func (*novelCtrl) updateChapterDetail(c *elton.Context) (err error) {
 	return
 }
 
+// getChapterRevisionFromParams 从route params中获取小说id、章节序号以及修订版本
+func getChapterRevisionFromParams(c *elton.Context) (id, no, version int, err error) {
+	id, no, err = getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	version, err = strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// listChapterRevision 查询章节修订记录
+func (*novelCtrl) listChapterRevision(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	no, err := strconv.Atoi(c.Param("no"))
+	if err != nil {
+		return
+	}
+	params := novelChapterRevisionListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	params.ID = id
+	params.No = no
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	revisions, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &novelChapterRevisionListResp{
+		Revisions: revisions,
+		Count:     count,
+	}
+	return
+}
+
+// getChapterRevision 获取章节指定版本的修订记录
+func (*novelCtrl) getChapterRevision(c *elton.Context) (err error) {
+	id, no, version, err := getChapterRevisionFromParams(c)
+	if err != nil {
+		return
+	}
+	result, err := novelSrv.GetChapterRevision(c.Context(), id, no, version)
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
+
+// diffChapterRevision 对比章节修订版本，默认与上一版本对比
+func (*novelCtrl) diffChapterRevision(c *elton.Context) (err error) {
+	id, no, version, err := getChapterRevisionFromParams(c)
+	if err != nil {
+		return
+	}
+	params := novelChapterRevisionDiffParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	from, _ := strconv.Atoi(params.From)
+	diff, err := novelSrv.DiffChapterRevision(c.Context(), id, no, from, version)
+	if err != nil {
+		return
+	}
+	c.Body = diff
+	return
+}
+
+// rollbackChapter 章节内容回滚至指定版本
+func (*novelCtrl) rollbackChapter(c *elton.Context) (err error) {
+	id, no, version, err := getChapterRevisionFromParams(c)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	_, err = novelSrv.RollbackChapter(c.Context(), id, no, version, us.MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
 func updateCoverByURL(id int, coverURL string) (err error) {
 	resp, err := axios.Get(coverURL)
 	if err != nil {
@@ -456,6 +927,7 @@ func (*novelCtrl) list(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	params.canModerate = hasPermission(c, schema.PermissionNovelModerate)
 	count := -1
 	var novels []*ent.Novel
 	// 如果有关键字，则不计算总数
@@ -500,7 +972,7 @@ func (*novelCtrl) list(c *elton.Context) (err error) {
 			return
 		}
 	}
-	c.CacheMaxAge(5 * time.Minute)
+	setNovelCacheMaxAge(c, 5*time.Minute)
 	c.Body = &novelListResp{
 		Novels: novels,
 		Count:  count,
@@ -514,13 +986,17 @@ func (*novelCtrl) findByID(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
 	result, err := getEntClient().Novel.Query().
 		Where(entNovel.ID(id)).
 		First(c.Context())
 	if err != nil {
 		return
 	}
-	c.CacheMaxAge(10 * time.Minute)
+	setNovelCacheMaxAge(c, 10*time.Minute)
 	c.Body = result
 	return
 }
@@ -557,6 +1033,10 @@ func (*novelCtrl) listChapter(c *elton.Context) (err error) {
 		return
 	}
 	params.ID = id
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
 	count := -1
 	if params.ShouldCount() {
 		count, err = params.count(c.Context())
@@ -579,7 +1059,7 @@ func (*novelCtrl) listChapter(c *elton.Context) (err error) {
 	if len(chapters) == params.GetLimit() {
 		maxAge = 10 * time.Minute
 	}
-	c.CacheMaxAge(maxAge)
+	setNovelCacheMaxAge(c, maxAge)
 	c.Body = &novelChapterListResp{
 		Count:    count,
 		Chapters: chapters,
@@ -598,6 +1078,10 @@ func (*novelCtrl) getCover(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
 	cover, err := novelSrv.GetCover(id)
 	if err != nil {
 		return
@@ -622,7 +1106,7 @@ func (*novelCtrl) getCover(c *elton.Context) (err error) {
 	}
 
 	c.MergeHeader(header)
-	c.CacheMaxAge(time.Hour)
+	setNovelCacheMaxAge(c, time.Hour)
 	c.Body = data
 	return
 }
@@ -693,3 +1177,146 @@ func (*novelCtrl) listCategorySummary(c *elton.Context) (err error) {
 
 	return
 }
+
+// moderate 小说审核，批量禁止或解除禁止
+func (*novelCtrl) moderate(c *elton.Context) (err error) {
+	params := novelModerateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	count, err := novelSrv.Moderate(c.Context(), novel.ModerateParams{
+		IDS:      params.IDS,
+		Action:   params.Action,
+		Reason:   params.Reason,
+		Operator: us.MustGetInfo().Account,
+	})
+	if err != nil {
+		return
+	}
+	c.Body = &novelModerateResp{
+		Count: count,
+	}
+	return
+}
+
+// listModeration 查询小说审核记录
+func (*novelCtrl) listModeration(c *elton.Context) (err error) {
+	params := novelModerationListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	moderations, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &novelModerationListResp{
+		Moderations: moderations,
+		Count:       count,
+	}
+	return
+}
+
+// addReport 举报小说
+func (*novelCtrl) addReport(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := novelReportAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	account := ""
+	us := getUserSession(c)
+	if us != nil && us.IsLogin() {
+		account = us.MustGetInfo().Account
+	}
+	// 确认小说存在
+	_, err = getEntClient().Novel.Query().
+		Where(entNovel.ID(id)).
+		FirstID(c.Context())
+	if err != nil {
+		return
+	}
+	create := getEntClient().NovelReport.Create().
+		SetNovel(id).
+		SetCategory(novelreport.Category(params.Category)).
+		SetContent(params.Content).
+		SetReporter(account).
+		SetTrackID(util.GetTrackID(c)).
+		SetIP(c.RealIP())
+	if params.Chapter != 0 {
+		create = create.SetChapter(params.Chapter)
+	}
+	result, err := create.Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(result)
+	return
+}
+
+// listReport 查询小说举报记录
+func (*novelCtrl) listReport(c *elton.Context) (err error) {
+	params := novelReportListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	reports, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &novelReportListResp{
+		Reports: reports,
+		Count:   count,
+	}
+	return
+}
+
+// handleReport 批量处理小说举报
+func (*novelCtrl) handleReport(c *elton.Context) (err error) {
+	params := novelReportHandleParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	if params.Status != schema.NovelReportStatusHandled &&
+		params.Status != schema.NovelReportStatusIgnored {
+		err = hes.New("举报处理状态仅支持已处理或已忽略", errNovelCategory)
+		return
+	}
+	us := getUserSession(c)
+	count, err := getEntClient().NovelReport.Update().
+		Where(novelreport.IDIn(params.IDS...)).
+		Where(novelreport.Status(schema.NovelReportStatusPending)).
+		SetStatus(params.Status).
+		SetHandler(us.MustGetInfo().Account).
+		SetHandledAt(time.Now()).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &novelReportHandleResp{
+		Count: count,
+	}
+	return
+}
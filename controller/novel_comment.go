@@ -0,0 +1,602 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 小说段评与段落标注相关的路由处理
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/paragraphannotation"
+	"github.com/vicanso/elite/ent/paragraphcomment"
+	"github.com/vicanso/elite/novel"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type novelCommentCtrl struct{}
+
+// 接口参数定义
+type (
+	// paragraphCommentListParams 段评查询参数
+	paragraphCommentListParams struct {
+		listParams
+
+		Paragraph string `json:"paragraph" validate:"omitempty,xParagraphID"`
+
+		// 以下字段由route params设置
+		ID int `json:"id"`
+		No int `json:"no"`
+	}
+	// paragraphCommentAddParams 添加段评参数
+	paragraphCommentAddParams struct {
+		Paragraph string `json:"paragraph" validate:"required,xParagraphID"`
+		Content   string `json:"content" validate:"required,xParagraphCommentContent"`
+	}
+	// paragraphCommentAdminListParams 段评管理查询参数
+	paragraphCommentAdminListParams struct {
+		listParams
+
+		Novel   string `json:"novel" validate:"omitempty,xNovelID"`
+		Account string `json:"account" validate:"omitempty,xUserAccount"`
+		Status  string `json:"status" validate:"omitempty,xParagraphCommentStatus"`
+	}
+	// paragraphCommentUpdateParams 段评批量更新参数
+	paragraphCommentUpdateParams struct {
+		IDS    []int `json:"ids" validate:"required,min=1,max=100"`
+		Status int   `json:"status" validate:"required,xParagraphCommentStatus"`
+	}
+	// paragraphAnnotationAddParams 添加段落标注参数
+	paragraphAnnotationAddParams struct {
+		Paragraph  string `json:"paragraph" validate:"required,xParagraphID"`
+		Start      int    `json:"start" validate:"omitempty,min=0"`
+		End        int    `json:"end" validate:"omitempty,min=0"`
+		Note       string `json:"note" validate:"omitempty,xParagraphAnnotationNote"`
+		Visibility string `json:"visibility" validate:"omitempty,xParagraphAnnotationVisibility"`
+	}
+	// paragraphAnnotationUpdateParams 更新段落标注参数
+	paragraphAnnotationUpdateParams struct {
+		Note       string `json:"note" validate:"omitempty,xParagraphAnnotationNote"`
+		Visibility string `json:"visibility" validate:"omitempty,xParagraphAnnotationVisibility"`
+	}
+)
+
+// 接口响应定义
+type (
+	// paragraphCommentListResp 段评列表响应
+	paragraphCommentListResp struct {
+		Comments []*ent.ParagraphComment `json:"comments"`
+		Count    int                     `json:"count"`
+	}
+	// paragraphCommentCountListResp 段落评论数列表响应
+	paragraphCommentCountListResp struct {
+		Counts []*novel.ParagraphCommentCount `json:"counts"`
+	}
+	// paragraphCommentUpdateResp 段评批量更新响应
+	paragraphCommentUpdateResp struct {
+		Count int `json:"count"`
+	}
+	// paragraphAnnotationListResp 段落标注列表响应
+	paragraphAnnotationListResp struct {
+		Annotations []*ent.ParagraphAnnotation `json:"annotations"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/novels")
+
+	ctrl := novelCommentCtrl{}
+
+	// 章节段评
+	g.GET(
+		"/v1/{id}/chapters/{no}/comments",
+		loadUserSession,
+		ctrl.listComment,
+	)
+	// 章节各段落的评论数
+	g.GET(
+		"/v1/{id}/chapters/{no}/comment-counts",
+		loadUserSession,
+		ctrl.listCommentCount,
+	)
+	// 添加段评
+	g.POST(
+		"/v1/{id}/chapters/{no}/comments",
+		newTrackerMiddleware(cs.ActionParagraphCommentAdd),
+		loadUserSession,
+		shouldBeEmailVerified,
+		// 相同IP在60秒内只允许评论10次
+		newIPLimit(10, 60*time.Second, cs.ActionParagraphCommentAdd),
+		// 相同IP同一章节3秒内只允许评论一次
+		newConcurrentLimit([]string{
+			":ip",
+			"p:id",
+			"p:no",
+		}, 3*time.Second, cs.ActionParagraphCommentAdd),
+		ctrl.addComment,
+	)
+	// 段评点赞
+	g.POST(
+		"/v1/paragraph-comments/{id}/like",
+		newTrackerMiddleware(cs.ActionParagraphCommentLike),
+		loadUserSession,
+		shouldBeLogin,
+		newIPLimit(30, 60*time.Second, cs.ActionParagraphCommentLike),
+		ctrl.like,
+	)
+	// 段评举报
+	g.POST(
+		"/v1/paragraph-comments/{id}/report",
+		newTrackerMiddleware(cs.ActionParagraphCommentReport),
+		loadUserSession,
+		shouldBeLogin,
+		newIPLimit(10, 60*time.Second, cs.ActionParagraphCommentReport),
+		ctrl.report,
+	)
+	// 段评管理查询
+	g.GET(
+		"/v1/paragraph-comments",
+		loadUserSession,
+		requirePermission(schema.PermissionCommentModerate),
+		ctrl.listCommentByAdmin,
+	)
+	// 段评批量更新状态（隐藏或恢复）
+	g.PATCH(
+		"/v1/paragraph-comments",
+		newTrackerMiddleware(cs.ActionParagraphCommentModerate),
+		loadUserSession,
+		requirePermission(schema.PermissionCommentModerate),
+		ctrl.updateComments,
+	)
+
+	// 章节段落标注，包括自己的以及他人公开的
+	g.GET(
+		"/v1/{id}/chapters/{no}/annotations",
+		loadUserSession,
+		ctrl.listAnnotation,
+	)
+	// 添加段落标注
+	g.POST(
+		"/v1/{id}/chapters/{no}/annotations",
+		newTrackerMiddleware(cs.ActionParagraphAnnotationAdd),
+		loadUserSession,
+		shouldBeLogin,
+		newIPLimit(30, 60*time.Second, cs.ActionParagraphAnnotationAdd),
+		ctrl.addAnnotation,
+	)
+	// 更新段落标注
+	g.PATCH(
+		"/v1/paragraph-annotations/{id}",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.updateAnnotation,
+	)
+	// 删除段落标注
+	g.DELETE(
+		"/v1/paragraph-annotations/{id}",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.deleteAnnotation,
+	)
+}
+
+// getNovelChapterFromParams 从route params中获取小说id与章节序号
+func getNovelChapterFromParams(c *elton.Context) (id, no int, err error) {
+	id, err = getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	no, err = strconv.Atoi(c.Param("no"))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// validateParagraph 校验段落是否属于该章节
+func validateParagraph(id, no int, paragraph string) (err error) {
+	_, err = getParagraph(id, no, paragraph)
+	return
+}
+
+// getParagraph 获取章节中的段落，段落不存在则出错
+func getParagraph(id, no int, paragraph string) (result *novel.Paragraph, err error) {
+	detail, err := novelSrv.GetChapterDetail(id, no)
+	if err != nil {
+		return
+	}
+	for _, item := range novel.SplitParagraphs(detail.Content) {
+		if item.ID == paragraph {
+			result = item
+			return
+		}
+	}
+	err = hes.New("段落不存在", errNovelCategory)
+	return
+}
+
+// where 将查询条件转换为where
+func (params *paragraphCommentListParams) where(query *ent.ParagraphCommentQuery) *ent.ParagraphCommentQuery {
+	query = query.Where(paragraphcomment.Novel(params.ID)).
+		Where(paragraphcomment.No(params.No)).
+		Where(paragraphcomment.Status(schema.ParagraphCommentStatusNormal))
+	if params.Paragraph != "" {
+		query = query.Where(paragraphcomment.Paragraph(params.Paragraph))
+	}
+	return query
+}
+
+// queryAll 查询段评
+func (params *paragraphCommentListParams) queryAll(ctx context.Context) ([]*ent.ParagraphComment, error) {
+	query := getEntClient().ParagraphComment.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算段评总数
+func (params *paragraphCommentListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().ParagraphComment.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// where 将查询条件转换为where
+func (params *paragraphCommentAdminListParams) where(query *ent.ParagraphCommentQuery) *ent.ParagraphCommentQuery {
+	if params.Novel != "" {
+		id, _ := strconv.Atoi(params.Novel)
+		query = query.Where(paragraphcomment.Novel(id))
+	}
+	if params.Account != "" {
+		query = query.Where(paragraphcomment.Account(params.Account))
+	}
+	if params.Status != "" {
+		status, _ := strconv.Atoi(params.Status)
+		query = query.Where(paragraphcomment.Status(status))
+	}
+	return query
+}
+
+// queryAll 查询段评
+func (params *paragraphCommentAdminListParams) queryAll(ctx context.Context) ([]*ent.ParagraphComment, error) {
+	query := getEntClient().ParagraphComment.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算段评总数
+func (params *paragraphCommentAdminListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().ParagraphComment.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// listComment 查询章节段评
+func (*novelCommentCtrl) listComment(c *elton.Context) (err error) {
+	id, no, err := getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	params := paragraphCommentListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	params.ID = id
+	params.No = no
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	comments, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	setNovelCacheMaxAge(c, time.Minute)
+	c.Body = &paragraphCommentListResp{
+		Comments: comments,
+		Count:    count,
+	}
+	return
+}
+
+// listCommentCount 查询章节各段落的评论数
+func (*novelCommentCtrl) listCommentCount(c *elton.Context) (err error) {
+	id, no, err := getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	counts, err := novelSrv.CountParagraphComments(c.Context(), id, no)
+	if err != nil {
+		return
+	}
+	setNovelCacheMaxAge(c, time.Minute)
+	c.Body = &paragraphCommentCountListResp{
+		Counts: counts,
+	}
+	return
+}
+
+// addComment 添加段评
+func (*novelCommentCtrl) addComment(c *elton.Context) (err error) {
+	id, no, err := getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	params := paragraphCommentAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	err = validateParagraph(id, no, params.Paragraph)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	result, err := getEntClient().ParagraphComment.Create().
+		SetAccount(us.MustGetInfo().Account).
+		SetNovel(id).
+		SetNo(no).
+		SetParagraph(params.Paragraph).
+		SetContent(params.Content).
+		SetIP(c.RealIP()).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(result)
+	return
+}
+
+// doAction 段评点赞或举报
+func (*novelCommentCtrl) doAction(c *elton.Context, action string) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	result, err := novelSrv.AddParagraphCommentAction(c.Context(), id, us.MustGetInfo().Account, action)
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
+
+// like 段评点赞
+func (ctrl *novelCommentCtrl) like(c *elton.Context) (err error) {
+	return ctrl.doAction(c, schema.ParagraphCommentActionLike)
+}
+
+// report 段评举报
+func (ctrl *novelCommentCtrl) report(c *elton.Context) (err error) {
+	return ctrl.doAction(c, schema.ParagraphCommentActionReport)
+}
+
+// listCommentByAdmin 段评管理查询
+func (*novelCommentCtrl) listCommentByAdmin(c *elton.Context) (err error) {
+	params := paragraphCommentAdminListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	comments, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &paragraphCommentListResp{
+		Comments: comments,
+		Count:    count,
+	}
+	return
+}
+
+// updateComments 批量更新段评状态
+func (*novelCommentCtrl) updateComments(c *elton.Context) (err error) {
+	params := paragraphCommentUpdateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	count, err := getEntClient().ParagraphComment.Update().
+		Where(paragraphcomment.IDIn(params.IDS...)).
+		SetStatus(params.Status).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &paragraphCommentUpdateResp{
+		Count: count,
+	}
+	return
+}
+
+// listAnnotation 查询章节段落标注，未登录时仅返回公开的标注
+func (*novelCommentCtrl) listAnnotation(c *elton.Context) (err error) {
+	id, no, err := getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	visible := paragraphannotation.VisibilityEQ(paragraphannotation.VisibilityPublic)
+	us := getUserSession(c)
+	if us != nil && us.IsLogin() {
+		visible = paragraphannotation.Or(
+			visible,
+			paragraphannotation.Account(us.MustGetInfo().Account),
+		)
+	}
+	annotations, err := getEntClient().ParagraphAnnotation.Query().
+		Where(paragraphannotation.Novel(id)).
+		Where(paragraphannotation.No(no)).
+		Where(visible).
+		Order(ent.Asc(paragraphannotation.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	// 包含用户自己的标注，不可缓存
+	c.NoCache()
+	c.Body = &paragraphAnnotationListResp{
+		Annotations: annotations,
+	}
+	return
+}
+
+// addAnnotation 添加段落标注
+func (*novelCommentCtrl) addAnnotation(c *elton.Context) (err error) {
+	id, no, err := getNovelChapterFromParams(c)
+	if err != nil {
+		return
+	}
+	params := paragraphAnnotationAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	if params.End != 0 && params.End < params.Start {
+		err = hes.New("标注结束位置不能小于开始位置", errNovelCategory)
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	paragraph, err := getParagraph(id, no, params.Paragraph)
+	if err != nil {
+		return
+	}
+	// 标注位置需在段落内（按字符计算）
+	length := utf8.RuneCountInString(paragraph.Content)
+	if params.Start >= length || params.End > length {
+		err = hes.New("标注位置超出段落范围", errNovelCategory)
+		return
+	}
+	us := getUserSession(c)
+	create := getEntClient().ParagraphAnnotation.Create().
+		SetAccount(us.MustGetInfo().Account).
+		SetNovel(id).
+		SetNo(no).
+		SetParagraph(params.Paragraph).
+		SetStart(params.Start).
+		SetEnd(params.End).
+		SetNote(params.Note)
+	if params.Visibility != "" {
+		create = create.SetVisibility(paragraphannotation.Visibility(params.Visibility))
+	}
+	result, err := create.Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(result)
+	return
+}
+
+// getMyAnnotation 获取当前用户的段落标注
+func getMyAnnotation(c *elton.Context) (result *ent.ParagraphAnnotation, err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	result, err = getEntClient().ParagraphAnnotation.Get(c.Context(), id)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	if result.Account != us.MustGetInfo().Account {
+		err = hes.NewWithStatusCode("禁止修改他人的标注", http.StatusForbidden, errNovelCategory)
+		return
+	}
+	return
+}
+
+// updateAnnotation 更新段落标注
+func (*novelCommentCtrl) updateAnnotation(c *elton.Context) (err error) {
+	params := paragraphAnnotationUpdateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	result, err := getMyAnnotation(c)
+	if err != nil {
+		return
+	}
+	update := result.Update()
+	if params.Note != "" {
+		update = update.SetNote(params.Note)
+	}
+	if params.Visibility != "" {
+		update = update.SetVisibility(paragraphannotation.Visibility(params.Visibility))
+	}
+	result, err = update.Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
+
+// deleteAnnotation 删除段落标注
+func (*novelCommentCtrl) deleteAnnotation(c *elton.Context) (err error) {
+	result, err := getMyAnnotation(c)
+	if err != nil {
+		return
+	}
+	err = getEntClient().ParagraphAnnotation.DeleteOne(result).Exec(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 小说书评与评分相关的路由处理
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/novelreview"
+	"github.com/vicanso/elite/novel"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+)
+
+type novelReviewCtrl struct{}
+
+// 书评排序方式
+const (
+	// novelReviewSortHelpful 按有帮助的人数排序
+	novelReviewSortHelpful = "helpful"
+	// novelReviewSortTime 按发表时间排序
+	novelReviewSortTime = "time"
+)
+
+// 接口参数定义
+type (
+	// novelReviewListParams 书评查询参数
+	novelReviewListParams struct {
+		listParams
+
+		Sort string `json:"sort" validate:"omitempty,xNovelReviewSort"`
+
+		// ID 小说id，由route param中获取并设置，因此不设置validate
+		ID int `json:"id"`
+	}
+	// novelReviewAddParams 发表书评参数
+	novelReviewAddParams struct {
+		Rating  int    `json:"rating" validate:"required,xNovelReviewRating"`
+		Content string `json:"content" validate:"omitempty,xNovelReviewContent"`
+	}
+	// novelReviewUpdateParams 更新书评参数
+	novelReviewUpdateParams struct {
+		Rating  int    `json:"rating" validate:"omitempty,xNovelReviewRating"`
+		Content string `json:"content" validate:"omitempty,xNovelReviewContent"`
+	}
+)
+
+// 接口响应定义
+type (
+	// novelReviewListResp 书评列表响应
+	novelReviewListResp struct {
+		Reviews []*ent.NovelReview `json:"reviews"`
+		Count   int                `json:"count"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/novels")
+
+	ctrl := novelReviewCtrl{}
+
+	// 书评列表
+	g.GET(
+		"/v1/{id}/reviews",
+		loadUserSession,
+		ctrl.list,
+	)
+	// 发表书评
+	g.POST(
+		"/v1/{id}/reviews",
+		newTrackerMiddleware(cs.ActionNovelReviewAdd),
+		loadUserSession,
+		shouldBeEmailVerified,
+		newIPLimit(10, 60*time.Second, cs.ActionNovelReviewAdd),
+		ctrl.add,
+	)
+	// 更新书评
+	g.PATCH(
+		"/v1/reviews/{id}",
+		newTrackerMiddleware(cs.ActionNovelReviewUpdate),
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.update,
+	)
+	// 删除书评
+	g.DELETE(
+		"/v1/reviews/{id}",
+		newTrackerMiddleware(cs.ActionNovelReviewDelete),
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.delete,
+	)
+	// 书评有帮助
+	g.POST(
+		"/v1/reviews/{id}/helpful",
+		newTrackerMiddleware(cs.ActionNovelReviewVote),
+		loadUserSession,
+		shouldBeLogin,
+		newIPLimit(30, 60*time.Second, cs.ActionNovelReviewVote),
+		ctrl.voteHelpful,
+	)
+}
+
+// where 将查询条件转换为where
+func (params *novelReviewListParams) where(query *ent.NovelReviewQuery) *ent.NovelReviewQuery {
+	return query.Where(novelreview.Novel(params.ID))
+}
+
+// getOrders 获取排序，优先使用sort
+func (params *novelReviewListParams) getOrders() []ent.OrderFunc {
+	switch params.Sort {
+	case novelReviewSortHelpful:
+		return []ent.OrderFunc{
+			ent.Desc(novelreview.FieldHelpfulCount),
+			ent.Desc(novelreview.FieldCreatedAt),
+		}
+	case novelReviewSortTime:
+		return []ent.OrderFunc{
+			ent.Desc(novelreview.FieldCreatedAt),
+		}
+	}
+	return params.GetOrders()
+}
+
+// queryAll 查询书评
+func (params *novelReviewListParams) queryAll(ctx context.Context) ([]*ent.NovelReview, error) {
+	query := getEntClient().NovelReview.Query()
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.getOrders()...)
+	query = params.where(query)
+	return query.All(ctx)
+}
+
+// count 计算书评总数
+func (params *novelReviewListParams) count(ctx context.Context) (int, error) {
+	query := getEntClient().NovelReview.Query()
+	query = params.where(query)
+	return query.Count(ctx)
+}
+
+// list 查询小说书评
+func (*novelReviewCtrl) list(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := novelReviewListParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	params.ID = id
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	reviews, err := params.queryAll(c.Context())
+	if err != nil {
+		return
+	}
+	setNovelCacheMaxAge(c, time.Minute)
+	c.Body = &novelReviewListResp{
+		Reviews: reviews,
+		Count:   count,
+	}
+	return
+}
+
+// add 发表书评
+func (*novelReviewCtrl) add(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := novelReviewAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validateNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	result, err := novelSrv.AddReview(c.Context(), novel.ReviewParams{
+		Novel:   id,
+		Account: us.MustGetInfo().Account,
+		Rating:  params.Rating,
+		Content: params.Content,
+	})
+	if err != nil {
+		return
+	}
+	c.Created(result)
+	return
+}
+
+// validateReviewNovelAvailable 校验书评所属的小说是否可访问
+func validateReviewNovelAvailable(c *elton.Context, id int) (err error) {
+	review, err := getEntClient().NovelReview.Query().
+		Where(novelreview.ID(id)).
+		Select(novelreview.FieldNovel).
+		First(c.Context())
+	if err != nil {
+		return
+	}
+	return validateNovelAvailable(c, review.Novel)
+}
+
+// update 更新书评
+func (*novelReviewCtrl) update(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := novelReviewUpdateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validateReviewNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	result, err := novelSrv.UpdateReview(c.Context(), id, novel.ReviewParams{
+		Account: us.MustGetInfo().Account,
+		Rating:  params.Rating,
+		Content: params.Content,
+	})
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
+
+// delete 删除书评，管理员可删除所有书评
+func (*novelReviewCtrl) delete(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	err = validateReviewNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	account := ""
+	if !hasPermission(c, schema.PermissionNovelModerate) {
+		account = getUserSession(c).MustGetInfo().Account
+	}
+	err = novelSrv.DeleteReview(c.Context(), id, account)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// voteHelpful 书评有帮助
+func (*novelReviewCtrl) voteHelpful(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	err = validateReviewNovelAvailable(c, id)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	result, err := novelSrv.VoteReviewHelpful(c.Context(), id, us.MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	c.Body = result
+	return
+}
@@ -0,0 +1,429 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 权限、角色与用户分组的管理，仅su可操作，
+// 所有的调整均会更新权限版本，已登录的session在下次请求时重新获取权限
+
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/permission"
+	"github.com/vicanso/elite/ent/role"
+	"github.com/vicanso/elite/ent/usergroup"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type rbacCtrl struct{}
+
+// 接口参数定义
+type (
+	// rbacPermissionAddParams 添加权限参数
+	rbacPermissionAddParams struct {
+		Name        string `json:"name" validate:"required,xPermission"`
+		Description string `json:"description" validate:"omitempty,xRBACDescription"`
+	}
+	// rbacRoleAddParams 添加角色参数
+	rbacRoleAddParams struct {
+		Name        string   `json:"name" validate:"required,xUserRole"`
+		Description string   `json:"description" validate:"omitempty,xRBACDescription"`
+		Permissions []string `json:"permissions" validate:"omitempty,dive,xPermission"`
+	}
+	// rbacRoleUpdateParams 更新角色参数
+	rbacRoleUpdateParams struct {
+		Description string   `json:"description" validate:"omitempty,xRBACDescription"`
+		Permissions []string `json:"permissions" validate:"omitempty,dive,xPermission"`
+	}
+	// rbacUserGroupAddParams 添加用户分组参数
+	rbacUserGroupAddParams struct {
+		Name        string   `json:"name" validate:"required,xUserGroup"`
+		Description string   `json:"description" validate:"omitempty,xRBACDescription"`
+		Roles       []string `json:"roles" validate:"omitempty,dive,xUserRole"`
+	}
+	// rbacUserGroupUpdateParams 更新用户分组参数
+	rbacUserGroupUpdateParams struct {
+		Description string   `json:"description" validate:"omitempty,xRBACDescription"`
+		Roles       []string `json:"roles" validate:"omitempty,dive,xUserRole"`
+	}
+)
+
+// 接口响应定义
+type (
+	// rbacPermissionListResp 权限列表响应
+	rbacPermissionListResp struct {
+		Permissions []*ent.Permission `json:"permissions"`
+	}
+	// rbacRoleListResp 角色列表响应
+	rbacRoleListResp struct {
+		Roles []*ent.Role `json:"roles"`
+	}
+	// rbacUserGroupListResp 用户分组列表响应
+	rbacUserGroupListResp struct {
+		UserGroups []*ent.UserGroup `json:"userGroups"`
+	}
+)
+
+const errRBACCategory = "rbac"
+
+func init() {
+	g := router.NewGroup("/rbac", loadUserSession, shouldBeSu)
+
+	ctrl := rbacCtrl{}
+
+	// 权限列表
+	g.GET(
+		"/v1/permissions",
+		ctrl.listPermission,
+	)
+	// 添加权限
+	g.POST(
+		"/v1/permissions",
+		newTrackerMiddleware(cs.ActionPermissionAdd),
+		ctrl.addPermission,
+	)
+
+	// 角色列表
+	g.GET(
+		"/v1/roles",
+		ctrl.listRole,
+	)
+	// 添加角色
+	g.POST(
+		"/v1/roles",
+		newTrackerMiddleware(cs.ActionRoleAdd),
+		ctrl.addRole,
+	)
+	// 更新角色
+	g.PATCH(
+		"/v1/roles/{id}",
+		newTrackerMiddleware(cs.ActionRoleUpdate),
+		ctrl.updateRole,
+	)
+	// 删除角色
+	g.DELETE(
+		"/v1/roles/{id}",
+		newTrackerMiddleware(cs.ActionRoleDelete),
+		ctrl.deleteRole,
+	)
+
+	// 用户分组列表
+	g.GET(
+		"/v1/groups",
+		ctrl.listUserGroup,
+	)
+	// 添加用户分组
+	g.POST(
+		"/v1/groups",
+		newTrackerMiddleware(cs.ActionUserGroupAdd),
+		ctrl.addUserGroup,
+	)
+	// 更新用户分组
+	g.PATCH(
+		"/v1/groups/{id}",
+		newTrackerMiddleware(cs.ActionUserGroupUpdate),
+		ctrl.updateUserGroup,
+	)
+	// 删除用户分组
+	g.DELETE(
+		"/v1/groups/{id}",
+		newTrackerMiddleware(cs.ActionUserGroupDelete),
+		ctrl.deleteUserGroup,
+	)
+}
+
+// isBuiltinRole 判断是否内置角色，内置角色不可删除
+func isBuiltinRole(name string) bool {
+	for _, item := range schema.GetUserRoleList() {
+		if item.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePermissions 校验权限均已存在
+func validatePermissions(ctx context.Context, permissions []string) (err error) {
+	if len(permissions) == 0 {
+		return
+	}
+	items, err := getEntClient().Permission.Query().
+		Where(permission.NameIn(permissions...)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	names := make([]string, len(items))
+	for index, item := range items {
+		names[index] = item.Name
+	}
+	for _, name := range permissions {
+		if !util.ContainsString(names, name) {
+			err = hes.New("权限不存在："+name, errRBACCategory)
+			return
+		}
+	}
+	return
+}
+
+// validateRoles 校验角色均已存在
+func validateRoles(ctx context.Context, roles []string) (err error) {
+	if len(roles) == 0 {
+		return
+	}
+	items, err := getEntClient().Role.Query().
+		Where(role.NameIn(roles...)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	names := make([]string, len(items))
+	for index, item := range items {
+		names[index] = item.Name
+	}
+	for _, name := range roles {
+		if !util.ContainsString(names, name) {
+			err = hes.New("角色不存在："+name, errRBACCategory)
+			return
+		}
+	}
+	return
+}
+
+// listPermission 获取权限列表
+func (*rbacCtrl) listPermission(c *elton.Context) (err error) {
+	permissions, err := getEntClient().Permission.Query().
+		Order(ent.Asc(permission.FieldName)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &rbacPermissionListResp{
+		Permissions: permissions,
+	}
+	return
+}
+
+// addPermission 添加权限
+func (*rbacCtrl) addPermission(c *elton.Context) (err error) {
+	params := rbacPermissionAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	item, err := getEntClient().Permission.Create().
+		SetName(params.Name).
+		SetDescription(params.Description).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(item)
+	return
+}
+
+// listRole 获取角色列表
+func (*rbacCtrl) listRole(c *elton.Context) (err error) {
+	roles, err := getEntClient().Role.Query().
+		Order(ent.Asc(role.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &rbacRoleListResp{
+		Roles: roles,
+	}
+	return
+}
+
+// addRole 添加角色
+func (*rbacCtrl) addRole(c *elton.Context) (err error) {
+	params := rbacRoleAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validatePermissions(c.Context(), params.Permissions)
+	if err != nil {
+		return
+	}
+	item, err := getEntClient().Role.Create().
+		SetName(params.Name).
+		SetDescription(params.Description).
+		SetPermissions(params.Permissions).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(item)
+	return
+}
+
+// updateRole 更新角色，权限调整后更新权限版本
+func (*rbacCtrl) updateRole(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := rbacRoleUpdateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validatePermissions(c.Context(), params.Permissions)
+	if err != nil {
+		return
+	}
+	updateOne := getEntClient().Role.UpdateOneID(id)
+	if params.Description != "" {
+		updateOne = updateOne.SetDescription(params.Description)
+	}
+	if params.Permissions != nil {
+		updateOne = updateOne.SetPermissions(params.Permissions)
+	}
+	item, err := updateOne.Save(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.UpdateRBACVersion(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = item
+	return
+}
+
+// deleteRole 删除角色，内置角色不可删除
+func (*rbacCtrl) deleteRole(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	item, err := getEntClient().Role.Get(c.Context(), id)
+	if err != nil {
+		return
+	}
+	if isBuiltinRole(item.Name) {
+		err = hes.NewWithStatusCode("内置角色不可删除", http.StatusForbidden, errRBACCategory)
+		return
+	}
+	err = getEntClient().Role.DeleteOneID(id).Exec(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.UpdateRBACVersion(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// listUserGroup 获取用户分组列表
+func (*rbacCtrl) listUserGroup(c *elton.Context) (err error) {
+	userGroups, err := getEntClient().UserGroup.Query().
+		Order(ent.Asc(usergroup.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &rbacUserGroupListResp{
+		UserGroups: userGroups,
+	}
+	return
+}
+
+// addUserGroup 添加用户分组
+func (*rbacCtrl) addUserGroup(c *elton.Context) (err error) {
+	params := rbacUserGroupAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validateRoles(c.Context(), params.Roles)
+	if err != nil {
+		return
+	}
+	item, err := getEntClient().UserGroup.Create().
+		SetName(params.Name).
+		SetDescription(params.Description).
+		SetRoles(params.Roles).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.Created(item)
+	return
+}
+
+// updateUserGroup 更新用户分组，角色调整后更新权限版本
+func (*rbacCtrl) updateUserGroup(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	params := rbacUserGroupUpdateParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = validateRoles(c.Context(), params.Roles)
+	if err != nil {
+		return
+	}
+	updateOne := getEntClient().UserGroup.UpdateOneID(id)
+	if params.Description != "" {
+		updateOne = updateOne.SetDescription(params.Description)
+	}
+	if params.Roles != nil {
+		updateOne = updateOne.SetRoles(params.Roles)
+	}
+	item, err := updateOne.Save(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.UpdateRBACVersion(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = item
+	return
+}
+
+// deleteUserGroup 删除用户分组
+func (*rbacCtrl) deleteUserGroup(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	err = getEntClient().UserGroup.DeleteOneID(id).Exec(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.UpdateRBACVersion(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
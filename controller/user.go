@@ -18,18 +18,22 @@ package controller
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"entgo.io/ent/dialect/sql"
 	"entgo.io/ent/dialect/sql/sqljson"
-	"github.com/tidwall/gjson"
 	"github.com/vicanso/elite/config"
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/ent"
 	"github.com/vicanso/elite/ent/predicate"
+	"github.com/vicanso/elite/ent/role"
 	"github.com/vicanso/elite/ent/user"
 	"github.com/vicanso/elite/ent/userlogin"
 	"github.com/vicanso/elite/location"
@@ -37,6 +41,7 @@ import (
 	"github.com/vicanso/elite/middleware"
 	"github.com/vicanso/elite/router"
 	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/service"
 	"github.com/vicanso/elite/session"
 	"github.com/vicanso/elite/tracer"
 	"github.com/vicanso/elite/util"
@@ -51,14 +56,20 @@ type userCtrl struct{}
 type (
 	// 用户登录Token响应
 	userLoginTokenResp struct {
-		// 用户登录的Token
+		// 用户登录的Token，一次性的挑战
 		Token string `json:"token"`
+		// 生成登录proof的salt（base64）
+		Salt string `json:"salt"`
+		// 生成登录proof的argon2id参数
+		util.PasswordVerifierParams
 	}
 	// userInfoResp 用户信息响应
 	userInfoResp struct {
 		// 服务器当前时间，2021-03-06T15:10:12+08:00
 		Date string `json:"date"`
 		session.UserInfo
+		// 访问令牌，仅登录时指定使用令牌认证才返回
+		Tokens *service.AuthTokenPair `json:"tokens,omitempty"`
 	}
 
 	// userListResp 用户列表响应
@@ -100,6 +111,10 @@ type (
 		// 用户状态分组
 		// validate:"omitempty,xStatus"
 		Status string `json:"status" validate:"omitempty,xStatus"`
+
+		// 邮箱是否已验证
+		// validate:"omitempty,xBoolean"
+		EmailVerified string `json:"emailVerified" validate:"omitempty,xBoolean"`
 	}
 
 	// userLoginListParams 用户登录查询
@@ -115,20 +130,55 @@ type (
 	userRegisterLoginParams struct {
 		// 账户
 		Account string `json:"account" validate:"required,xUserAccount"`
-		// 用户密码，如果登录则是sha256(token + 用户密码)
+		// 注册时为客户端hash后的密码，服务端再使用argon2id或bcrypt hash保存，
+		// 登录时为根据挑战生成的proof（base64）
 		Password string `json:"password" validate:"required,xUserPassword"`
 	}
+	// userLoginTokenParams 获取登录token参数
+	userLoginTokenParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
 
 	// userUpdateMeParams 用户信息更新参数
 	userUpdateMeParams struct {
-		Name        string `json:"name" validate:"omitempty,xUserName"`
-		Email       string `json:"email" validate:"omitempty,xUserEmail"`
-		Password    string `json:"password" validate:"omitempty,xUserPassword"`
-		NewPassword string `json:"newPassword" validate:"omitempty,xUserPassword"`
+		Name  string `json:"name" validate:"omitempty,xUserName"`
+		Email string `json:"email" validate:"omitempty,xUserEmail"`
+		// 个人简介，空字符串表示清除
+		Bio *string `json:"bio" validate:"omitempty,xUserBio"`
+		// 已启用的隐私设置，空数组表示全部关闭
+		Privacy []string `json:"privacy" validate:"omitempty,dive,xUserPrivacy"`
+	}
+	// userChangePasswordParams 修改密码参数
+	userChangePasswordParams struct {
+		Password    string `json:"password" validate:"required,xUserPassword"`
+		NewPassword string `json:"newPassword" validate:"required,xUserPassword"`
+	}
+	// userPasswordResetParams 申请重置密码参数
+	userPasswordResetParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
+	// userPasswordResetConfirmParams 确认重置密码参数
+	userPasswordResetConfirmParams struct {
+		Token    string `json:"token" validate:"required,xUserToken"`
+		Password string `json:"password" validate:"required,xUserPassword"`
+	}
+	// userEmailVerifyConfirmParams 确认验证邮箱参数
+	userEmailVerifyConfirmParams struct {
+		Token string `json:"token" validate:"required,xUserToken"`
+	}
+	// userLoginConfirmParams 确认风险登录参数
+	userLoginConfirmParams struct {
+		Token string `json:"token" validate:"required,xUserToken"`
+	}
+	// emailVerifyTokenData 验证邮箱令牌对应的数据，邮箱修改后令牌失效
+	emailVerifyTokenData struct {
+		Account string `json:"account"`
+		Email   string `json:"email"`
 	}
 	// userUpdateParams 更新用户信息参数
 	userUpdateParams struct {
-		Roles  []string      `json:"roles" validate:"omitempty"`
+		Roles  []string      `json:"roles" validate:"omitempty,dive,xUserRole"`
+		Groups []string      `json:"groups" validate:"omitempty,dive,xUserGroup"`
 		Status schema.Status `json:"status" validate:"omitempty,xStatus"`
 	}
 	// userActionAddParams 用户添加行为记录的参数
@@ -153,12 +203,30 @@ type (
 var (
 	// session配置信息
 	sessionConfig config.SessionConfig
+	// 账户相关配置
+	accountConfig = config.GetAccountConfig()
 )
 
 const (
 	errUserCategory = "user"
 )
 
+// errAccountOrPasswordInvalid 账户或密码错误，登录防护仅对此错误记录失败次数
+var errAccountOrPasswordInvalid = hes.New("账户或者密码错误", errUserCategory)
+
+// errUserLoginForbidden 账户已禁用或已注销，不允许登录
+var errUserLoginForbidden = hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+
+var errLoginRiskStepUp = hes.NewWithStatusCode("本次登录存在风险，账户未验证邮箱且未启用两步验证，请联系管理员", http.StatusForbidden, errUserCategory)
+
+// loginRiskReasonNames 登录风险原因的描述
+var loginRiskReasonNames = map[string]string{
+	service.LoginRiskNewCountry:       "首次在该国家登录",
+	service.LoginRiskNewDevice:        "首次使用该设备登录",
+	service.LoginRiskImpossibleTravel: "短时间内在不同国家登录",
+	service.LoginRiskSharedIP:         "该IP登录了多个账户",
+}
+
 func init() {
 	sessionConfig = config.GetSessionConfig()
 	prefix := "/users"
@@ -170,14 +238,14 @@ func init() {
 	// 获取用户列表
 	g.GET(
 		"/v1",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.list,
 	)
 
 	// 获取用户信息
 	g.GET(
 		"/v1/{id}",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.findByID,
 	)
 
@@ -185,7 +253,7 @@ func init() {
 	g.PATCH(
 		"/v1/{id}",
 		newTrackerMiddleware(cs.ActionUserInfoUpdate),
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserUpdate),
 		ctrl.updateByID,
 	)
 
@@ -236,17 +304,25 @@ func init() {
 		}, 3*time.Second, cs.ActionLogin),
 		// 限制相同IP在60秒之内只能调用10次
 		newIPLimit(10, 60*time.Second, cs.ActionLogin),
-		// 限制10分钟内，相同的账号只允许出错5次
-		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
-			return gjson.GetBytes(c.RequestBody, "account").String()
-		}),
+		// 按账户、IP与网段限制登录失败，失败较多则需要等待或临时锁定
+		loginDefense,
 		ctrl.login,
 	)
+	// 确认风险较高的登录，需使用发起登录的session
+	g.POST(
+		"/v1/me/login/confirmation",
+		newTrackerMiddleware(cs.ActionLoginConfirm),
+		shouldBeAnonymous,
+		// 限制相同IP在10分钟之内只能调用10次
+		newIPLimit(10, 10*time.Minute, cs.ActionLoginConfirm),
+		ctrl.confirmLogin,
+	)
 	// 内部登录
 	g.POST(
 		"/inner/v1/me/login",
 		newTrackerMiddleware(cs.ActionLogin),
 		captchaValidate,
+		loginDefense,
 		ctrl.login,
 	)
 
@@ -258,6 +334,63 @@ func init() {
 		ctrl.updateMe,
 	)
 
+	// 修改密码
+	g.PATCH(
+		"/v1/me/password",
+		newTrackerMiddleware(cs.ActionUserPasswordChange),
+		shouldBeLogin,
+		shouldNotImpersonate,
+		// 限制10分钟内，相同的账号只允许出错5次
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return cs.ActionUserPasswordChange + "-" + getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.changePassword,
+	)
+
+	// 申请重置密码
+	g.POST(
+		"/v1/password-reset",
+		newTrackerMiddleware(cs.ActionPasswordResetRequest),
+		captchaValidate,
+		shouldBeAnonymous,
+		// 同一个账号限制60秒只能申请一次
+		newConcurrentLimit([]string{
+			"account",
+		}, 60*time.Second, cs.ActionPasswordResetRequest),
+		// 限制相同IP在10分钟之内只能调用5次
+		newIPLimit(5, 10*time.Minute, cs.ActionPasswordResetRequest),
+		ctrl.requestPasswordReset,
+	)
+	// 确认重置密码
+	g.POST(
+		"/v1/password-reset/confirm",
+		newTrackerMiddleware(cs.ActionPasswordResetConfirm),
+		shouldBeAnonymous,
+		// 限制相同IP在10分钟之内只能调用10次
+		newIPLimit(10, 10*time.Minute, cs.ActionPasswordResetConfirm),
+		ctrl.confirmPasswordReset,
+	)
+
+	// 发送验证邮件
+	g.POST(
+		"/v1/me/email-verification",
+		newTrackerMiddleware(cs.ActionEmailVerifySend),
+		shouldBeLogin,
+		// 相同账号在间隔时间内只允许发送一次
+		newCooldownLimit(accountConfig.EmailVerifyInterval, cs.ActionEmailVerifySend, func(c *elton.Context) string {
+			return getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.sendEmailVerification,
+	)
+	// 确认验证邮箱，通过邮件中的链接访问，因此不要求登录
+	g.POST(
+		"/v1/email-verification/confirm",
+		newTrackerMiddleware(cs.ActionEmailVerifyConfirm),
+		// 限制相同IP在10分钟之内只能调用10次
+		newIPLimit(10, 10*time.Minute, cs.ActionEmailVerifyConfirm),
+		ctrl.confirmEmailVerification,
+	)
+
 	// 用户退出登录
 	g.DELETE(
 		"/v1/me",
@@ -269,7 +402,7 @@ func init() {
 	// 获取客户登录记录
 	g.GET(
 		"/v1/login-records",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.listLoginRecord,
 	)
 
@@ -311,18 +444,115 @@ func (params *userRegisterLoginParams) save(ctx context.Context) (*ent.User, err
 	if err != nil {
 		return nil, err
 	}
+	password, verifier, err := hashUserPassword(params.Password)
+	if err != nil {
+		return nil, err
+	}
 	return getEntClient().User.Create().
 		SetAccount(params.Account).
-		SetPassword(params.Password).
+		SetPassword(password).
+		SetPasswordVerifier(verifier).
 		Save(ctx)
 }
 
+// hashUserPassword hash密码并生成登录挑战使用的校验数据
+func hashUserPassword(password string) (hash, verifier string, err error) {
+	hash, err = util.HashPassword(password)
+	if err != nil {
+		return
+	}
+	v, err := util.NewPasswordVerifier(password)
+	if err != nil {
+		return
+	}
+	verifier = v.String()
+	return
+}
+
+// verifyUserPassword 校验用户密码（客户端hash后的密码），用于修改密码等已登录的操作。
+// 旧版本未hash的密码需要先登录升级后才可校验
+func verifyUserPassword(u *ent.User, password string) (bool, error) {
+	if !util.IsPasswordHashed(u.Password) {
+		return false, nil
+	}
+	return util.VerifyPassword(u.Password, password)
+}
+
+// getUserPasswordVerifierSalt 获取账户固定的salt，用于账户不存在或旧版本未hash密码的挑战
+func getUserPasswordVerifierSalt(account string) []byte {
+	return util.GetPasswordVerifierSalt(strings.Join(sessionConfig.Keys, ","), account)
+}
+
+// getUserLoginChallenge 获取账户的登录挑战信息，账户不存在或未生成校验数据时返回固定的挑战信息，
+// 各种情况的响应格式一致，避免账户被枚举
+func getUserLoginChallenge(ctx context.Context, account string) (salt []byte, params util.PasswordVerifierParams, err error) {
+	salt = getUserPasswordVerifierSalt(account)
+	params = util.GetPasswordVerifierParams()
+	u, err := getEntClient().User.Query().
+		Where(user.Account(account)).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = nil
+		}
+		return
+	}
+	v, e := util.ParsePasswordVerifier(u.PasswordVerifier)
+	if e != nil {
+		return
+	}
+	salt = v.Salt
+	params = v.PasswordVerifierParams
+	return
+}
+
+// updateUserPassword 更新用户的密码hash与校验数据，用于登录时升级，出错只记录日志
+func updateUserPassword(ctx context.Context, u *ent.User, password string) {
+	hash, verifier, err := hashUserPassword(password)
+	if err == nil {
+		_, err = u.Update().
+			SetPassword(hash).
+			SetPasswordVerifier(verifier).
+			Save(ctx)
+	}
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Str("account", u.Account).
+			Msg("upgrade user password fail")
+	}
+}
+
+// verifyUserLoginProof 校验登录的proof，proof基于一次性的登录令牌生成，无法重放。
+// 旧版本保存的即为客户端hash后的密码，以固定的salt生成校验数据后校验proof，成功后升级；
+// 已hash但无有效校验数据的账户无法校验，需要重置密码
+func verifyUserLoginProof(ctx context.Context, u *ent.User, token, password string) (valid bool, err error) {
+	authMessage := u.Account + "," + token
+	proof, e := base64.StdEncoding.DecodeString(password)
+	if e != nil {
+		return
+	}
+	v, e := util.ParsePasswordVerifier(u.PasswordVerifier)
+	if e == nil {
+		valid = v.Verify(authMessage, proof)
+		return
+	}
+	if util.IsPasswordHashed(u.Password) {
+		return
+	}
+	v = util.NewPasswordVerifierWithSalt(u.Password, getUserPasswordVerifierSalt(u.Account), util.GetPasswordVerifierParams())
+	valid = v.Verify(authMessage, proof)
+	if valid {
+		updateUserPassword(ctx, u, u.Password)
+	}
+	return
+}
+
 // login 登录
 func (params *userRegisterLoginParams) login(ctx context.Context, token string) (u *ent.User, err error) {
 	u, err = getEntClient().User.Query().
 		Where(user.Account(params.Account)).
 		First(ctx)
-	errAccountOrPasswordInvalid := hes.New("账户或者密码错误", errUserCategory)
 	if err != nil {
 		// 如果登录时账号不存在
 		if ent.IsNotFound(err) {
@@ -330,20 +560,205 @@ func (params *userRegisterLoginParams) login(ctx context.Context, token string)
 		}
 		return
 	}
-	pwd := util.Sha256(u.Password + token)
 	// 用于自动化测试使用
-	if util.IsDevelopment() && params.Password == "fEqNCco3Yq9h5ZUglD3CZJT4lBsfEqNCco31Yq9h5ZUB" {
-		pwd = params.Password
+	magicPassword := util.IsDevelopment() && params.Password == "fEqNCco3Yq9h5ZUglD3CZJT4lBsfEqNCco31Yq9h5ZUB"
+	if !magicPassword {
+		valid, e := verifyUserLoginProof(ctx, u, token, params.Password)
+		if e != nil {
+			err = e
+			return
+		}
+		if !valid {
+			err = errAccountOrPasswordInvalid
+			return
+		}
 	}
-	if pwd != params.Password {
-		err = errAccountOrPasswordInvalid
+	// 禁止非正常状态用户登录
+	if !isUserLoginAllowed(u) {
+		err = errUserLoginForbidden
 		return
 	}
-	// 禁止非正常状态用户登录
-	if u.Status != schema.StatusEnabled {
-		err = hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+	return
+}
+
+// changePassword 校验旧密码后修改密码
+func (params *userChangePasswordParams) changePassword(ctx context.Context, account string) (err error) {
+	u, err := getEntClient().User.Query().
+		Where(user.Account(account)).
+		First(ctx)
+	if err != nil {
+		return
+	}
+	valid, err := verifyUserPassword(u, params.Password)
+	if err != nil {
+		return
+	}
+	if !valid {
+		err = hes.New("旧密码错误，请重新输入", errUserCategory)
+		return
+	}
+	hash, verifier, err := hashUserPassword(params.NewPassword)
+	if err != nil {
+		return
+	}
+	_, err = u.Update().
+		SetPassword(hash).
+		SetPasswordVerifier(verifier).
+		ClearPasswordResetRequiredAt().
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	return service.RevokeUserSessions(ctx, account)
+}
+
+// sendPasswordResetMail 发送重置密码邮件，账户不存在、未设置邮箱或已禁用则忽略
+func (params *userPasswordResetParams) sendPasswordResetMail(ctx context.Context) (err error) {
+	u, err := getEntClient().User.Query().
+		Where(user.Account(params.Account)).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = nil
+		}
+		return
+	}
+	if u.Email == "" || u.Status != schema.StatusEnabled {
 		return
 	}
+	token, err := service.CreateUserToken(ctx, service.UserTokenPasswordReset, u.Account, accountConfig.PasswordResetTTL)
+	if err != nil {
+		return
+	}
+	app := config.GetBasicConfig().Name
+	return service.SendTemplateMail([]string{u.Email}, app+"-重置密码", service.MailTemplatePasswordReset, map[string]string{
+		"App":     app,
+		"Account": u.Account,
+		"URL":     strings.ReplaceAll(accountConfig.PasswordResetURL, "{token}", token),
+		"TTL":     fmt.Sprintf("%d分钟", int(accountConfig.PasswordResetTTL.Minutes())),
+	})
+}
+
+// resetPassword 使用令牌重置密码，成功后该账户所有的session失效
+func (params *userPasswordResetConfirmParams) resetPassword(ctx context.Context) (err error) {
+	account, err := service.ConsumeUserToken(ctx, service.UserTokenPasswordReset, params.Token)
+	if err != nil {
+		return
+	}
+	u, err := getUserByAccount(ctx, account)
+	if err != nil {
+		return
+	}
+	hash, verifier, err := hashUserPassword(params.Password)
+	if err != nil {
+		return
+	}
+	_, err = u.Update().
+		SetPassword(hash).
+		SetPasswordVerifier(verifier).
+		ClearPasswordResetRequiredAt().
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	return service.RevokeUserSessions(ctx, account)
+}
+
+// sendEmailVerifyMail 发送验证邮箱邮件
+func sendEmailVerifyMail(ctx context.Context, account string) (err error) {
+	u, err := getEntClient().User.Query().
+		Where(user.Account(account)).
+		First(ctx)
+	if err != nil {
+		return
+	}
+	if u.Email == "" {
+		err = hes.New("请先设置邮箱", errUserCategory)
+		return
+	}
+	if u.EmailVerifiedAt != nil {
+		err = hes.New("邮箱已验证，无需重复验证", errUserCategory)
+		return
+	}
+	buf, err := json.Marshal(&emailVerifyTokenData{
+		Account: u.Account,
+		Email:   u.Email,
+	})
+	if err != nil {
+		return
+	}
+	token, err := service.CreateUserToken(ctx, service.UserTokenEmailVerify, string(buf), accountConfig.EmailVerifyTTL)
+	if err != nil {
+		return
+	}
+	app := config.GetBasicConfig().Name
+	return service.SendTemplateMail([]string{u.Email}, app+"-验证邮箱", service.MailTemplateEmailVerify, map[string]string{
+		"App":     app,
+		"Account": u.Account,
+		"URL":     strings.ReplaceAll(accountConfig.EmailVerifyURL, "{token}", token),
+		"TTL":     fmt.Sprintf("%d小时", int(accountConfig.EmailVerifyTTL.Hours())),
+	})
+}
+
+// verifyEmail 使用令牌验证邮箱，令牌生成后邮箱已修改则验证失败
+func (params *userEmailVerifyConfirmParams) verifyEmail(ctx context.Context) (err error) {
+	value, err := service.ConsumeUserToken(ctx, service.UserTokenEmailVerify, params.Token)
+	if err != nil {
+		return
+	}
+	data := emailVerifyTokenData{}
+	err = json.Unmarshal([]byte(value), &data)
+	if err != nil {
+		return
+	}
+	u, err := getUserByAccount(ctx, data.Account)
+	if err != nil {
+		return
+	}
+	updated, err := updateUserIf(ctx, u.ID, []predicate.User{
+		user.Email(data.Email),
+	}, func(updateOne *ent.UserUpdateOne) *ent.UserUpdateOne {
+		return updateOne.SetEmailVerifiedAt(time.Now())
+	})
+	if err != nil {
+		return
+	}
+	if !updated {
+		err = hes.New("邮箱已修改，请重新验证", errUserCategory)
+		return
+	}
+	return
+}
+
+// updateUserIf 用户记录满足条件时才更新，返回是否已更新。
+// 先在事务中以批量更新锁定记录（仅更新updated_at，不记录审计日志），
+// 再通过UpdateOne更新，使审计日志可记录用户ID与变更前的数据
+func updateUserIf(ctx context.Context, id int, ps []predicate.User, fn func(*ent.UserUpdateOne) *ent.UserUpdateOne) (updated bool, err error) {
+	tx, err := getEntClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	count, err := tx.User.Update().
+		Where(append(ps, user.ID(id))...).
+		Save(ctx)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if count == 0 {
+		err = tx.Rollback()
+		return
+	}
+	_, err = fn(tx.User.UpdateOneID(id)).Save(ctx)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	updated = true
 	return
 }
 
@@ -356,32 +771,49 @@ func (params *userUpdateMeParams) updateOneAccount(ctx context.Context, account
 	if err != nil {
 		return
 	}
-	// 更新密码时需要先校验旧密码
-	if params.NewPassword != "" {
-		if u.Password != params.Password {
-			err = hes.New("旧密码错误，请重新输入", errUserCategory)
-			return
-		}
-	}
 	updateOne := u.Update()
 	if params.Name != "" {
 		updateOne = updateOne.SetName(params.Name)
 	}
-	if params.Email != "" {
-		updateOne = updateOne.SetEmail(params.Email)
+	// 修改邮箱后需要重新验证
+	if params.Email != "" && params.Email != u.Email {
+		updateOne = updateOne.SetEmail(params.Email).
+			ClearEmailVerifiedAt()
 	}
-	if params.NewPassword != "" {
-		updateOne = updateOne.SetPassword(params.NewPassword)
+	if params.Bio != nil {
+		updateOne = updateOne.SetBio(*params.Bio)
+	}
+	if params.Privacy != nil {
+		updateOne = updateOne.SetPrivacy(params.Privacy)
 	}
 	return updateOne.Save(ctx)
 }
 
-// updateByID 通过ID更新信息
-func (params *userUpdateParams) updateByID(ctx context.Context, id int) (u *ent.User, err error) {
+// updateByID 通过ID更新信息，操作者需可管理该用户且仅可授予自身已拥有的角色与分组
+func (params *userUpdateParams) updateByID(ctx context.Context, operator session.UserInfo, id int) (u *ent.User, err error) {
+	u, err = getEntClient().User.Get(ctx, id)
+	if err != nil {
+		return
+	}
+	err = validateUserManageable(ctx, operator, u)
+	if err != nil {
+		return
+	}
+	err = validateRoles(ctx, params.Roles)
+	if err != nil {
+		return
+	}
+	err = validateUserGrant(operator, params.Roles, params.Groups)
+	if err != nil {
+		return
+	}
 	updateOne := getEntClient().User.UpdateOneID(id)
 	if len(params.Roles) != 0 {
 		updateOne = updateOne.SetRoles(params.Roles)
 	}
+	if len(params.Groups) != 0 {
+		updateOne = updateOne.SetGroups(params.Groups)
+	}
 	if params.Status != 0 {
 		updateOne = updateOne.SetStatus(params.Status)
 	}
@@ -403,6 +835,12 @@ func (params *userListParams) where(query *ent.UserQuery) *ent.UserQuery {
 		v, _ := strconv.Atoi(params.Status)
 		query = query.Where(user.Status(schema.Status(v)))
 	}
+	switch params.EmailVerified {
+	case "true":
+		query = query.Where(user.EmailVerifiedAtNotNil())
+	case "false":
+		query = query.Where(user.EmailVerifiedAtIsNil())
+	}
 	return query
 }
 
@@ -525,10 +963,24 @@ func (ctrl *userCtrl) updateByID(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
-	user, err := params.updateByID(c.Context(), id)
+	user, err := params.updateByID(c.Context(), getUserSession(c).MustGetInfo(), id)
 	if err != nil {
 		return
 	}
+	// 禁用账户时立即退出其所有设备的登录
+	if params.Status == schema.StatusDisabled {
+		err = service.DestroyUserSessions(c.Context(), user.Account)
+		if err != nil {
+			return
+		}
+	}
+	// 角色或分组变化时更新权限版本，已登录的session重新获取权限
+	if len(params.Roles) != 0 || len(params.Groups) != 0 {
+		err = service.UpdateRBACVersion(c.Context())
+		if err != nil {
+			return
+		}
+	}
 	c.Body = user
 	return
 }
@@ -536,11 +988,21 @@ func (ctrl *userCtrl) updateByID(c *elton.Context) (err error) {
 // swagger:route GET /users/v1/me/login users userLoginToken
 // 获取登录的token
 //
-// 在登录之前需要先调用获取token，此token用于登录时与客户密码sha256生成hash，
-// 保证客户每次登录时的密码均不相同，避免接口重放登录。
+// 在登录之前需要先调用获取token，此token为一次性的登录令牌，
+// 每次登录（无论成功失败）均会清除，避免接口重放登录。
+// 同时返回账户的salt与argon2id参数，客户端根据密码与token生成登录的proof。
 // Responses:
 // 	200: apiUserLoginTokenResponse
 func (*userCtrl) getLoginToken(c *elton.Context) (err error) {
+	params := userLoginTokenParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	salt, verifierParams, err := getUserLoginChallenge(c.Context(), params.Account)
+	if err != nil {
+		return
+	}
 	us := getUserSession(c)
 	// 清除当前session id，确保每次登录的用户都是新的session
 	err = us.Destroy()
@@ -555,7 +1017,9 @@ func (*userCtrl) getLoginToken(c *elton.Context) (err error) {
 		return
 	}
 	c.Body = &userLoginTokenResp{
-		Token: userInfo.Token,
+		Token:                  userInfo.Token,
+		Salt:                   base64.StdEncoding.EncodeToString(salt),
+		PasswordVerifierParams: verifierParams,
 	}
 	return
 }
@@ -656,8 +1120,11 @@ func (*userCtrl) register(c *elton.Context) (err error) {
 // swagger:route POST /users/v1/me/login users userLogin
 // 用户登录
 //
-// 用户登录时需要先获取token，之后使用token与密码sha256后提交，
-// 登录成功后返回用户信息。
+// 用户登录时需要先获取token与salt，之后提交根据密码与token生成的proof，
+// 服务端仅保存校验数据，无需保存可重放的密码，旧版本的密码在登录成功时自动升级，
+// 登录成功后返回用户信息，若已启用两步验证则返回twoFactorPending，需再提交验证码完成登录。
+// 登录时会与历史登录记录对比计算风险分值，风险较高时邮件通知用户，
+// 风险过高且未完成两步验证时发送确认邮件并返回loginConfirmPending，需通过邮件中的链接确认后完成登录。
 // Responses:
 // 	200: apiUserInfoResponse
 func (*userCtrl) login(c *elton.Context) (err error) {
@@ -676,30 +1143,203 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 		err = hes.New("登录令牌不能为空", errUserCategory)
 		return
 	}
+	// 登录令牌仅可使用一次，无论成功失败均清除，避免请求重放
+	err = us.SetInfo(session.UserInfo{})
+	if err != nil {
+		return
+	}
 	// 登录
 	u, err := params.login(c.Context(), userInfo.Token)
 	if err != nil {
 		return
 	}
-	account := u.Account
+	// 已启用两步验证，需要校验验证码后才完成登录
+	if u.TotpEnabledAt != nil {
+		err = us.SetInfo(session.UserInfo{
+			TwoFactorPending: u.Account,
+		})
+		if err != nil {
+			return
+		}
+		resp, e := pickUserInfo(c)
+		if e != nil {
+			return e
+		}
+		c.Body = &resp
+		return
+	}
+	return loginSuccess(c, u, false)
+}
 
-	// 设置session
-	err = us.SetInfo(session.UserInfo{
-		Account: account,
-		ID:      u.ID,
-		Roles:   u.Roles,
-		// Groups: u.,
-	})
+// confirmLogin 使用邮件中的令牌确认风险较高的登录
+func (*userCtrl) confirmLogin(c *elton.Context) (err error) {
+	params := userLoginConfirmParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info, err := us.GetInfo()
 	if err != nil {
 		return
 	}
+	errPendingInvalid := hes.New("请使用发起登录的浏览器确认登录", errUserCategory)
+	if info.LoginConfirmPending == "" {
+		err = errPendingInvalid
+		return
+	}
+	account, err := service.ConsumeUserToken(c.Context(), service.UserTokenLoginConfirm, params.Token)
+	if err != nil {
+		return
+	}
+	if account != info.LoginConfirmPending {
+		err = errPendingInvalid
+		return
+	}
+	u, err := getUserByAccount(c.Context(), account)
+	if err != nil {
+		return
+	}
+	c.Set(cs.LoginConfirmed, true)
+	return loginSuccess(c, u, false)
+}
+
+// sendLoginConfirmMail 发送确认风险登录的邮件
+func sendLoginConfirmMail(ctx context.Context, u *ent.User, ip, userAgent string, lo location.Location, risk *service.LoginRisk) (err error) {
+	token, err := service.CreateUserToken(ctx, service.UserTokenLoginConfirm, u.Account, accountConfig.LoginConfirmTTL)
+	if err != nil {
+		return
+	}
+	data := newLoginRiskMailData(u, ip, userAgent, lo, risk)
+	data["URL"] = strings.ReplaceAll(accountConfig.LoginConfirmURL, "{token}", token)
+	data["TTL"] = fmt.Sprintf("%d分钟", int(accountConfig.LoginConfirmTTL.Minutes()))
+	return service.SendTemplateMail([]string{u.Email}, data["App"]+"-确认登录", service.MailTemplateLoginConfirm, data)
+}
+
+// newLoginRiskMailData 生成风险登录相关邮件的模板数据
+func newLoginRiskMailData(u *ent.User, ip, userAgent string, lo location.Location, risk *service.LoginRisk) map[string]string {
+	reasons := make([]string, len(risk.Reasons))
+	for index, reason := range risk.Reasons {
+		reasons[index] = loginRiskReasonNames[reason]
+	}
+	locations := make([]string, 0)
+	for _, value := range []string{lo.Country, lo.Province, lo.City} {
+		if value != "" {
+			locations = append(locations, value)
+		}
+	}
+	return map[string]string{
+		"App":       config.GetBasicConfig().Name,
+		"Account":   u.Account,
+		"Time":      time.Now().Format("2006-01-02 15:04:05"),
+		"IP":        ip,
+		"Location":  strings.Join(locations, " "),
+		"UserAgent": userAgent,
+		"Reasons":   strings.Join(reasons, "，"),
+	}
+}
+
+// sendLoginRiskMail 发送异常登录提醒邮件
+func sendLoginRiskMail(u *ent.User, ip, userAgent string, lo location.Location, risk *service.LoginRisk) error {
+	data := newLoginRiskMailData(u, ip, userAgent, lo, risk)
+	return service.SendTemplateMail([]string{u.Email}, data["App"]+"-异常登录提醒", service.MailTemplateLoginRisk, data)
+}
+
+// isUserLoginAllowed 判断账户是否允许登录（已启用且未注销）
+func isUserLoginAllowed(u *ent.User) bool {
+	return u.Status == schema.StatusEnabled && u.DeletedAt == nil
+}
+
+// loginSuccess 登录成功，设置session并记录登录信息，
+// 两步验证、邮件确认等流程完成时账户状态可能已变更，因此再次校验账户状态
+func loginSuccess(c *elton.Context, u *ent.User, twoFactorVerified bool) (err error) {
+	if !isUserLoginAllowed(u) {
+		err = errUserLoginForbidden
+		return
+	}
+	us := getUserSession(c)
+	account := u.Account
 
+	info := session.UserInfo{
+		Account:           account,
+		ID:                u.ID,
+		TwoFactorVerified: twoFactorVerified,
+		// 管理员要求修改密码，登录后需先修改密码
+		PasswordResetRequired: u.PasswordResetRequiredAt != nil,
+	}
+	err = fillUserPermissions(c.Context(), &info, u)
+	if err != nil {
+		return
+	}
 	ip := c.RealIP()
 	tid := util.GetTrackID(c)
 	sid := util.GetSessionID(c)
 	userAgent := c.GetRequestHeader("User-Agent")
-
 	xForwardedFor := c.GetRequestHeader("X-Forwarded-For")
+
+	lo, _ := location.GetByIP(c.Context(), ip)
+	risk, err := service.EvaluateLoginRisk(c.Context(), service.LoginRiskParams{
+		Account:   account,
+		IP:        ip,
+		UserAgent: userAgent,
+		Country:   lo.Country,
+		LoginAt:   time.Now(),
+	})
+	// 风险检测失败不影响登录
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Str("account", account).
+			Msg("evaluate login risk fail")
+		risk = &service.LoginRisk{}
+		err = nil
+	}
+	// 风险较高的登录需要已完成两步验证或邮件确认，
+	// 已启用两步验证的账户在此之前已要求提交验证码
+	if risk.ShouldStepUp() && !twoFactorVerified && !c.GetBool(cs.LoginConfirmed) {
+		if u.Email == "" || u.EmailVerifiedAt == nil {
+			err = errLoginRiskStepUp
+			return
+		}
+		err = sendLoginConfirmMail(c.Context(), u, ip, userAgent, lo, risk)
+		if err != nil {
+			return
+		}
+		err = us.SetInfo(session.UserInfo{
+			LoginConfirmPending: account,
+		})
+		if err != nil {
+			return
+		}
+		resp, e := pickUserInfo(c)
+		if e != nil {
+			return e
+		}
+		c.Body = &resp
+		return
+	}
+
+	// 注销宽限期内登录则取消注销
+	if u.DeletionRequestedAt != nil {
+		_, err = u.Update().
+			ClearDeletionRequestedAt().
+			Save(c.Context())
+		if err != nil {
+			return
+		}
+	}
+
+	// 设置session
+	err = us.SetInfo(info)
+	if err != nil {
+		return
+	}
+	// 添加至账户的session索引
+	err = service.UpdateUserSessionActive(c.Context(), account, us.ID())
+	if err != nil {
+		return
+	}
+
 	tracerInfo := tracer.GetTracerInfo()
 	go func() {
 		tracer.SetTracerInfo(tracerInfo)
@@ -710,16 +1350,15 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 			cs.FieldTID:       tid,
 			cs.FieldSID:       sid,
 		}
-		location, _ := location.GetByIP(context.Background(), ip)
 		country := ""
 		province := ""
 		city := ""
 		isp := ""
-		if location.IP != "" {
-			country = location.Country
-			province = location.Province
-			city = location.City
-			isp = location.ISP
+		if lo.IP != "" {
+			country = lo.Country
+			province = lo.Province
+			city = lo.City
+			isp = lo.ISP
 			fields[cs.FieldCountry] = country
 			fields[cs.FieldProvince] = province
 			fields[cs.FieldCity] = city
@@ -739,6 +1378,8 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 			SetProvince(province).
 			SetCity(city).
 			SetIsp(isp).
+			SetRiskScore(risk.Score).
+			SetRiskReasons(risk.Reasons).
 			Save(ctx)
 		if err != nil {
 			log.Default().Error().
@@ -747,6 +1388,15 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 		}
 		// 记录用户登录行为
 		GetInfluxSrv().Write(cs.MeasurementUserLogin, nil, fields)
+		if risk.ShouldNotify() && u.Email != "" && u.EmailVerifiedAt != nil {
+			err = sendLoginRiskMail(u, ip, userAgent, lo, risk)
+			if err != nil {
+				log.Default().Error().
+					Err(err).
+					Str("account", account).
+					Msg("send login risk mail fail")
+			}
+		}
 	}()
 
 	// 返回用户信息
@@ -754,10 +1404,111 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	// 非浏览器客户端使用访问令牌认证
+	if c.GetRequestHeader(cs.HeaderAuthType) == cs.AuthTypeToken {
+		// 登录前需要先获取登录令牌，因此session id已生成
+		if us.ID() == "" {
+			err = hes.New("登录令牌不能为空", errUserCategory)
+			return
+		}
+		resp.Tokens, err = service.CreateAuthTokens(us.ID(), account)
+		if err != nil {
+			return
+		}
+		c.NoStore()
+	}
 	c.Body = &resp
 	return
 }
 
+// changePassword 修改密码，成功后需要重新登录
+func (*userCtrl) changePassword(c *elton.Context) (err error) {
+	params := userChangePasswordParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	if params.Password == params.NewPassword {
+		err = hes.New("新密码不能与旧密码相同", errUserCategory)
+		return
+	}
+	us := getUserSession(c)
+	// 修改成功后该账户所有的session失效
+	err = params.changePassword(c.Context(), us.MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	err = us.Destroy()
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// requestPasswordReset 申请重置密码，无论账户是否存在均返回成功，避免账户被枚举
+func (*userCtrl) requestPasswordReset(c *elton.Context) (err error) {
+	params := userPasswordResetParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	// 邮件异步发送，避免根据响应时长判断账户是否存在
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		e := params.sendPasswordResetMail(ctx)
+		if e != nil {
+			log.Default().Error().
+				Err(e).
+				Str("account", params.Account).
+				Msg("send password reset mail fail")
+		}
+	}()
+	c.NoContent()
+	return
+}
+
+// confirmPasswordReset 确认重置密码
+func (*userCtrl) confirmPasswordReset(c *elton.Context) (err error) {
+	params := userPasswordResetConfirmParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = params.resetPassword(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// sendEmailVerification 发送验证邮件
+func (*userCtrl) sendEmailVerification(c *elton.Context) (err error) {
+	err = sendEmailVerifyMail(c.Context(), getUserSession(c).MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// confirmEmailVerification 确认验证邮箱
+func (*userCtrl) confirmEmailVerification(c *elton.Context) (err error) {
+	params := userEmailVerifyConfirmParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	err = params.verifyEmail(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
 // swagger:route DELETE /users/v1/me users userLogout
 // 用户退出登录
 //
@@ -766,6 +1517,17 @@ func (*userCtrl) login(c *elton.Context) (err error) {
 // 	204: apiNoContentResponse
 func (*userCtrl) logout(c *elton.Context) (err error) {
 	us := getUserSession(c)
+	err = service.RemoveUserSession(c.Context(), us.MustGetInfo().Account, us.ID())
+	if err != nil {
+		return
+	}
+	// 使用访问令牌认证时，吊销该令牌
+	if value, ok := c.Get(cs.AuthTokenClaims); ok {
+		err = service.RevokeAuthToken(c.Context(), value.(*service.AuthTokenClaims))
+		if err != nil {
+			return
+		}
+	}
 	// 清除session
 	err = us.Destroy()
 	if err != nil {
@@ -820,6 +1582,11 @@ func (ctrl *userCtrl) updateMe(c *elton.Context) (err error) {
 	if err != nil {
 		return
 	}
+	// 邮箱可用于重置密码，模拟登录时不可修改
+	if params.Email != "" && isImpersonating(c) {
+		err = errImpersonatingForbidden
+		return
+	}
 
 	// 更新用户信息
 	_, err = params.updateOneAccount(c.Context(), us.MustGetInfo().Account)
@@ -832,9 +1599,26 @@ func (ctrl *userCtrl) updateMe(c *elton.Context) (err error) {
 
 // getRoleList 获取用户角色列表
 func (*userCtrl) getRoleList(c *elton.Context) (err error) {
+	roles, err := getEntClient().Role.Query().
+		Order(ent.Asc(role.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	userRoles := make([]*schema.UserRoleInfo, len(roles))
+	for index, item := range roles {
+		name := item.Description
+		if name == "" {
+			name = item.Name
+		}
+		userRoles[index] = &schema.UserRoleInfo{
+			Name:  name,
+			Value: item.Name,
+		}
+	}
 	c.CacheMaxAge(time.Minute)
 	c.Body = &userRoleListResp{
-		UserRoles: schema.GetUserRoleList(),
+		UserRoles: userRoles,
 	}
 	return
 }
@@ -0,0 +1,399 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 管理员的用户管理，包括创建用户、要求修改密码以及模拟用户登录
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/session"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type userAdminCtrl struct{}
+
+const (
+	// errCodePasswordResetRequired 需要先修改密码的出错码
+	errCodePasswordResetRequired = "passwordResetRequired"
+)
+
+// passwordResetAllowedRoutes 要求修改密码时允许访问的路由
+var passwordResetAllowedRoutes = []string{
+	// 修改密码
+	"/users/v1/me/password",
+	// 获取信息及退出登录
+	"/users/v1/me",
+}
+
+// 接口参数定义
+type (
+	// userAddParams 管理员创建用户参数
+	userAddParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+		// 初始密码，客户端hash后的密码，用户登录后需要修改
+		Password string   `json:"password" validate:"required,xUserPassword"`
+		Name     string   `json:"name" validate:"omitempty,xUserName"`
+		Email    string   `json:"email" validate:"omitempty,xUserEmail"`
+		Roles    []string `json:"roles" validate:"omitempty,dive,xUserRole"`
+		Groups   []string `json:"groups" validate:"omitempty,dive,xUserGroup"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+
+	ctrl := userAdminCtrl{}
+
+	// 创建用户
+	g.POST(
+		"/v1",
+		newTrackerMiddleware(cs.ActionAdminUserAdd),
+		requirePermission(schema.PermissionUserCreate),
+		ctrl.add,
+	)
+	// 要求用户在下次登录时修改密码
+	g.POST(
+		"/v1/{id}/password-reset",
+		newTrackerMiddleware(cs.ActionAdminUserPasswordReset),
+		requirePermission(schema.PermissionUserUpdate),
+		ctrl.requirePasswordReset,
+	)
+	// 模拟用户登录
+	g.POST(
+		"/v1/{id}/impersonation",
+		newTrackerMiddleware(cs.ActionAdminImpersonateStart),
+		requirePermission(schema.PermissionUserImpersonate),
+		ctrl.startImpersonation,
+	)
+	// 结束模拟登录
+	g.DELETE(
+		"/v1/me/impersonation",
+		newTrackerMiddleware(cs.ActionAdminImpersonateStop),
+		shouldBeLogin,
+		ctrl.stopImpersonation,
+	)
+}
+
+// checkPasswordResetRequired 判断是否需要先修改密码，需要时仅可访问修改密码等路由
+func checkPasswordResetRequired(c *elton.Context, info session.UserInfo) (err error) {
+	if !info.PasswordResetRequired ||
+		util.ContainsString(passwordResetAllowedRoutes, c.Route) {
+		return
+	}
+	he := hes.NewWithStatusCode("请先修改密码", http.StatusForbidden, errUserCategory)
+	he.Code = errCodePasswordResetRequired
+	err = he
+	return
+}
+
+// isSuUser 判断是否超级管理员（包括分组授予的角色）
+func isSuUser(info session.UserInfo) bool {
+	return util.ContainsString(info.Roles, schema.UserRoleSu)
+}
+
+// validateUserGrant 校验操作者可授予的角色与分组，
+// 仅超级管理员可授予su，其它管理员仅可授予自身已拥有的角色（包括分组授予的角色）与分组
+func validateUserGrant(operator session.UserInfo, roles, groups []string) (err error) {
+	if isSuUser(operator) {
+		return
+	}
+	for _, role := range roles {
+		if role == schema.UserRoleSu ||
+			!util.ContainsString(operator.Roles, role) {
+			err = hes.NewWithStatusCode("不可授予自身未拥有的角色："+role, http.StatusForbidden, errUserCategory)
+			return
+		}
+	}
+	for _, group := range groups {
+		if !util.ContainsString(operator.Groups, group) {
+			err = hes.NewWithStatusCode("不可授予自身未加入的分组："+group, http.StatusForbidden, errUserCategory)
+			return
+		}
+	}
+	return
+}
+
+// validateUserManageable 校验操作者可管理该用户，
+// 用户的权限（包括分组授予的权限）需为操作者权限的子集，且仅超级管理员可管理超级管理员
+func validateUserManageable(ctx context.Context, operator session.UserInfo, u *ent.User) (err error) {
+	if isSuUser(operator) {
+		return
+	}
+	roles, permissions, err := service.ResolveUserPermissions(ctx, u.Roles, u.Groups)
+	if err != nil {
+		return
+	}
+	if util.ContainsString(roles, schema.UserRoleSu) {
+		err = hes.NewWithStatusCode("不可操作超级管理员", http.StatusForbidden, errUserCategory)
+		return
+	}
+	for _, item := range permissions {
+		if !util.ContainsString(operator.Permissions, item) {
+			err = hes.NewWithStatusCode("该用户拥有您未拥有的权限，不可操作", http.StatusForbidden, errUserCategory)
+			return
+		}
+	}
+	return
+}
+
+// save 创建用户，用户登录后需要修改密码
+func (params *userAddParams) save(ctx context.Context, operator session.UserInfo) (u *ent.User, err error) {
+	err = (&userRegisterLoginParams{
+		Account: params.Account,
+	}).validateBeforeSave(ctx)
+	if err != nil {
+		return
+	}
+	err = validateRoles(ctx, params.Roles)
+	if err != nil {
+		return
+	}
+	err = validateUserGrant(operator, params.Roles, params.Groups)
+	if err != nil {
+		return
+	}
+	password, verifier, err := hashUserPassword(params.Password)
+	if err != nil {
+		return
+	}
+	create := getEntClient().User.Create().
+		SetAccount(params.Account).
+		SetPassword(password).
+		SetPasswordVerifier(verifier).
+		SetPasswordResetRequiredAt(time.Now())
+	if params.Name != "" {
+		create = create.SetName(params.Name)
+	}
+	if params.Email != "" {
+		create = create.SetEmail(params.Email)
+	}
+	if len(params.Roles) != 0 {
+		create = create.SetRoles(params.Roles)
+	}
+	if len(params.Groups) != 0 {
+		create = create.SetGroups(params.Groups)
+	}
+	return create.Save(ctx)
+}
+
+// add 创建用户
+func (*userAdminCtrl) add(c *elton.Context) (err error) {
+	params := userAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	u, err := params.save(c.Context(), getUserSession(c).MustGetInfo())
+	if err != nil {
+		return
+	}
+	c.Created(u)
+	return
+}
+
+// requirePasswordReset 要求用户修改密码，并使其所有的session失效，仅可操作权限不超过自身的用户
+func (*userAdminCtrl) requirePasswordReset(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	u, err := getEntClient().User.Get(c.Context(), id)
+	if err != nil {
+		return
+	}
+	err = validateUserManageable(c.Context(), getUserSession(c).MustGetInfo(), u)
+	if err != nil {
+		return
+	}
+	u, err = u.Update().
+		SetPasswordResetRequiredAt(time.Now()).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.DestroyUserSessions(c.Context(), u.Account)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// startImpersonation 模拟用户登录，session中的账户替换为该用户，
+// 并记录管理员信息，在结束或超时后恢复为管理员
+func (*userAdminCtrl) startImpersonation(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	// API key使用的是临时session，无法模拟登录
+	if _, ok := c.Get(cs.APIKey); ok {
+		err = hes.NewWithStatusCode("API key不可模拟用户登录", http.StatusForbidden, errUserCategory)
+		return
+	}
+	us := getUserSession(c)
+	info := us.MustGetInfo()
+	if info.IsImpersonating() {
+		err = hes.New("已在模拟登录中，请先结束模拟登录", errUserCategory)
+		return
+	}
+	u, err := getEntClient().User.Get(c.Context(), id)
+	if err != nil {
+		return
+	}
+	if u.ID == info.ID {
+		err = hes.New("不可模拟自己的账户", errUserCategory)
+		return
+	}
+	if u.Status != schema.StatusEnabled || u.DeletedAt != nil {
+		err = hes.New("该账户已禁用或注销，不可模拟登录", errUserCategory)
+		return
+	}
+	now := time.Now()
+	impersonatedInfo := session.UserInfo{
+		Account: u.Account,
+		ID:      u.ID,
+		LoginAt: util.FormatTime(now),
+		Impersonator: &session.Impersonator{
+			Account:           info.Account,
+			ID:                info.ID,
+			TwoFactorVerified: info.TwoFactorVerified,
+			LoginAt:           info.LoginAt,
+			StartedAt:         util.FormatTime(now),
+			ExpiredAt:         util.FormatTime(now.Add(accountConfig.ImpersonationTTL)),
+		},
+	}
+	err = fillUserPermissions(c.Context(), &impersonatedInfo, u)
+	if err != nil {
+		return
+	}
+	// 根据解析后的角色（包括分组授予的角色）判断，
+	// 超级管理员不可被模拟，且用户的权限需为管理员权限的子集
+	if util.ContainsString(impersonatedInfo.Roles, schema.UserRoleSu) {
+		err = hes.NewWithStatusCode("不可模拟超级管理员登录", http.StatusForbidden, errUserCategory)
+		return
+	}
+	for _, item := range impersonatedInfo.Permissions {
+		if !util.ContainsString(info.Permissions, item) {
+			err = hes.NewWithStatusCode("该用户拥有您未拥有的权限，不可模拟登录", http.StatusForbidden, errUserCategory)
+			return
+		}
+	}
+	err = us.SetInfo(impersonatedInfo)
+	if err != nil {
+		return
+	}
+	resp, err := pickUserInfo(c)
+	if err != nil {
+		return
+	}
+	c.Body = &resp
+	return
+}
+
+// restoreImpersonator 结束模拟登录，恢复为管理员的信息
+func restoreImpersonator(c *elton.Context, us *session.UserSession) (err error) {
+	info := us.MustGetInfo()
+	impersonator := info.Impersonator
+	if impersonator == nil {
+		return
+	}
+	log.Default().Info().
+		Str("category", "impersonation").
+		Str("account", info.Account).
+		Str("impersonator", impersonator.Account).
+		Str("startedAt", impersonator.StartedAt).
+		Msg("stop impersonation")
+	u, err := getEntClient().User.Get(c.Context(), impersonator.ID)
+	if err != nil {
+		// 管理员账户已不存在，则清除登录状态
+		if ent.IsNotFound(err) {
+			return us.SetInfo(session.UserInfo{})
+		}
+		return
+	}
+	// 模拟登录期间管理员账户被禁用，则清除登录状态
+	if u.Status != schema.StatusEnabled {
+		return us.SetInfo(session.UserInfo{})
+	}
+	adminInfo := session.UserInfo{
+		Account:           impersonator.Account,
+		ID:                impersonator.ID,
+		TwoFactorVerified: impersonator.TwoFactorVerified,
+		LoginAt:           impersonator.LoginAt,
+	}
+	err = fillUserPermissions(c.Context(), &adminInfo, u)
+	if err != nil {
+		return
+	}
+	return us.SetInfo(adminInfo)
+}
+
+// stopImpersonation 结束模拟登录
+func (*userAdminCtrl) stopImpersonation(c *elton.Context) (err error) {
+	us := getUserSession(c)
+	if !us.MustGetInfo().IsImpersonating() {
+		err = hes.New("当前未模拟登录", errUserCategory)
+		return
+	}
+	err = restoreImpersonator(c, us)
+	if err != nil {
+		return
+	}
+	resp, err := pickUserInfo(c)
+	if err != nil {
+		return
+	}
+	c.Body = &resp
+	return
+}
+
+// trackImpersonation 记录模拟登录期间的请求
+func trackImpersonation(c *elton.Context, info session.UserInfo) {
+	ip := c.RealIP()
+	sid := util.GetSessionID(c)
+	log.Default().Info().
+		Str("category", "impersonation").
+		Str("account", info.Account).
+		Str("impersonator", info.Impersonator.Account).
+		Str("method", c.Request.Method).
+		Str("route", c.Route).
+		Str("uri", c.Request.RequestURI).
+		Str("ip", ip).
+		Str("sid", sid).
+		Msg("")
+	GetInfluxSrv().Write(cs.MeasurementUserImpersonation, map[string]string{
+		cs.TagMethod: c.Request.Method,
+		cs.TagRoute:  c.Route,
+	}, map[string]interface{}{
+		cs.FieldAccount:      info.Account,
+		cs.FieldImpersonator: info.Impersonator.Account,
+		cs.FieldURI:          c.Request.RequestURI,
+		cs.FieldIP:           ip,
+		cs.FieldSID:          sid,
+	})
+}
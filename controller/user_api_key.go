@@ -0,0 +1,276 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// API key相关的路由处理，API key用于脚本等自动化调用
+
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/apikey"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type userAPIKeyCtrl struct{}
+
+const (
+	// apiKeyPrefix API key的前缀，便于识别
+	apiKeyPrefix = "elite_"
+	// 每个账户最多可创建的API key数量
+	apiKeyMaxCount = 20
+	// 更新最近使用时间的间隔，避免每次请求均更新
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// 接口参数定义
+type (
+	// userAPIKeyAddParams 添加API key参数
+	userAPIKeyAddParams struct {
+		Name   string   `json:"name" validate:"required,xAPIKeyName"`
+		Scopes []string `json:"scopes" validate:"required,min=1,dive,xAPIKeyScope"`
+		// 过期时间，为空则不过期
+		ExpiredAt *time.Time `json:"expiredAt"`
+	}
+)
+
+// 接口响应定义
+type (
+	// userAPIKeyListResp API key列表响应
+	userAPIKeyListResp struct {
+		APIKeys []*ent.APIKey `json:"apiKeys"`
+	}
+	// userAPIKeyAddResp 添加API key响应，key仅在此时返回
+	userAPIKeyAddResp struct {
+		*ent.APIKey
+		Key string `json:"key"`
+	}
+	// userAPIKeyScopeListResp API key权限范围列表响应
+	userAPIKeyScopeListResp struct {
+		Scopes []*schema.APIKeyScopeInfo `json:"scopes"`
+	}
+)
+
+// apiKeyInfo 请求使用的API key及其所属用户
+type apiKeyInfo struct {
+	key  *ent.APIKey
+	user *ent.User
+}
+
+var errAPIKeyInvalid = hes.NewWithStatusCode("API key无效或已过期", http.StatusUnauthorized, errUserCategory)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+
+	ctrl := userAPIKeyCtrl{}
+
+	// API key的权限范围列表
+	g.GET(
+		"/v1/api-key-scopes",
+		shouldBeLogin,
+		ctrl.listScope,
+	)
+	// 当前账户的API key列表
+	g.GET(
+		"/v1/me/api-keys",
+		shouldBeLogin,
+		ctrl.list,
+	)
+	// 添加API key
+	g.POST(
+		"/v1/me/api-keys",
+		newTrackerMiddleware(cs.ActionAPIKeyAdd),
+		shouldBeLogin,
+		shouldNotImpersonate,
+		checkTwoFactorMiddleware,
+		ctrl.add,
+	)
+	// 删除API key
+	g.DELETE(
+		"/v1/me/api-keys/{id}",
+		newTrackerMiddleware(cs.ActionAPIKeyDelete),
+		shouldBeLogin,
+		ctrl.delete,
+	)
+}
+
+// getAPIKeyHash 获取API key的hash，数据库中仅保存hash
+func getAPIKeyHash(key string) string {
+	return util.Sha256(key)
+}
+
+// getAPIKeyInfo 获取API key及其所属用户，key无效、已过期或用户非启用状态均返回出错
+func getAPIKeyInfo(ctx context.Context, key string) (info *apiKeyInfo, err error) {
+	item, err := getEntClient().APIKey.Query().
+		Where(apikey.KeyHash(getAPIKeyHash(key))).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = errAPIKeyInvalid
+		}
+		return
+	}
+	if item.ExpiredAt != nil && item.ExpiredAt.Before(time.Now()) {
+		err = errAPIKeyInvalid
+		return
+	}
+	u, err := getEntClient().User.Query().
+		Where(user.Account(item.Account)).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = errAPIKeyInvalid
+		}
+		return
+	}
+	if u.Status != schema.StatusEnabled {
+		err = errAPIKeyInvalid
+		return
+	}
+	info = &apiKeyInfo{
+		key:  item,
+		user: u,
+	}
+	return
+}
+
+// updateAPIKeyLastUsed 更新API key的最近使用时间与IP
+func updateAPIKeyLastUsed(item *ent.APIKey, ip string) {
+	if item.LastUsedAt != nil &&
+		time.Since(*item.LastUsedAt) < apiKeyLastUsedInterval &&
+		item.LastUsedIP == ip {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err := getEntClient().APIKey.UpdateOneID(item.ID).
+			SetLastUsedAt(time.Now()).
+			SetLastUsedIP(ip).
+			Exec(ctx)
+		if err != nil {
+			log.Default().Error().
+				Err(err).
+				Int("id", item.ID).
+				Msg("update api key last used fail")
+		}
+	}()
+}
+
+// listScope 获取API key的权限范围列表
+func (*userAPIKeyCtrl) listScope(c *elton.Context) (err error) {
+	c.PrivateCacheMaxAge(5 * time.Minute)
+	c.Body = &userAPIKeyScopeListResp{
+		Scopes: schema.GetAPIKeyScopeList(),
+	}
+	return
+}
+
+// list 获取当前账户的API key列表
+func (*userAPIKeyCtrl) list(c *elton.Context) (err error) {
+	apiKeys, err := getEntClient().APIKey.Query().
+		Where(apikey.Account(getUserSession(c).MustGetInfo().Account)).
+		Order(ent.Desc(apikey.FieldCreatedAt)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &userAPIKeyListResp{
+		APIKeys: apiKeys,
+	}
+	return
+}
+
+// add 添加API key
+func (*userAPIKeyCtrl) add(c *elton.Context) (err error) {
+	params := userAPIKeyAddParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	if params.ExpiredAt != nil && params.ExpiredAt.Before(time.Now()) {
+		err = hes.New("过期时间不能早于当前时间", errUserCategory)
+		return
+	}
+	userInfo := getUserSession(c).MustGetInfo()
+	account := userInfo.Account
+	count, err := getEntClient().APIKey.Query().
+		Where(apikey.Account(account)).
+		Count(c.Context())
+	if err != nil {
+		return
+	}
+	if count >= apiKeyMaxCount {
+		err = hes.New("API key数量已达上限，请先删除不再使用的key", errUserCategory)
+		return
+	}
+	buf, err := util.RandomBytes(24)
+	if err != nil {
+		return
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+	item, err := getEntClient().APIKey.Create().
+		SetAccount(account).
+		SetName(params.Name).
+		SetPrefix(key[:len(apiKeyPrefix)+6]).
+		SetKeyHash(getAPIKeyHash(key)).
+		SetScopes(params.Scopes).
+		SetNillableExpiredAt(params.ExpiredAt).
+		SetTwoFactorVerified(userInfo.TwoFactorVerified).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.Created(&userAPIKeyAddResp{
+		APIKey: item,
+		Key:    key,
+	})
+	return
+}
+
+// delete 删除API key，删除后该key立即失效
+func (*userAPIKeyCtrl) delete(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	count, err := getEntClient().APIKey.Delete().
+		Where(
+			apikey.ID(id),
+			apikey.Account(getUserSession(c).MustGetInfo().Account),
+		).
+		Exec(c.Context())
+	if err != nil {
+		return
+	}
+	if count == 0 {
+		err = hes.NewWithStatusCode("API key不存在", http.StatusNotFound, errUserCategory)
+		return
+	}
+	c.NoContent()
+	return
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 访问令牌相关的路由处理
+
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/session"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+)
+
+type userAuthTokenCtrl struct{}
+
+// 接口参数定义
+type (
+	// userAuthTokenRefreshParams 刷新令牌参数
+	userAuthTokenRefreshParams struct {
+		RefreshToken string `json:"refreshToken" validate:"required,xUserAuthToken"`
+	}
+)
+
+func init() {
+	// 刷新令牌时不加载cookie session
+	g := router.NewGroup("/users")
+
+	ctrl := userAuthTokenCtrl{}
+
+	// 使用刷新令牌获取新的访问令牌
+	g.POST(
+		"/v1/me/tokens/refresh",
+		newTrackerMiddleware(cs.ActionAuthTokenRefresh),
+		// 限制相同IP在60秒之内只能调用30次
+		newIPLimit(30, 60*time.Second, cs.ActionAuthTokenRefresh),
+		ctrl.refresh,
+	)
+}
+
+// getBearerToken 获取请求头中的访问令牌
+func getBearerToken(c *elton.Context) string {
+	value := c.GetRequestHeader("Authorization")
+	prefix := "Bearer "
+	if len(value) <= len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(value[len(prefix):])
+}
+
+// swagger:route POST /users/v1/me/tokens/refresh users userAuthTokenRefresh
+// 刷新访问令牌
+//
+// 使用刷新令牌获取新的访问令牌与刷新令牌，刷新令牌仅可使用一次
+// Responses:
+// 	200: apiUserAuthTokenRefreshResponse
+func (*userAuthTokenCtrl) refresh(c *elton.Context) (err error) {
+	params := userAuthTokenRefreshParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	claims, err := service.ConsumeRefreshToken(c.Context(), params.RefreshToken)
+	if err != nil {
+		return
+	}
+	commit, err := session.Load(c, claims.SID)
+	if err != nil {
+		return
+	}
+	// session已退出登录、已更换账户或已失效，则需要重新登录
+	us := getUserSession(c)
+	if !us.IsLogin() {
+		err = service.ErrAuthTokenInvalid
+		return
+	}
+	info := us.MustGetInfo()
+	if info.Account != claims.Account {
+		err = service.ErrAuthTokenInvalid
+		return
+	}
+	revoked, err := service.IsUserSessionRevoked(c.Context(), info.Account, info.LoginAt)
+	if err != nil {
+		return
+	}
+	if revoked {
+		err = service.ErrAuthTokenInvalid
+		return
+	}
+	// 延长session的有效期
+	err = us.Refresh()
+	if err != nil {
+		return
+	}
+	err = commit()
+	if err != nil {
+		return
+	}
+	err = service.UpdateUserSessionActive(c.Context(), info.Account, claims.SID)
+	if err != nil {
+		return
+	}
+	pair, err := service.CreateAuthTokens(claims.SID, claims.Account)
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.Body = pair
+	return
+}
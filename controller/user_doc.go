@@ -3,7 +3,10 @@
 
 package controller
 
-import "github.com/vicanso/elite/ent"
+import (
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/service"
+)
 
 // 用户列表响应
 // swagger:response apiUserListResponse
@@ -18,6 +21,12 @@ type apiUserListParams struct {
 	userListParams
 }
 
+// 获取登录Token参数
+// swagger:parameters userLoginToken
+type apiUserLoginTokenParams struct {
+	userLoginTokenParams
+}
+
 // 用户登录Token响应
 // swagger:response apiUserLoginTokenResponse
 type apiUserLoginTokenResponse struct {
@@ -45,3 +54,17 @@ type apiUserRegisterResponse struct {
 	// in: body
 	Body *ent.User
 }
+
+// 刷新访问令牌参数
+// swagger:parameters userAuthTokenRefresh
+type apiUserAuthTokenRefreshParams struct {
+	// in: body
+	Body *userAuthTokenRefreshParams
+}
+
+// 刷新访问令牌响应
+// swagger:response apiUserAuthTokenRefreshResponse
+type apiUserAuthTokenRefreshResponse struct {
+	// in: body
+	Body *service.AuthTokenPair
+}
@@ -0,0 +1,455 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// OpenID Connect登录及外部身份关联的路由处理
+
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/ent/useridentity"
+	"github.com/vicanso/elite/oidc"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/session"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type userOIDCCtrl struct{}
+
+// oidcStateTTL 登录流程的有效期
+const oidcStateTTL = 10 * time.Minute
+
+var oidcConfig = config.GetOIDCConfig()
+
+// 接口参数定义
+type (
+	// userOIDCProviderParams provider参数
+	userOIDCProviderParams struct {
+		Provider string `json:"provider" validate:"required,xOIDCProvider"`
+	}
+	// userOIDCCallbackParams 回调参数
+	userOIDCCallbackParams struct {
+		Code  string `json:"code" validate:"required,xOIDCCode"`
+		State string `json:"state" validate:"required,xUserToken"`
+	}
+)
+
+// 接口响应定义
+type (
+	// userOIDCProviderInfo provider信息
+	userOIDCProviderInfo struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+	// userOIDCProviderListResp provider列表响应
+	userOIDCProviderListResp struct {
+		Providers []*userOIDCProviderInfo `json:"providers"`
+	}
+	// userIdentityListResp 外部身份列表响应
+	userIdentityListResp struct {
+		Identities []*ent.UserIdentity `json:"identities"`
+	}
+)
+
+// oidcStateData 登录流程中保存的数据
+type oidcStateData struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// 关联外部身份的账户，为空则为登录
+	Account string `json:"account"`
+}
+
+var (
+	errOIDCStateInvalid     = hes.New("登录状态无效，请重新登录", errUserCategory)
+	errOIDCIdentityNotFound = hes.NewWithStatusCode("该身份未关联账户，请先登录后在个人设置中关联", http.StatusForbidden, errUserCategory)
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+
+	ctrl := userOIDCCtrl{}
+
+	// 可用的provider列表
+	g.GET(
+		"/v1/oidc/providers",
+		ctrl.listProvider,
+	)
+	// 跳转至provider登录
+	g.GET(
+		"/v1/oidc/{provider}/login",
+		shouldBeAnonymous,
+		ctrl.login,
+	)
+	// 跳转至provider关联外部身份
+	g.GET(
+		"/v1/me/oidc/{provider}/link",
+		shouldBeLogin,
+		shouldNotImpersonate,
+		ctrl.link,
+	)
+	// provider回调
+	g.GET(
+		"/v1/oidc/{provider}/callback",
+		newTrackerMiddleware(cs.ActionOIDCLogin),
+		ctrl.callback,
+	)
+	// 当前账户关联的外部身份
+	g.GET(
+		"/v1/me/identities",
+		shouldBeLogin,
+		ctrl.listIdentity,
+	)
+	// 取消关联外部身份
+	g.DELETE(
+		"/v1/me/identities/{id}",
+		newTrackerMiddleware(cs.ActionUserIdentityDelete),
+		shouldBeLogin,
+		ctrl.deleteIdentity,
+	)
+}
+
+// redirectTo 跳转至指定地址，不直接写响应，以便session的cookie可正常设置
+func redirectTo(c *elton.Context, url string) {
+	c.SetHeader("Location", url)
+	c.StatusCode = http.StatusFound
+	c.Body = nil
+}
+
+// getOIDCProvider 获取路由参数中的provider
+func getOIDCProvider(c *elton.Context) (p *oidc.Provider, err error) {
+	params := userOIDCProviderParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	return oidc.GetProvider(params.Provider)
+}
+
+// newOIDCRandomString 生成随机字符串（用于nonce与PKCE的code verifier）
+func newOIDCRandomString() (string, error) {
+	buf, err := util.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// startOIDC 开始登录或关联流程，state同时保存至session，回调时校验为同一客户端
+func startOIDC(c *elton.Context, account string) (err error) {
+	p, err := getOIDCProvider(c)
+	if err != nil {
+		return
+	}
+	nonce, err := newOIDCRandomString()
+	if err != nil {
+		return
+	}
+	verifier, err := newOIDCRandomString()
+	if err != nil {
+		return
+	}
+	buf, err := json.Marshal(&oidcStateData{
+		Provider: p.Config.Name,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Account:  account,
+	})
+	if err != nil {
+		return
+	}
+	state, err := service.CreateUserToken(c.Context(), service.UserTokenOIDCState, string(buf), oidcStateTTL)
+	if err != nil {
+		return
+	}
+	authURL, err := p.AuthCodeURL(c.Context(), state, nonce, verifier)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info, err := us.GetInfo()
+	if err != nil {
+		return
+	}
+	info.OIDCState = state
+	err = us.SetInfo(info)
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	redirectTo(c, authURL)
+	return
+}
+
+// findOIDCUser 获取外部身份关联的账户，未关联时如果provider允许，
+// 则根据provider已验证的邮箱关联邮箱已验证的账户
+func findOIDCUser(ctx context.Context, p *oidc.Provider, token *oidc.IDToken) (u *ent.User, err error) {
+	identity, err := getEntClient().UserIdentity.Query().
+		Where(
+			useridentity.Provider(p.Config.Name),
+			useridentity.Subject(token.Subject),
+		).
+		First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return
+	}
+	if identity != nil {
+		return getUserByAccount(ctx, identity.Account)
+	}
+	if !p.Config.LinkByEmail || !token.EmailVerified || token.Email == "" {
+		err = errOIDCIdentityNotFound
+		return
+	}
+	users, err := getEntClient().User.Query().
+		Where(
+			user.Email(token.Email),
+			user.EmailVerifiedAtNotNil(),
+		).
+		Limit(2).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	// 有多个账户使用相同邮箱则无法确定关联的账户
+	if len(users) != 1 {
+		err = errOIDCIdentityNotFound
+		return
+	}
+	u = users[0]
+	err = linkOIDCIdentity(ctx, p, token, u.Account)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// linkOIDCIdentity 关联外部身份
+func linkOIDCIdentity(ctx context.Context, p *oidc.Provider, token *oidc.IDToken, account string) (err error) {
+	_, err = getEntClient().UserIdentity.Create().
+		SetAccount(account).
+		SetProvider(p.Config.Name).
+		SetSubject(token.Subject).
+		SetEmail(token.Email).
+		Save(ctx)
+	if ent.IsConstraintError(err) {
+		err = hes.New("该身份已关联其它账户或账户已关联此登录方式", errUserCategory)
+	}
+	return
+}
+
+// syncOIDCRoles 同步由provider管理的用户角色
+func syncOIDCRoles(ctx context.Context, p *oidc.Provider, token *oidc.IDToken, u *ent.User) (*ent.User, error) {
+	roles, managedRoles := p.GetRoles(token)
+	if len(managedRoles) == 0 {
+		return u, nil
+	}
+	userRoles := make([]string, 0)
+	for _, role := range u.Roles {
+		if !util.ContainsString(managedRoles, role) {
+			userRoles = append(userRoles, role)
+		}
+	}
+	for _, role := range roles {
+		if !util.ContainsString(userRoles, role) {
+			userRoles = append(userRoles, role)
+		}
+	}
+	// 角色无变化则不更新
+	changed := len(userRoles) != len(u.Roles)
+	for _, role := range u.Roles {
+		if !util.ContainsString(userRoles, role) {
+			changed = true
+		}
+	}
+	if !changed {
+		return u, nil
+	}
+	return u.Update().
+		SetRoles(userRoles).
+		Save(ctx)
+}
+
+// listProvider 获取可用的provider列表
+func (*userOIDCCtrl) listProvider(c *elton.Context) (err error) {
+	providers := oidc.ListProviders()
+	infos := make([]*userOIDCProviderInfo, len(providers))
+	for index, p := range providers {
+		infos[index] = &userOIDCProviderInfo{
+			Name:        p.Config.Name,
+			DisplayName: p.Config.DisplayName,
+		}
+	}
+	c.CacheMaxAge(time.Minute)
+	c.Body = &userOIDCProviderListResp{
+		Providers: infos,
+	}
+	return
+}
+
+// login 跳转至provider登录
+func (*userOIDCCtrl) login(c *elton.Context) (err error) {
+	return startOIDC(c, "")
+}
+
+// link 跳转至provider关联外部身份
+func (*userOIDCCtrl) link(c *elton.Context) (err error) {
+	return startOIDC(c, getUserSession(c).MustGetInfo().Account)
+}
+
+// callback provider回调，校验state后使用授权码获取ID token，
+// 关联外部身份或登录其关联的账户，完成后跳转至前端
+func (*userOIDCCtrl) callback(c *elton.Context) (err error) {
+	p, err := getOIDCProvider(c)
+	if err != nil {
+		return
+	}
+	// provider返回出错（如用户拒绝授权）
+	if c.QueryParam("error") != "" {
+		err = hes.New("登录失败："+c.QueryParam("error"), errUserCategory)
+		return
+	}
+	params := userOIDCCallbackParams{}
+	err = validate.Do(&params, c.Query())
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info, err := us.GetInfo()
+	if err != nil {
+		return
+	}
+	if info.OIDCState == "" ||
+		subtle.ConstantTimeCompare([]byte(info.OIDCState), []byte(params.State)) != 1 {
+		err = errOIDCStateInvalid
+		return
+	}
+	info.OIDCState = ""
+	err = us.SetInfo(info)
+	if err != nil {
+		return
+	}
+	value, err := service.ConsumeUserToken(c.Context(), service.UserTokenOIDCState, params.State)
+	if err != nil {
+		return
+	}
+	data := oidcStateData{}
+	err = json.Unmarshal([]byte(value), &data)
+	if err != nil {
+		return
+	}
+	if data.Provider != p.Config.Name {
+		err = errOIDCStateInvalid
+		return
+	}
+	token, err := p.Exchange(c.Context(), params.Code, data.Verifier, data.Nonce)
+	if err != nil {
+		return
+	}
+	c.NoStore()
+
+	// 关联外部身份，需要仍为发起关联的账户
+	if data.Account != "" {
+		if info.Account != data.Account {
+			err = errOIDCStateInvalid
+			return
+		}
+		err = linkOIDCIdentity(c.Context(), p, token, data.Account)
+		if err != nil {
+			return
+		}
+		redirectTo(c, oidcConfig.SuccessURL)
+		return
+	}
+
+	u, err := findOIDCUser(c.Context(), p, token)
+	if err != nil {
+		return
+	}
+	if !isUserLoginAllowed(u) {
+		err = errUserLoginForbidden
+		return
+	}
+	u, err = syncOIDCRoles(c.Context(), p, token, u)
+	if err != nil {
+		return
+	}
+	// 已启用两步验证，需要校验验证码后才完成登录
+	if u.TotpEnabledAt != nil {
+		err = us.SetInfo(session.UserInfo{
+			TwoFactorPending: u.Account,
+		})
+		if err != nil {
+			return
+		}
+	} else {
+		err = loginSuccess(c, u, false)
+		if err != nil {
+			return
+		}
+	}
+	redirectTo(c, oidcConfig.SuccessURL)
+	return
+}
+
+// listIdentity 获取当前账户关联的外部身份
+func (*userOIDCCtrl) listIdentity(c *elton.Context) (err error) {
+	identities, err := getEntClient().UserIdentity.Query().
+		Where(useridentity.Account(getUserSession(c).MustGetInfo().Account)).
+		Order(ent.Desc(useridentity.FieldCreatedAt)).
+		All(c.Context())
+	if err != nil {
+		return
+	}
+	c.Body = &userIdentityListResp{
+		Identities: identities,
+	}
+	return
+}
+
+// deleteIdentity 取消关联外部身份
+func (*userOIDCCtrl) deleteIdentity(c *elton.Context) (err error) {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return
+	}
+	count, err := getEntClient().UserIdentity.Delete().
+		Where(
+			useridentity.ID(id),
+			useridentity.Account(getUserSession(c).MustGetInfo().Account),
+		).
+		Exec(c.Context())
+	if err != nil {
+		return
+	}
+	if count == 0 {
+		err = hes.NewWithStatusCode("关联的身份不存在", http.StatusNotFound, errUserCategory)
+		return
+	}
+	c.NoContent()
+	return
+}
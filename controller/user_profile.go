@@ -0,0 +1,458 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户个人资料相关的路由处理，包括头像、公开资料、数据导出以及账户注销
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/apikey"
+	"github.com/vicanso/elite/ent/novelreview"
+	"github.com/vicanso/elite/ent/paragraphannotation"
+	"github.com/vicanso/elite/ent/paragraphcomment"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/ent/useridentity"
+	"github.com/vicanso/elite/ent/userlogin"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type userProfileCtrl struct{}
+
+const (
+	// 头像文件的最大尺寸
+	userAvatarMaxSize = 5 * 1024 * 1024
+	// 头像调整后的宽度
+	userAvatarWidth = 200
+	// 公开资料中展示的书评数量
+	userProfileReviewLimit = 10
+	// 数据导出中用户行为的时间范围
+	userExportActionRange = "365d"
+	// 数据导出中每类用户行为的最大数量
+	userExportActionLimit = 1000
+)
+
+// 接口参数定义
+type (
+	// userAvatarParams 获取头像参数
+	userAvatarParams struct {
+		Name string `json:"name" validate:"required,xUserAvatar"`
+	}
+	// userProfileParams 获取公开资料参数
+	userProfileParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
+	// userDeletionParams 申请注销参数
+	userDeletionParams struct {
+		Password string `json:"password" validate:"required,xUserPassword"`
+	}
+)
+
+// 接口响应定义
+type (
+	// userPrivacyListResp 隐私设置列表响应
+	userPrivacyListResp struct {
+		Privacy []*schema.UserPrivacyInfo `json:"privacy"`
+	}
+	// userAvatarResp 上传头像响应
+	userAvatarResp struct {
+		Avatar string `json:"avatar"`
+	}
+	// userProfileResp 公开资料响应
+	userProfileResp struct {
+		Account   string             `json:"account"`
+		Name      string             `json:"name,omitempty"`
+		Avatar    string             `json:"avatar,omitempty"`
+		Bio       string             `json:"bio,omitempty"`
+		CreatedAt *time.Time         `json:"createdAt,omitempty"`
+		Reviews   []*ent.NovelReview `json:"reviews,omitempty"`
+	}
+	// userExportResp 用户数据导出
+	userExportResp struct {
+		ExportedAt  time.Time                  `json:"exportedAt"`
+		User        *ent.User                  `json:"user"`
+		Logins      []*ent.UserLogin           `json:"logins"`
+		Identities  []*ent.UserIdentity        `json:"identities"`
+		APIKeys     []*ent.APIKey              `json:"apiKeys"`
+		Reviews     []*ent.NovelReview         `json:"reviews"`
+		Comments    []*ent.ParagraphComment    `json:"comments"`
+		Annotations []*ent.ParagraphAnnotation `json:"annotations"`
+		// 书架（收藏与取消收藏记录）
+		Bookshelf []map[string]interface{} `json:"bookshelf"`
+		// 阅读进度（阅读章节记录）
+		Progress []map[string]interface{} `json:"progress"`
+	}
+	// userDeletionResp 申请注销响应
+	userDeletionResp struct {
+		// 超过此时间后注销，在此之前登录则取消注销
+		DeleteAt time.Time `json:"deleteAt"`
+	}
+)
+
+var errUserProfileNotFound = hes.NewWithStatusCode("该账户不存在", http.StatusNotFound, errUserCategory)
+
+func init() {
+	prefix := "/users"
+	g := router.NewGroup(prefix, loadUserSession)
+	noneSessionGroup := router.NewGroup(prefix)
+
+	ctrl := userProfileCtrl{}
+
+	// 隐私设置列表
+	noneSessionGroup.GET(
+		"/v1/privacy-settings",
+		ctrl.listPrivacy,
+	)
+	// 获取头像
+	noneSessionGroup.GET(
+		"/v1/avatars/{name}",
+		ctrl.getAvatar,
+	)
+	// 获取公开资料
+	noneSessionGroup.GET(
+		"/v1/profiles/{account}",
+		ctrl.getProfile,
+	)
+
+	// 上传头像
+	g.POST(
+		"/v1/me/avatar",
+		newTrackerMiddleware(cs.ActionUserAvatarUpdate),
+		shouldBeLogin,
+		ctrl.uploadAvatar,
+	)
+	// 导出个人数据
+	g.GET(
+		"/v1/me/export",
+		newTrackerMiddleware(cs.ActionUserDataExport),
+		shouldBeLogin,
+		// 同一账户10分钟内只可导出一次
+		newCooldownLimit(10*time.Minute, cs.ActionUserDataExport, func(c *elton.Context) string {
+			return getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.export,
+	)
+	// 申请注销账户
+	g.POST(
+		"/v1/me/deletion",
+		newTrackerMiddleware(cs.ActionUserDeletionRequest),
+		shouldBeLogin,
+		checkTwoFactorMiddleware,
+		ctrl.requestDeletion,
+	)
+}
+
+// listPrivacy 获取隐私设置列表
+func (*userProfileCtrl) listPrivacy(c *elton.Context) (err error) {
+	c.CacheMaxAge(5 * time.Minute)
+	c.Body = &userPrivacyListResp{
+		Privacy: schema.GetUserPrivacyList(),
+	}
+	return
+}
+
+// uploadAvatar 上传头像，调整尺寸后保存，并删除原有头像
+func (*userProfileCtrl) uploadAvatar(c *elton.Context) (err error) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if header.Size > userAvatarMaxSize {
+		err = hes.New("头像文件不能超过5MB", errUserCategory)
+		return
+	}
+	fileType := ""
+	switch header.Header.Get("Content-Type") {
+	case "image/png":
+		fileType = "png"
+	case "image/jpeg":
+		fileType = "jpeg"
+	default:
+		err = hes.New("头像仅支持png与jpeg格式", errUserCategory)
+		return
+	}
+	buffer, err := fileSrv.ResizeImage(file, fileType, userAvatarWidth, 0)
+	if err != nil {
+		return
+	}
+	account := getUserSession(c).MustGetInfo().Account
+	name := util.GenXID() + "." + fileType
+	_, err = fileSrv.Upload(c.Context(), service.UploadParams{
+		Bucket: service.UserAvatarBucket,
+		Name:   name,
+		Reader: buffer,
+		Size:   int64(buffer.Len()),
+		Opts: minio.PutObjectOptions{
+			ContentType: "image/" + fileType,
+			UserTags: map[string]string{
+				"account": account,
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+	u, err := getUserByAccount(c.Context(), account)
+	if err != nil {
+		return
+	}
+	_, err = u.Update().
+		SetAvatar(name).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	if u.Avatar != "" {
+		_ = fileSrv.Remove(c.Context(), service.UserAvatarBucket, u.Avatar)
+	}
+	c.Body = &userAvatarResp{
+		Avatar: name,
+	}
+	return
+}
+
+// getAvatar 获取头像，文件名唯一因此可长期缓存
+func (*userProfileCtrl) getAvatar(c *elton.Context) (err error) {
+	params := userAvatarParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	data, header, err := fileSrv.GetData(c.Context(), service.UserAvatarBucket, params.Name)
+	if err != nil {
+		return
+	}
+	c.MergeHeader(header)
+	c.CacheMaxAge(24 * time.Hour)
+	c.Body = data
+	return
+}
+
+// getProfile 获取公开资料，已禁用或注销的账户视为不存在
+func (*userProfileCtrl) getProfile(c *elton.Context) (err error) {
+	params := userProfileParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	u, err := getEntClient().User.Query().
+		Where(user.Account(params.Account)).
+		First(c.Context())
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = errUserProfileNotFound
+		}
+		return
+	}
+	if u.Status != schema.StatusEnabled || u.DeletedAt != nil {
+		err = errUserProfileNotFound
+		return
+	}
+	c.CacheMaxAge(time.Minute)
+	// 隐藏资料则仅返回账户
+	if util.ContainsString(u.Privacy, schema.UserPrivacyHideProfile) {
+		c.Body = &userProfileResp{
+			Account: u.Account,
+		}
+		return
+	}
+	resp := &userProfileResp{
+		Account:   u.Account,
+		Name:      u.Name,
+		Avatar:    u.Avatar,
+		Bio:       u.Bio,
+		CreatedAt: &u.CreatedAt,
+	}
+	if !util.ContainsString(u.Privacy, schema.UserPrivacyHideReviews) {
+		resp.Reviews, err = getEntClient().NovelReview.Query().
+			Where(novelreview.Account(u.Account)).
+			Order(ent.Desc(novelreview.FieldCreatedAt)).
+			Limit(userProfileReviewLimit).
+			All(c.Context())
+		if err != nil {
+			return
+		}
+	}
+	c.Body = resp
+	return
+}
+
+// listUserActions 获取账户指定类型的用户行为记录
+func listUserActions(ctx context.Context, account string, categories []string) (items []map[string]interface{}, err error) {
+	conditions := make([]string, len(categories))
+	for index, category := range categories {
+		conditions[index] = fmt.Sprintf(`r.%s == "%s"`, cs.TagCategory, category)
+	}
+	query := fmt.Sprintf(`|> range(start: -%s)
+|> filter(fn: (r) => r["_measurement"] == "%s")
+|> filter(fn: (r) => %s)
+|> pivot(
+	rowKey:["_time"],
+	columnKey: ["_field"],
+	valueColumn: "_value"
+)
+|> filter(fn: (r) => r.%s == "%s")
+|> sort(columns:["_time"], desc: true)
+|> limit(n:%d)
+`,
+		userExportActionRange,
+		cs.MeasurementUserAction,
+		strings.Join(conditions, " or "),
+		cs.FieldAccount,
+		account,
+		userExportActionLimit,
+	)
+	items, err = GetInfluxSrv().Query(ctx, query)
+	if err != nil {
+		return
+	}
+	// 清除不需要字段
+	for _, item := range items {
+		delete(item, "_measurement")
+		delete(item, "_start")
+		delete(item, "_stop")
+		delete(item, "table")
+		delete(item, "result")
+	}
+	return
+}
+
+// export 导出个人数据，以json文件的形式下载
+func (*userProfileCtrl) export(c *elton.Context) (err error) {
+	ctx := c.Context()
+	account := getUserSession(c).MustGetInfo().Account
+	client := getEntClient()
+	resp := &userExportResp{
+		ExportedAt: time.Now(),
+	}
+	resp.User, err = getUserByAccount(ctx, account)
+	if err != nil {
+		return
+	}
+	resp.Logins, err = client.UserLogin.Query().
+		Where(userlogin.Account(account)).
+		Order(ent.Desc(userlogin.FieldCreatedAt)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.Identities, err = client.UserIdentity.Query().
+		Where(useridentity.Account(account)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.APIKeys, err = client.APIKey.Query().
+		Where(apikey.Account(account)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.Reviews, err = client.NovelReview.Query().
+		Where(novelreview.Account(account)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.Comments, err = client.ParagraphComment.Query().
+		Where(paragraphcomment.Account(account)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.Annotations, err = client.ParagraphAnnotation.Query().
+		Where(paragraphannotation.Account(account)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	resp.Bookshelf, err = listUserActions(ctx, account, []string{
+		cs.ActionAddToFavorite,
+		cs.ActionRemoveFromFavorite,
+	})
+	if err != nil {
+		return
+	}
+	resp.Progress, err = listUserActions(ctx, account, []string{
+		cs.ActionChapterDetail,
+		cs.ActionContinueReading,
+	})
+	if err != nil {
+		return
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.SetContentTypeByExt(".json")
+	c.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.json"`, account, resp.ExportedAt.Format("20060102")))
+	c.BodyBuffer = bytes.NewBuffer(buf)
+	return
+}
+
+// requestDeletion 申请注销账户，校验密码后退出所有设备的登录，
+// 宽限期内登录则取消注销，超过宽限期后由定时任务清除个人信息
+func (*userProfileCtrl) requestDeletion(c *elton.Context) (err error) {
+	params := userDeletionParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	account := getUserSession(c).MustGetInfo().Account
+	u, err := getUserByAccount(c.Context(), account)
+	if err != nil {
+		return
+	}
+	valid, err := verifyUserPassword(u, params.Password)
+	if err != nil {
+		return
+	}
+	if !valid {
+		err = hes.New("密码错误，请重新输入", errUserCategory)
+		return
+	}
+	now := time.Now()
+	_, err = u.Update().
+		SetDeletionRequestedAt(now).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	err = service.DestroyUserSessions(c.Context(), account)
+	if err != nil {
+		return
+	}
+	c.Body = &userDeletionResp{
+		DeleteAt: now.Add(accountConfig.DeletionGracePeriod),
+	}
+	return
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户session（登录设备）相关的路由处理
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/userlogin"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+)
+
+type userSessionCtrl struct{}
+
+// 接口参数定义
+type (
+	// userSessionParams session标识参数
+	userSessionParams struct {
+		ID string `json:"id" validate:"required,xUserSessionID"`
+	}
+)
+
+// 接口响应定义
+type (
+	// userSessionInfo session信息
+	userSessionInfo struct {
+		// session标识
+		ID string `json:"id"`
+		// 是否当前的session
+		Current bool `json:"current"`
+		// 最近活跃时间
+		ActiveAt time.Time `json:"activeAt"`
+		// 登录时间
+		LoginAt   *time.Time `json:"loginAt,omitempty"`
+		UserAgent string     `json:"userAgent,omitempty"`
+		IP        string     `json:"ip,omitempty"`
+		Country   string     `json:"country,omitempty"`
+		Province  string     `json:"province,omitempty"`
+		City      string     `json:"city,omitempty"`
+		ISP       string     `json:"isp,omitempty"`
+	}
+	// userSessionListResp session列表响应
+	userSessionListResp struct {
+		Sessions []*userSessionInfo `json:"sessions"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+
+	ctrl := userSessionCtrl{}
+
+	// 当前账户的session列表
+	g.GET(
+		"/v1/me/sessions",
+		shouldBeLogin,
+		ctrl.list,
+	)
+	// 删除当前账户的session
+	g.DELETE(
+		"/v1/me/sessions/{id}",
+		newTrackerMiddleware(cs.ActionUserSessionDestroy),
+		shouldBeLogin,
+		ctrl.destroy,
+	)
+}
+
+// listUserSessionInfos 获取账户的session列表，设备、IP与地区等信息从登录记录中获取
+func listUserSessionInfos(ctx context.Context, account, currentSID string) (infos []*userSessionInfo, err error) {
+	sessions, err := service.ListUserSessions(ctx, account)
+	if err != nil {
+		return
+	}
+	sids := make([]string, len(sessions))
+	for index, item := range sessions {
+		sids[index] = item.SID
+	}
+	logins, err := getEntClient().UserLogin.Query().
+		Where(
+			userlogin.Account(account),
+			userlogin.SessionIDIn(sids...),
+		).
+		Order(ent.Desc(userlogin.FieldCreatedAt)).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	// 每个session取最新的登录记录
+	loginRecords := make(map[string]*ent.UserLogin)
+	for _, item := range logins {
+		if _, exists := loginRecords[item.SessionID]; !exists {
+			loginRecords[item.SessionID] = item
+		}
+	}
+	infos = make([]*userSessionInfo, len(sessions))
+	for index, item := range sessions {
+		info := &userSessionInfo{
+			ID:       item.ID,
+			Current:  item.SID == currentSID,
+			ActiveAt: item.ActiveAt,
+		}
+		record := loginRecords[item.SID]
+		if record != nil {
+			loginAt := record.CreatedAt
+			info.LoginAt = &loginAt
+			info.UserAgent = record.UserAgent
+			info.IP = record.IP
+			info.Country = record.Country
+			info.Province = record.Province
+			info.City = record.City
+			info.ISP = record.Isp
+		}
+		infos[index] = info
+	}
+	return
+}
+
+// list 获取当前账户的session列表
+func (*userSessionCtrl) list(c *elton.Context) (err error) {
+	us := getUserSession(c)
+	sessions, err := listUserSessionInfos(c.Context(), us.MustGetInfo().Account, us.ID())
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.Body = &userSessionListResp{
+		Sessions: sessions,
+	}
+	return
+}
+
+// destroy 删除当前账户的session，使该设备退出登录
+func (*userSessionCtrl) destroy(c *elton.Context) (err error) {
+	params := userSessionParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return
+	}
+	err = service.DestroyUserSession(c.Context(), getUserSession(c).MustGetInfo().Account, params.ID)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
@@ -0,0 +1,353 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户两步验证（TOTP）相关的路由处理
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/predicate"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/middleware"
+	"github.com/vicanso/elite/router"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elite/session"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+type userTOTPCtrl struct{}
+
+// 已校验密码待两步验证的有效期
+const twoFactorPendingTTL = 5 * time.Minute
+
+// 两步验证码的长度，其它长度的则为恢复码
+const totpCodeLength = 6
+
+// 接口参数定义
+type (
+	// userTwoFactorCodeParams 两步验证码参数
+	userTwoFactorCodeParams struct {
+		Code string `json:"code" validate:"required,xUserTwoFactorCode"`
+	}
+)
+
+// 接口响应定义
+type (
+	// userTOTPRecoveryCodesResp 恢复码响应，仅在生成时返回
+	userTOTPRecoveryCodesResp struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+
+	ctrl := userTOTPCtrl{}
+
+	// 两步验证登录
+	g.POST(
+		"/v1/me/login/totp",
+		// 登录如果失败则最少等待1秒
+		middleware.WaitFor(time.Second, true),
+		newTrackerMiddleware(cs.ActionLoginTwoFactor),
+		shouldBeAnonymous,
+		// 限制相同IP在60秒之内只能调用10次
+		newIPLimit(10, 60*time.Second, cs.ActionLoginTwoFactor),
+		// 限制10分钟内，相同的账号只允许出错5次
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return cs.ActionLoginTwoFactor + "-" + getUserSession(c).MustGetInfo().TwoFactorPending
+		}),
+		ctrl.login,
+	)
+
+	// 获取启用两步验证的密钥与二维码
+	g.POST(
+		"/v1/me/totp",
+		shouldBeTwoFactorEnrollable,
+		shouldNotImpersonate,
+		ctrl.enroll,
+	)
+	// 确认启用两步验证
+	g.POST(
+		"/v1/me/totp/confirm",
+		newTrackerMiddleware(cs.ActionTOTPEnable),
+		shouldBeTwoFactorEnrollable,
+		shouldNotImpersonate,
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return cs.ActionTOTPEnable + "-" + getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.confirm,
+	)
+	// 关闭两步验证
+	g.DELETE(
+		"/v1/me/totp",
+		newTrackerMiddleware(cs.ActionTOTPDisable),
+		shouldBeLogin,
+		shouldNotImpersonate,
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return cs.ActionTOTPDisable + "-" + getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.disable,
+	)
+	// 重新生成恢复码
+	g.POST(
+		"/v1/me/totp/recovery-codes",
+		newTrackerMiddleware(cs.ActionTOTPRecoveryCodesReset),
+		shouldBeLogin,
+		shouldNotImpersonate,
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return cs.ActionTOTPRecoveryCodesReset + "-" + getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.resetRecoveryCodes,
+	)
+}
+
+// getUserByAccount 根据账户获取用户
+func getUserByAccount(ctx context.Context, account string) (*ent.User, error) {
+	return getEntClient().User.Query().
+		Where(user.Account(account)).
+		First(ctx)
+}
+
+// verifyUserTwoFactor 校验两步验证码或恢复码，恢复码使用后则删除
+func verifyUserTwoFactor(ctx context.Context, u *ent.User, code string) (err error) {
+	errCodeInvalid := hes.New("验证码错误或已使用", errUserCategory)
+	if u.TotpEnabledAt == nil {
+		err = hes.New("未启用两步验证", errUserCategory)
+		return
+	}
+	if len(code) == totpCodeLength {
+		secret, e := service.DecryptTOTPSecret(u.TotpSecret)
+		if e != nil {
+			return e
+		}
+		valid, e := service.ValidateUserTOTP(ctx, u.Account, secret, code)
+		if e != nil {
+			return e
+		}
+		if !valid {
+			err = errCodeInvalid
+		}
+		return
+	}
+	index := service.MatchRecoveryCode(u.TotpRecoveryCodes, code)
+	if index < 0 {
+		err = errCodeInvalid
+		return
+	}
+	codes := make([]string, 0, len(u.TotpRecoveryCodes)-1)
+	codes = append(codes, u.TotpRecoveryCodes[:index]...)
+	codes = append(codes, u.TotpRecoveryCodes[index+1:]...)
+	// 仅当恢复码未被并发使用时才更新
+	updated, err := updateUserIf(ctx, u.ID, []predicate.User{
+		user.UpdatedAt(u.UpdatedAt),
+	}, func(updateOne *ent.UserUpdateOne) *ent.UserUpdateOne {
+		return updateOne.SetTotpRecoveryCodes(codes)
+	})
+	if err != nil {
+		return
+	}
+	if !updated {
+		err = errCodeInvalid
+		return
+	}
+	return
+}
+
+// login 校验两步验证码，完成登录
+func (*userTOTPCtrl) login(c *elton.Context) (err error) {
+	params := userTwoFactorCodeParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info, err := us.GetInfo()
+	if err != nil {
+		return
+	}
+	errPendingInvalid := hes.New("请先使用账户密码登录", errUserCategory)
+	if info.TwoFactorPending == "" {
+		err = errPendingInvalid
+		return
+	}
+	updatedAt, _ := util.ParseTime(info.UpdatedAt)
+	if time.Since(updatedAt) > twoFactorPendingTTL {
+		err = us.SetInfo(session.UserInfo{})
+		if err != nil {
+			return
+		}
+		err = errPendingInvalid
+		return
+	}
+	u, err := getUserByAccount(c.Context(), info.TwoFactorPending)
+	if err != nil {
+		return
+	}
+	err = verifyUserTwoFactor(c.Context(), u, params.Code)
+	if err != nil {
+		return
+	}
+	return loginSuccess(c, u, true)
+}
+
+// enroll 生成两步验证的密钥与二维码，确认后才启用
+func (*userTOTPCtrl) enroll(c *elton.Context) (err error) {
+	account := getUserSession(c).MustGetInfo().Account
+	u, err := getUserByAccount(c.Context(), account)
+	if err != nil {
+		return
+	}
+	if u.TotpEnabledAt != nil {
+		err = hes.New("已启用两步验证", errUserCategory)
+		return
+	}
+	enrollment, err := service.CreateTOTPEnrollment(c.Context(), account)
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.Body = enrollment
+	return
+}
+
+// setRecoveryCodes 生成新的恢复码并设置
+func setRecoveryCodes(c *elton.Context, update *ent.UserUpdateOne) (err error) {
+	codes, hashes, err := service.GenerateRecoveryCodes()
+	if err != nil {
+		return
+	}
+	_, err = update.SetTotpRecoveryCodes(hashes).
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	c.NoStore()
+	c.Body = &userTOTPRecoveryCodesResp{
+		RecoveryCodes: codes,
+	}
+	return
+}
+
+// confirm 校验验证码后启用两步验证，返回恢复码
+func (*userTOTPCtrl) confirm(c *elton.Context) (err error) {
+	params := userTwoFactorCodeParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info := us.MustGetInfo()
+	ctx := c.Context()
+	secret, err := service.GetTOTPEnrollment(ctx, info.Account)
+	if err != nil {
+		return
+	}
+	valid, err := service.ValidateUserTOTP(ctx, info.Account, secret, params.Code)
+	if err != nil {
+		return
+	}
+	if !valid {
+		err = hes.New("验证码错误", errUserCategory)
+		return
+	}
+	u, err := getUserByAccount(ctx, info.Account)
+	if err != nil {
+		return
+	}
+	// 密钥加密后再保存
+	encryptedSecret, err := service.EncryptTOTPSecret(secret)
+	if err != nil {
+		return
+	}
+	err = setRecoveryCodes(c, u.Update().
+		SetTotpSecret(encryptedSecret).
+		SetTotpEnabledAt(time.Now()))
+	if err != nil {
+		return
+	}
+	_ = service.ClearTOTPEnrollment(ctx, info.Account)
+	// 启用时已校验验证码，视为当前session已完成两步验证
+	info.TwoFactorVerified = true
+	return us.SetInfo(info)
+}
+
+// disable 关闭两步验证，拥有要求两步验证的权限时不允许关闭
+func (*userTOTPCtrl) disable(c *elton.Context) (err error) {
+	params := userTwoFactorCodeParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	us := getUserSession(c)
+	info := us.MustGetInfo()
+	if isTwoFactorRequired(info) {
+		err = hes.NewWithStatusCode("当前权限必须启用两步验证", http.StatusForbidden, errUserCategory)
+		return
+	}
+	u, err := getUserByAccount(c.Context(), info.Account)
+	if err != nil {
+		return
+	}
+	err = verifyUserTwoFactor(c.Context(), u, params.Code)
+	if err != nil {
+		return
+	}
+	_, err = u.Update().
+		ClearTotpSecret().
+		ClearTotpEnabledAt().
+		ClearTotpRecoveryCodes().
+		Save(c.Context())
+	if err != nil {
+		return
+	}
+	info.TwoFactorVerified = false
+	err = us.SetInfo(info)
+	if err != nil {
+		return
+	}
+	c.NoContent()
+	return
+}
+
+// resetRecoveryCodes 校验两步验证码后重新生成恢复码，旧的恢复码失效
+func (*userTOTPCtrl) resetRecoveryCodes(c *elton.Context) (err error) {
+	params := userTwoFactorCodeParams{}
+	err = validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return
+	}
+	if len(params.Code) != totpCodeLength {
+		err = hes.New("请使用身份验证器的验证码", errUserCategory)
+		return
+	}
+	u, err := getUserByAccount(c.Context(), getUserSession(c).MustGetInfo().Account)
+	if err != nil {
+		return
+	}
+	err = verifyUserTwoFactor(c.Context(), u, params.Code)
+	if err != nil {
+		return
+	}
+	return setRecoveryCodes(c, u.Update())
+}
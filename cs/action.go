@@ -23,6 +23,58 @@ const (
 
 	// ActionUserInfoUpdate update user info
 	ActionUserInfoUpdate = "updateUserInfo"
+	// ActionUserPasswordChange change password
+	ActionUserPasswordChange = "changePassword"
+	// ActionPasswordResetRequest request password reset
+	ActionPasswordResetRequest = "requestPasswordReset"
+	// ActionPasswordResetConfirm confirm password reset
+	ActionPasswordResetConfirm = "confirmPasswordReset"
+	// ActionEmailVerifySend send email verification
+	ActionEmailVerifySend = "sendEmailVerification"
+	// ActionEmailVerifyConfirm confirm email verification
+	ActionEmailVerifyConfirm = "confirmEmailVerification"
+	// ActionLoginTwoFactor login with two factor code
+	ActionLoginTwoFactor = "loginTwoFactor"
+	// ActionLoginConfirm confirm risky login by email
+	ActionLoginConfirm = "loginConfirm"
+	// ActionTOTPEnable enable totp
+	ActionTOTPEnable = "enableTOTP"
+	// ActionTOTPDisable disable totp
+	ActionTOTPDisable = "disableTOTP"
+	// ActionTOTPRecoveryCodesReset reset totp recovery codes
+	ActionTOTPRecoveryCodesReset = "resetTOTPRecoveryCodes"
+	// ActionOIDCLogin oidc login or link
+	ActionOIDCLogin = "oidcLogin"
+	// ActionUserIdentityDelete delete user identity
+	ActionUserIdentityDelete = "deleteUserIdentity"
+	// ActionAPIKeyAdd add api key
+	ActionAPIKeyAdd = "addAPIKey"
+	// ActionAPIKeyDelete delete api key
+	ActionAPIKeyDelete = "deleteAPIKey"
+	// ActionAuthTokenRefresh refresh auth token
+	ActionAuthTokenRefresh = "refreshAuthToken"
+	// ActionUserSessionDestroy destroy user session
+	ActionUserSessionDestroy = "destroyUserSession"
+	// ActionPermissionAdd add permission
+	ActionPermissionAdd = "addPermission"
+	// ActionRoleAdd add role
+	ActionRoleAdd = "addRole"
+	// ActionRoleUpdate update role
+	ActionRoleUpdate = "updateRole"
+	// ActionRoleDelete delete role
+	ActionRoleDelete = "deleteRole"
+	// ActionUserGroupAdd add user group
+	ActionUserGroupAdd = "addUserGroup"
+	// ActionUserGroupUpdate update user group
+	ActionUserGroupUpdate = "updateUserGroup"
+	// ActionUserGroupDelete delete user group
+	ActionUserGroupDelete = "deleteUserGroup"
+	// ActionUserAvatarUpdate update avatar
+	ActionUserAvatarUpdate = "updateUserAvatar"
+	// ActionUserDataExport export user data
+	ActionUserDataExport = "exportUserData"
+	// ActionUserDeletionRequest request account deletion
+	ActionUserDeletionRequest = "requestUserDeletion"
 	// ActionUserMeUpdate update my info
 	ActionUserMeUpdate = "updateUserMe"
 	// ActionAddUserTracker add user tracker
@@ -32,9 +84,23 @@ const (
 	ActionConfigurationAdd = "addConfiguration"
 	// ActionConfigurationUpdate update configuration
 	ActionConfigurationUpdate = "updateConfiguration"
+	// ActionConfigurationRollback rollback configuration
+	ActionConfigurationRollback = "rollbackConfiguration"
 
 	// ActionAdminCleanSession clean session
 	ActionAdminCleanSession = "cleanSession"
+	// ActionAdminLogoutEverywhere logout user everywhere
+	ActionAdminLogoutEverywhere = "logoutEverywhere"
+	// ActionAdminLoginUnlock admin unlock login
+	ActionAdminLoginUnlock = "adminUnlockLogin"
+	// ActionAdminUserAdd admin add user
+	ActionAdminUserAdd = "adminAddUser"
+	// ActionAdminUserPasswordReset admin require user to reset password
+	ActionAdminUserPasswordReset = "adminRequirePasswordReset"
+	// ActionAdminImpersonateStart admin start impersonating user
+	ActionAdminImpersonateStart = "adminStartImpersonation"
+	// ActionAdminImpersonateStop admin stop impersonating user
+	ActionAdminImpersonateStop = "adminStopImpersonation"
 )
 
 // 小说相关的操作
@@ -45,6 +111,32 @@ const (
 	ActionNovelChaptersUpdate = "updateNovelChapters"
 	// ActionNovelChapterUpdate update novel chapter
 	ActionNovelChapterUpdate = "updateNovelChapter"
+	// ActionNovelChapterRollback rollback novel chapter
+	ActionNovelChapterRollback = "rollbackNovelChapter"
+	// ActionNovelModerate moderate novel
+	ActionNovelModerate = "moderateNovel"
+	// ActionNovelReport report novel
+	ActionNovelReport = "reportNovel"
+	// ActionNovelReportHandle handle novel report
+	ActionNovelReportHandle = "handleNovelReport"
+	// ActionParagraphCommentAdd add paragraph comment
+	ActionParagraphCommentAdd = "addParagraphComment"
+	// ActionParagraphCommentLike like paragraph comment
+	ActionParagraphCommentLike = "likeParagraphComment"
+	// ActionParagraphCommentReport report paragraph comment
+	ActionParagraphCommentReport = "reportParagraphComment"
+	// ActionParagraphCommentModerate moderate paragraph comments
+	ActionParagraphCommentModerate = "moderateParagraphComment"
+	// ActionParagraphAnnotationAdd add paragraph annotation
+	ActionParagraphAnnotationAdd = "addParagraphAnnotation"
+	// ActionNovelReviewAdd add novel review
+	ActionNovelReviewAdd = "addNovelReview"
+	// ActionNovelReviewUpdate update novel review
+	ActionNovelReviewUpdate = "updateNovelReview"
+	// ActionNovelReviewDelete delete novel review
+	ActionNovelReviewDelete = "deleteNovelReview"
+	// ActionNovelReviewVote vote novel review helpful
+	ActionNovelReviewVote = "voteNovelReview"
 )
 
 // 客户端的相关操作
@@ -21,6 +21,14 @@ const (
 	CID = "cid"
 	// UserSession user session
 	UserSession = "userSession"
+	// AuthTokenClaims auth token claims
+	AuthTokenClaims = "authTokenClaims"
+	// APIKey api key
+	APIKey = "apiKey"
+	// UserSessionLoaded user session loaded
+	UserSessionLoaded = "userSessionLoaded"
+	// LoginConfirmed login confirmed by email
+	LoginConfirmed = "loginConfirmed"
 )
 
 type ContextKey string
@@ -42,4 +50,23 @@ const (
 	ResultFail
 )
 
-var MaskRegExp = regexp.MustCompile(`(?i)password`)
+const (
+	// HeaderAuthType 登录时指定认证方式的请求头
+	HeaderAuthType = "X-Auth-Type"
+	// AuthTypeToken 使用访问令牌认证
+	AuthTypeToken = "token"
+	// HeaderAPIKey API key的请求头
+	HeaderAPIKey = "X-API-Key"
+)
+
+// 登录防护的统计维度
+const (
+	// LoginDefenseAccount 账户
+	LoginDefenseAccount = "account"
+	// LoginDefenseIP IP
+	LoginDefenseIP = "ip"
+	// LoginDefenseSubnet IP网段（IPv4为/24，IPv6为/64）
+	LoginDefenseSubnet = "subnet"
+)
+
+var MaskRegExp = regexp.MustCompile(`(?i)password|refreshToken`)
@@ -48,6 +48,8 @@ const (
 	MeasurementUserLogin = "userLogin"
 	// MeasurementUserAddTrack 添加用户跟踪
 	MeasurementUserAddTrack = "userAddTrack"
+	// MeasurementUserImpersonation 模拟登录期间的请求记录
+	MeasurementUserImpersonation = "userImpersonation"
 	// MeasurementException 异常
 	MeasurementException = "exception"
 )
@@ -109,6 +111,8 @@ const (
 	FieldCity = "city"
 	// FieldISP ISP
 	FieldISP = "isp"
+	// FieldImpersonator 模拟登录的管理员账号
+	FieldImpersonator = "impersonator"
 	// FieldErrCategory 出错分类
 	FieldErrCategory = "errCategory"
 )
@@ -0,0 +1,235 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 功能开关，由配置（featureFlag分类）定义，刷新配置时更新。
+// 规则按顺序匹配，首个命中的规则生效，未命中则使用默认值。
+// 按比例放量时根据开关名称与设备ID hash分桶，同一设备的结果稳定
+
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/blang/semver/v4"
+	"github.com/vicanso/elite/util"
+)
+
+const (
+	// VariantOn 布尔开关的开启
+	VariantOn = "on"
+	// VariantOff 布尔开关的关闭，也是未命中且无默认值时的值
+	VariantOff = "off"
+)
+
+type (
+	// Flag 功能开关
+	Flag struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		// Variants 多值开关的可选值，为空表示布尔开关
+		Variants []string `json:"variants"`
+		// Default 未命中任何规则时的值，为空表示关闭
+		Default string  `json:"default"`
+		Rules   []*Rule `json:"rules"`
+	}
+	// Rule 定向规则，设置的条件均满足才命中
+	Rule struct {
+		Accounts  []string `json:"accounts"`
+		Roles     []string `json:"roles"`
+		Groups    []string `json:"groups"`
+		Platforms []string `json:"platforms"`
+		// AppVersion 应用版本范围，如>=1.0.0 <2.0.0
+		AppVersion string `json:"appVersion"`
+		// Percentage 按设备ID分桶放量的比例（0-100），为空表示不限制
+		Percentage *int `json:"percentage"`
+		// Variant 命中时的值，布尔开关为空表示开启
+		Variant string `json:"variant"`
+	}
+	// Subject 功能开关判断的对象
+	Subject struct {
+		Account    string
+		Roles      []string
+		Groups     []string
+		DeviceID   string
+		AppVersion string
+		Platform   string
+	}
+	subjectKey struct{}
+)
+
+var (
+	currentFlagsMutex = new(sync.RWMutex)
+	currentFlags      = make(map[string]*Flag)
+)
+
+// Parse 解析功能开关配置，并校验多值开关的可选值与版本范围
+func Parse(data string) (*Flag, error) {
+	flag := &Flag{}
+	err := json.Unmarshal([]byte(data), flag)
+	if err != nil {
+		return nil, err
+	}
+	if flag.Name == "" {
+		return nil, errors.New("name of feature flag can not be empty")
+	}
+	if !flag.isValidVariant(flag.Default) {
+		return nil, errors.New("default variant is invalid: " + flag.Default)
+	}
+	for _, rule := range flag.Rules {
+		if !flag.isValidVariant(rule.Variant) {
+			return nil, errors.New("variant is invalid: " + rule.Variant)
+		}
+		if rule.AppVersion != "" {
+			_, err = semver.ParseRange(rule.AppVersion)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return flag, nil
+}
+
+// Update 更新所有功能开关，刷新配置时调用
+func Update(flags []*Flag) {
+	m := make(map[string]*Flag)
+	for _, item := range flags {
+		m[item.Name] = item
+	}
+	currentFlagsMutex.Lock()
+	defer currentFlagsMutex.Unlock()
+	currentFlags = m
+}
+
+// NewContext 将功能开关判断的对象设置至context
+func NewContext(ctx context.Context, subject *Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// FromContext 从context中获取功能开关判断的对象
+func FromContext(ctx context.Context) *Subject {
+	subject, ok := ctx.Value(subjectKey{}).(*Subject)
+	if !ok {
+		return &Subject{}
+	}
+	return subject
+}
+
+// Variant 获取功能开关的值，未配置的开关为关闭
+func Variant(ctx context.Context, name string) string {
+	currentFlagsMutex.RLock()
+	flag, ok := currentFlags[name]
+	currentFlagsMutex.RUnlock()
+	if !ok {
+		return VariantOff
+	}
+	return flag.Evaluate(FromContext(ctx))
+}
+
+// Enabled 判断功能开关是否开启（值不为off）
+func Enabled(ctx context.Context, name string) bool {
+	return Variant(ctx, name) != VariantOff
+}
+
+// EvaluateAll 获取所有功能开关的值
+func EvaluateAll(ctx context.Context) map[string]string {
+	subject := FromContext(ctx)
+	currentFlagsMutex.RLock()
+	defer currentFlagsMutex.RUnlock()
+	result := make(map[string]string)
+	for name, flag := range currentFlags {
+		result[name] = flag.Evaluate(subject)
+	}
+	return result
+}
+
+// isValidVariant 判断是否可用的值，空值表示使用默认值
+func (flag *Flag) isValidVariant(variant string) bool {
+	if variant == "" || variant == VariantOff {
+		return true
+	}
+	if len(flag.Variants) == 0 {
+		return variant == VariantOn
+	}
+	return util.ContainsString(flag.Variants, variant)
+}
+
+// Evaluate 根据规则获取功能开关的值
+func (flag *Flag) Evaluate(subject *Subject) string {
+	for _, rule := range flag.Rules {
+		if !rule.match(flag.Name, subject) {
+			continue
+		}
+		if rule.Variant != "" {
+			return rule.Variant
+		}
+		// 布尔开关未指定值表示开启，多值开关则为第一个值
+		if len(flag.Variants) == 0 {
+			return VariantOn
+		}
+		return flag.Variants[0]
+	}
+	if flag.Default == "" {
+		return VariantOff
+	}
+	return flag.Default
+}
+
+// bucket 根据开关名称与设备ID分桶（0-99）
+func bucket(name, deviceID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + deviceID))
+	return int(h.Sum32() % 100)
+}
+
+// match 判断是否命中规则
+func (rule *Rule) match(name string, subject *Subject) bool {
+	if len(rule.Accounts) != 0 &&
+		(subject.Account == "" || !util.ContainsString(rule.Accounts, subject.Account)) {
+		return false
+	}
+	if len(rule.Roles) != 0 && !util.ContainsAny(rule.Roles, subject.Roles) {
+		return false
+	}
+	if len(rule.Groups) != 0 && !util.ContainsAny(rule.Groups, subject.Groups) {
+		return false
+	}
+	if len(rule.Platforms) != 0 && !util.ContainsString(rule.Platforms, subject.Platform) {
+		return false
+	}
+	if rule.AppVersion != "" {
+		// 无版本号（非app访问）或版本号不合法均不命中
+		if subject.AppVersion == "" {
+			return false
+		}
+		ver, err := util.ParseVersion(subject.AppVersion)
+		if err != nil {
+			return false
+		}
+		matched, err := util.MatchVersionRange(ver, rule.AppVersion)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if rule.Percentage != nil {
+		// 无设备ID无法稳定分桶，不命中
+		if subject.DeviceID == "" || bucket(name, subject.DeviceID) >= *rule.Percentage {
+			return false
+		}
+	}
+	return true
+}
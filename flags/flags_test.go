@@ -0,0 +1,135 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	flag, err := Parse(`{
+		"name": "newReader",
+		"variants": ["a", "b"],
+		"default": "a",
+		"rules": [
+			{
+				"roles": ["su"],
+				"variant": "b"
+			}
+		]
+	}`)
+	assert.Nil(err)
+	assert.Equal("newReader", flag.Name)
+	assert.Equal(1, len(flag.Rules))
+
+	_, err = Parse(`{"name": "newReader", "variants": ["a"], "default": "c"}`)
+	assert.NotNil(err)
+
+	_, err = Parse(`{"name": "newReader", "rules": [{"variant": "a"}]}`)
+	assert.NotNil(err)
+
+	_, err = Parse(`{"name": "newReader", "rules": [{"appVersion": "abc"}]}`)
+	assert.NotNil(err)
+
+	_, err = Parse(`{"description": "newReader"}`)
+	assert.NotNil(err)
+}
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+
+	percentage := 50
+	flag := &Flag{
+		Name:     "newReader",
+		Variants: []string{"a", "b"},
+		Default:  "a",
+		Rules: []*Rule{
+			{
+				Accounts: []string{"treexie"},
+				Variant:  "b",
+			},
+			{
+				AppVersion: ">=2.0.0",
+				Platforms:  []string{"ios"},
+				Variant:    "b",
+			},
+			{
+				Percentage: &percentage,
+				Variant:    "b",
+			},
+		},
+	}
+	assert.Equal("b", flag.Evaluate(&Subject{
+		Account: "treexie",
+	}))
+	assert.Equal("b", flag.Evaluate(&Subject{
+		AppVersion: "2.1.0",
+		Platform:   "ios",
+	}))
+	assert.Equal("a", flag.Evaluate(&Subject{
+		AppVersion: "2.1.0",
+		Platform:   "android",
+	}))
+	assert.Equal("a", flag.Evaluate(&Subject{}))
+
+	// 按设备分桶，约一半的设备命中
+	count := 0
+	for i := 0; i < 1000; i++ {
+		if flag.Evaluate(&Subject{
+			DeviceID: strconv.Itoa(i),
+		}) == "b" {
+			count++
+		}
+	}
+	assert.True(count > 400 && count < 600)
+	// 同一设备结果稳定
+	subject := &Subject{
+		DeviceID: "abcd",
+	}
+	assert.Equal(flag.Evaluate(subject), flag.Evaluate(subject))
+}
+
+func TestEnabled(t *testing.T) {
+	assert := assert.New(t)
+
+	Update([]*Flag{
+		{
+			Name: "search",
+			Rules: []*Rule{
+				{
+					Groups: []string{"beta"},
+				},
+			},
+		},
+	})
+	defer Update(nil)
+
+	ctx := NewContext(context.Background(), &Subject{
+		Groups: []string{"beta"},
+	})
+	assert.True(Enabled(ctx, "search"))
+	assert.Equal(VariantOn, Variant(ctx, "search"))
+	assert.False(Enabled(ctx, "notFound"))
+	assert.False(Enabled(context.Background(), "search"))
+	assert.Equal(map[string]string{
+		"search": VariantOn,
+	}, EvaluateAll(ctx))
+}
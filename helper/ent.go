@@ -215,8 +215,25 @@ func initSchemaHooks(c *ent.Client) {
 		}
 		return false
 	}
-	// 禁止删除数据
-	c.Use(hook.Reject(ent.OpDelete | ent.OpDeleteOne))
+	// 允许删除的数据（用户可自行删除或注销时清除的数据），其余的禁止删除
+	deletableSchemas := []string{
+		ent.TypeAPIKey,
+		// 超过保留时长的审计日志
+		ent.TypeAuditLog,
+		ent.TypeNovelReview,
+		ent.TypeNovelReviewVote,
+		ent.TypeParagraphAnnotation,
+		ent.TypeRole,
+		ent.TypeUserGroup,
+		ent.TypeUserIdentity,
+		ent.TypeUserLogin,
+	}
+	isDeletable := func(_ context.Context, m ent.Mutation) bool {
+		return util.ContainsString(deletableSchemas, m.Type())
+	}
+	c.Use(hook.If(hook.Reject(ent.OpDelete|ent.OpDeleteOne), hook.Not(isDeletable)))
+	// 审计日志
+	c.Use(newEntAuditHook())
 	// 数据库操作统计
 	c.Use(func(next ent.Mutator) ent.Mutator {
 		return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
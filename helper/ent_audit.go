@@ -0,0 +1,299 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 审计日志，通过ent hook记录用户、配置与小说的变更，
+// 包括操作者、变更前后的数据、IP与trace id，操作者信息由请求处理时设置至context
+
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/auditlog"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/util"
+)
+
+// auditedSchemas 记录审计日志的数据类型
+var auditedSchemas = []string{
+	ent.TypeUser,
+	ent.TypeConfiguration,
+	ent.TypeNovel,
+}
+
+// auditIgnoredFields 审计日志中忽略的字段，
+// 小说的评分统计由书评更新时自动计算，非管理操作，也不记录
+var auditIgnoredFields = []string{
+	"created_at",
+	"updated_at",
+	"rating",
+	"rating_count",
+	"rating_sum",
+	"rating_distribution",
+}
+
+// auditMaskedFields 审计日志中不记录值的字段（密码等由cs.MaskRegExp匹配），
+// 个人信息也不记录，避免账户注销后仍保留于审计日志中
+var auditMaskedFields = []string{
+	"totp_secret",
+	"totp_recovery_codes",
+	"email",
+	"name",
+	"bio",
+	"avatar",
+	"privacy",
+}
+
+// AuditActor 审计日志的操作者信息
+type AuditActor struct {
+	// 操作者账号
+	Account string
+	// 模拟登录的管理员账号
+	Impersonator string
+	IP           string
+	TraceID      string
+}
+
+type auditActorKey struct{}
+
+// NewAuditContext 将审计日志的操作者信息设置至context
+func NewAuditContext(ctx context.Context, actor *AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActorFromContext 从context中获取审计日志的操作者信息，
+// 定时任务等系统操作则为空
+func auditActorFromContext(ctx context.Context) *AuditActor {
+	actor, ok := ctx.Value(auditActorKey{}).(*AuditActor)
+	if !ok {
+		return &AuditActor{}
+	}
+	return actor
+}
+
+// auditMutation 可获取ID的mutation
+type auditMutation interface {
+	ent.Mutation
+	ID() (int, bool)
+}
+
+// auditRecord 审计日志记录
+type auditRecord struct {
+	action   string
+	entityID int
+	before   map[string]interface{}
+	after    map[string]interface{}
+}
+
+// maskAuditData 屏蔽敏感字段的值
+func maskAuditData(data map[string]interface{}) {
+	for name := range data {
+		if cs.MaskRegExp.MatchString(name) ||
+			util.ContainsString(auditMaskedFields, name) {
+			data[name] = "***"
+		}
+	}
+}
+
+// removeUnchangedAuditData 删除变更前后一致的字段
+func removeUnchangedAuditData(before, after map[string]interface{}) {
+	for name, value := range after {
+		oldValue, ok := before[name]
+		if ok && reflect.DeepEqual(oldValue, value) {
+			delete(before, name)
+			delete(after, name)
+		}
+	}
+}
+
+// getAuditClient 获取mutation对应的client，在事务中则为事务的client
+func getAuditClient(m ent.Mutation) *ent.Client {
+	switch m := m.(type) {
+	case *ent.UserMutation:
+		return m.Client()
+	case *ent.ConfigurationMutation:
+		return m.Client()
+	case *ent.NovelMutation:
+		return m.Client()
+	}
+	return nil
+}
+
+// getAuditEntity 获取删除前的数据
+func getAuditEntity(ctx context.Context, m ent.Mutation, id int) (data map[string]interface{}, err error) {
+	var entity interface{}
+	switch m := m.(type) {
+	case *ent.UserMutation:
+		entity, err = m.Client().User.Get(ctx, id)
+	case *ent.ConfigurationMutation:
+		entity, err = m.Client().Configuration.Get(ctx, id)
+	case *ent.NovelMutation:
+		entity, err = m.Client().Novel.Get(ctx, id)
+	}
+	if err != nil || entity == nil {
+		return
+	}
+	buf, err := json.Marshal(entity)
+	if err != nil {
+		return
+	}
+	data = make(map[string]interface{})
+	err = json.Unmarshal(buf, &data)
+	return
+}
+
+// getEntityID 获取创建的数据ID
+func getEntityID(value ent.Value) int {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	id := v.FieldByName("ID")
+	if !id.IsValid() || id.Kind() != reflect.Int {
+		return 0
+	}
+	return int(id.Int())
+}
+
+// newAuditRecord 在变更前生成审计日志记录，获取变更前的数据。
+// 批量更新无法获取ID与变更前的数据（当前ent版本的mutation未提供IDs），
+// 因此需要审计的数据应使用UpdateOne更新，批量更新仅用于更新updated_at等忽略的字段
+func newAuditRecord(ctx context.Context, m ent.Mutation) (record *auditRecord, err error) {
+	record = &auditRecord{
+		before: make(map[string]interface{}),
+		after:  make(map[string]interface{}),
+	}
+	id := 0
+	if am, ok := m.(auditMutation); ok {
+		id, _ = am.ID()
+	}
+	record.entityID = id
+	switch {
+	case m.Op().Is(ent.OpCreate):
+		record.action = schema.AuditActionCreate
+	case m.Op().Is(ent.OpDelete | ent.OpDeleteOne):
+		record.action = schema.AuditActionDelete
+		if id != 0 {
+			record.before, err = getAuditEntity(ctx, m, id)
+			if err != nil {
+				return
+			}
+		}
+		return
+	default:
+		record.action = schema.AuditActionUpdate
+	}
+	for _, name := range m.Fields() {
+		if util.ContainsString(auditIgnoredFields, name) {
+			continue
+		}
+		value, _ := m.Field(name)
+		record.after[name] = value
+		// 单条更新时获取变更前的值
+		if m.Op().Is(ent.OpUpdateOne) {
+			record.before[name], err = m.OldField(ctx, name)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, name := range m.ClearedFields() {
+		record.after[name] = nil
+		if m.Op().Is(ent.OpUpdateOne) {
+			record.before[name], err = m.OldField(ctx, name)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// save 保存审计日志，操作者等信息从context中获取
+func (record *auditRecord) save(ctx context.Context, m ent.Mutation) (err error) {
+	removeUnchangedAuditData(record.before, record.after)
+	// 无变更的更新则不记录
+	if record.action == schema.AuditActionUpdate && len(record.after) == 0 {
+		return
+	}
+	maskAuditData(record.before)
+	maskAuditData(record.after)
+	client := getAuditClient(m)
+	if client == nil {
+		return
+	}
+	actor := auditActorFromContext(ctx)
+	create := client.AuditLog.Create().
+		SetActor(actor.Account).
+		SetImpersonator(actor.Impersonator).
+		SetAction(auditlog.Action(record.action)).
+		SetEntityType(m.Type()).
+		SetIP(actor.IP).
+		SetTraceID(actor.TraceID)
+	if record.entityID != 0 {
+		create = create.SetEntityID(record.entityID)
+	}
+	if len(record.before) != 0 {
+		buf, e := json.Marshal(record.before)
+		if e != nil {
+			return e
+		}
+		create = create.SetBefore(string(buf))
+	}
+	if len(record.after) != 0 {
+		buf, e := json.Marshal(record.after)
+		if e != nil {
+			return e
+		}
+		create = create.SetAfter(string(buf))
+	}
+	_, err = create.Save(ctx)
+	return
+}
+
+// newEntAuditHook 创建审计日志的hook，记录失败不影响数据的变更
+func newEntAuditHook() ent.Hook {
+	return func(next ent.Mutator) ent.Mutator {
+		return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+			if !util.ContainsString(auditedSchemas, m.Type()) {
+				return next.Mutate(ctx, m)
+			}
+			record, e := newAuditRecord(ctx, m)
+			value, err := next.Mutate(ctx, m)
+			if err != nil {
+				return value, err
+			}
+			if e == nil {
+				if record.action == schema.AuditActionCreate {
+					record.entityID = getEntityID(value)
+				}
+				e = record.save(ctx, m)
+			}
+			if e != nil {
+				log.Default().Error().
+					Str("category", "auditLog").
+					Str("schema", m.Type()).
+					Str("op", m.Op().String()).
+					Err(e).
+					Msg("save audit log fail")
+			}
+			return value, nil
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/ent"
+)
+
+func TestMaskAuditData(t *testing.T) {
+	assert := assert.New(t)
+
+	data := map[string]interface{}{
+		"account":     "tree",
+		"password":    "abcd",
+		"totp_secret": "secret",
+		"email":       "tree@example.com",
+	}
+	maskAuditData(data)
+	assert.Equal(map[string]interface{}{
+		"account":     "tree",
+		"password":    "***",
+		"totp_secret": "***",
+		"email":       "***",
+	}, data)
+}
+
+func TestAuditContext(t *testing.T) {
+	assert := assert.New(t)
+
+	// 未设置则为系统操作
+	assert.Equal(&AuditActor{}, auditActorFromContext(context.Background()))
+
+	actor := &AuditActor{
+		Account: "tree",
+		IP:      "127.0.0.1",
+		TraceID: "abcd",
+	}
+	ctx := NewAuditContext(context.Background(), actor)
+	assert.Equal(actor, auditActorFromContext(ctx))
+}
+
+func TestRemoveUnchangedAuditData(t *testing.T) {
+	assert := assert.New(t)
+
+	before := map[string]interface{}{
+		"name":   "tree",
+		"roles":  []string{"su"},
+		"status": 1,
+	}
+	after := map[string]interface{}{
+		"name":   "tree",
+		"roles":  []string{"su", "admin"},
+		"status": 1,
+	}
+	removeUnchangedAuditData(before, after)
+	assert.Equal(map[string]interface{}{
+		"roles": []string{"su"},
+	}, before)
+	assert.Equal(map[string]interface{}{
+		"roles": []string{"su", "admin"},
+	}, after)
+}
+
+func TestGetEntityID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(1, getEntityID(&ent.User{
+		ID: 1,
+	}))
+	assert.Equal(0, getEntityID(nil))
+	assert.Equal(0, getEntityID("abc"))
+}
@@ -40,6 +40,7 @@ swagger:meta
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -52,7 +53,7 @@ import (
 
 	warner "github.com/vicanso/count-warner"
 	"github.com/vicanso/elite/config"
-	_ "github.com/vicanso/elite/controller"
+	"github.com/vicanso/elite/controller"
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/helper"
 	"github.com/vicanso/elite/log"
@@ -60,6 +61,7 @@ import (
 	"github.com/vicanso/elite/profiler"
 	"github.com/vicanso/elite/router"
 	_ "github.com/vicanso/elite/schedule"
+	"github.com/vicanso/elite/schema"
 	"github.com/vicanso/elite/service"
 	"github.com/vicanso/elite/tracer"
 	"github.com/vicanso/elite/util"
@@ -167,6 +169,11 @@ func dependServiceCheck() (err error) {
 	if err != nil {
 		return
 	}
+	// 初始化内置的权限与角色
+	err = service.InitRBAC(context.Background())
+	if err != nil {
+		return
+	}
 	configSrv := new(service.ConfigurationSrv)
 	err = configSrv.Refresh()
 	if err != nil {
@@ -345,6 +352,15 @@ func main() {
 	// 根据配置对路由mock返回
 	e.UseWithName(middleware.NewRouterMocker(service.RouterGetConfig), "routerMocker")
 
+	// 维护中的路由返回503，有审核权限的用户不受影响（仅维护中才加载session判断）
+	e.UseWithName(middleware.NewMaintenance(middleware.MaintenanceConfig{
+		GetWindow: service.GetMaintenanceWindow,
+		Prepare:   controller.LoadUserSession,
+		Skip: func(c *elton.Context) bool {
+			return controller.HasPermission(c, schema.PermissionNovelModerate)
+		},
+	}), "maintenance")
+
 	// 路由并发限制
 	e.UseWithName(M.NewRCL(M.RCLConfig{
 		Limiter: service.GetRouterConcurrencyLimiter(),
@@ -383,6 +399,8 @@ func main() {
 			Msg("")
 		return
 	}
+	// 订阅配置变更通知，配置变更后立即刷新
+	service.SubscribeConfigurationInvalidation()
 
 	service.SetApplicationStatus(service.ApplicationStatusRunning)
 
@@ -56,6 +56,15 @@ func WaitFor(d time.Duration, onlyErrOccurreds ...bool) elton.Handler {
 	}
 }
 
+// GetCaptchaValue 获取请求提交的图形验证码（不包括验证码id）
+func GetCaptchaValue(c *elton.Context) string {
+	arr := strings.Split(c.GetRequestHeader(xCaptchaHeader), ":")
+	if len(arr) != 2 {
+		return ""
+	}
+	return arr[1]
+}
+
 // ValidateCaptcha 图形难码校验
 func ValidateCaptcha(magicalCaptcha string) elton.Handler {
 	return func(c *elton.Context) (err error) {
@@ -78,6 +78,20 @@ func TestWaitFor(t *testing.T) {
 	})
 }
 
+func TestGetCaptchaValue(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	c := elton.NewContext(nil, req)
+	assert.Equal("", GetCaptchaValue(c))
+
+	req.Header.Set(xCaptchaHeader, "abc")
+	assert.Equal("", GetCaptchaValue(c))
+
+	req.Header.Set(xCaptchaHeader, "abc:123456")
+	assert.Equal("123456", GetCaptchaValue(c))
+}
+
 func TestValidateCaptcha(t *testing.T) {
 	assert := assert.New(t)
 
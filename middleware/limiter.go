@@ -30,6 +30,7 @@ const (
 	concurrentLimitKeyPrefix = "midConcurrentLimit"
 	ipLimitKeyPrefix         = "midIPLimit"
 	errorLimitKeyPrefix      = "midErrorLimit"
+	cooldownLimitKeyPrefix   = "midCooldownLimit"
 	errLimitCategory         = "requestLimit"
 )
 
@@ -123,3 +124,25 @@ func NewErrorLimit(maxCount int64, ttl time.Duration, fn KeyGenerator) elton.Han
 		return
 	}
 }
+
+// NewCooldownLimit 创建冷却时间限制中间件，成功处理后在ttl内不允许再次调用，
+// 如果处理出错则清除限制，允许直接重试
+func NewCooldownLimit(ttl time.Duration, prefix string, fn KeyGenerator) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		ctx := c.Context()
+		key := cooldownLimitKeyPrefix + "-" + prefix + "-" + fn(c)
+		success, err := redisSrv.Lock(ctx, key, ttl)
+		if err != nil {
+			return
+		}
+		if !success {
+			err = hes.New("请求过于频繁，请稍候再试！", errLimitCategory)
+			return
+		}
+		err = c.Next()
+		if err != nil {
+			_, _ = redisSrv.Del(ctx, key)
+		}
+		return
+	}
+}
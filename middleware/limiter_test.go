@@ -116,3 +116,33 @@ func TestNewErrorLimit(t *testing.T) {
 	err = fn(c)
 	assert.Equal("请求过于频繁，请稍候再试！(1/1)", err.(*hes.Error).Message)
 }
+
+func TestNewCooldownLimit(t *testing.T) {
+	assert := assert.New(t)
+	fn := NewCooldownLimit(10*time.Millisecond, "TestNewCooldownLimit", func(c *elton.Context) string {
+		return "account"
+	})
+	c := elton.NewContext(nil, httptest.NewRequest("GET", "/", nil))
+	customErr := errors.New("abc")
+	c.Next = func() error {
+		return customErr
+	}
+	// 处理出错时，不限制重试
+	err := fn(c)
+	assert.Equal(customErr, err)
+
+	c.Next = func() error {
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+
+	// 冷却时间内，则拦截
+	err = fn(c)
+	assert.Equal("请求过于频繁，请稍候再试！", err.(*hes.Error).Message)
+
+	// 冷却时间过后可正常执行
+	time.Sleep(20 * time.Millisecond)
+	err = fn(c)
+	assert.Nil(err)
+}
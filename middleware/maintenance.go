@@ -0,0 +1,68 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+const errMaintenanceCategory = "maintenance"
+
+type GetMaintenanceWindowFunc func(route string) *service.MaintenanceWindow
+
+// MaintenanceConfig 维护中间件的配置
+type MaintenanceConfig struct {
+	// 获取路由当前的维护信息，非维护中返回nil
+	GetWindow GetMaintenanceWindowFunc
+	// 路由维护中时才执行，用于加载Skip判断所需的数据（如用户session），需调用c.Next()
+	Prepare elton.Handler
+	// 判断是否不受维护影响（如管理员）
+	Skip func(c *elton.Context) bool
+}
+
+// NewMaintenance create a maintenance middleware, which returns 503 for routes in maintenance
+func NewMaintenance(config MaintenanceConfig) elton.Handler {
+	check := func(c *elton.Context) error {
+		window := config.GetWindow(c.Route)
+		if window == nil || (config.Skip != nil && config.Skip(c)) {
+			return c.Next()
+		}
+		retryAfter := int(math.Ceil(time.Until(window.EndedAt).Seconds()))
+		if retryAfter > 0 {
+			c.SetHeader("Retry-After", strconv.Itoa(retryAfter))
+		}
+		he := hes.NewWithStatusCode(window.Message, http.StatusServiceUnavailable)
+		he.Category = errMaintenanceCategory
+		return he
+	}
+	var prepareAndCheck elton.Handler = check
+	if config.Prepare != nil {
+		prepareAndCheck = elton.Compose(config.Prepare, check)
+	}
+	return func(c *elton.Context) error {
+		// 非维护中则直接跳过，避免每个请求均需加载session
+		if config.GetWindow(c.Route) == nil {
+			return c.Next()
+		}
+		return prepareAndCheck(c)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/service"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+func TestNewMaintenance(t *testing.T) {
+	assert := assert.New(t)
+
+	prepared := false
+	fn := NewMaintenance(MaintenanceConfig{
+		GetWindow: func(route string) *service.MaintenanceWindow {
+			if route != "/novels" {
+				return nil
+			}
+			return &service.MaintenanceWindow{
+				MaintenanceData: service.MaintenanceData{
+					Message: "系统维护中",
+				},
+				EndedAt: time.Now().Add(time.Minute),
+			}
+		},
+		Prepare: func(c *elton.Context) error {
+			prepared = true
+			return c.Next()
+		},
+		Skip: func(c *elton.Context) bool {
+			return c.GetRequestHeader("X-Admin") == "1"
+		},
+	})
+
+	newContext := func(route string) (*elton.Context, *bool) {
+		req := httptest.NewRequest("GET", route, nil)
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		c.Route = route
+		done := false
+		c.Next = func() error {
+			done = true
+			return nil
+		}
+		return c, &done
+	}
+
+	// 非维护中的路由不加载session
+	c, done := newContext("/users")
+	err := fn(c)
+	assert.Nil(err)
+	assert.True(*done)
+	assert.False(prepared)
+
+	// 维护中的路由返回503
+	c, done = newContext("/novels")
+	err = fn(c)
+	assert.True(prepared)
+	assert.False(*done)
+	he, ok := err.(*hes.Error)
+	assert.True(ok)
+	assert.Equal(http.StatusServiceUnavailable, he.StatusCode)
+	assert.Equal("系统维护中", he.Message)
+	assert.Equal("60", c.GetHeader("Retry-After"))
+
+	// 管理员不受影响
+	c, done = newContext("/novels")
+	c.Request.Header.Set("X-Admin", "1")
+	err = fn(c)
+	assert.Nil(err)
+	assert.True(*done)
+}
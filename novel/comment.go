@@ -0,0 +1,92 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 段评相关处理
+
+package novel
+
+import (
+	"context"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/paragraphcomment"
+	"github.com/vicanso/elite/ent/paragraphcommentaction"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/hes"
+)
+
+// ParagraphCommentCount 段落的评论数
+type ParagraphCommentCount struct {
+	Paragraph string `json:"paragraph"`
+	Count     int    `json:"count"`
+}
+
+// CountParagraphComments 统计章节各段落的评论数（仅统计正常状态的评论）
+func (*Srv) CountParagraphComments(ctx context.Context, novelID, no int) (counts []*ParagraphCommentCount, err error) {
+	counts = make([]*ParagraphCommentCount, 0)
+	err = getEntClient().ParagraphComment.Query().
+		Where(paragraphcomment.Novel(novelID)).
+		Where(paragraphcomment.No(no)).
+		Where(paragraphcomment.Status(schema.ParagraphCommentStatusNormal)).
+		GroupBy(paragraphcomment.FieldParagraph).
+		Aggregate(ent.Count()).
+		Scan(ctx, &counts)
+	return
+}
+
+// AddParagraphCommentAction 点赞或举报段评，每个账户仅可操作一次，返回操作后的段评
+func (*Srv) AddParagraphCommentAction(ctx context.Context, id int, account, action string) (result *ent.ParagraphComment, err error) {
+	tx, err := getEntClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	rollback := func(e error) {
+		_ = tx.Rollback()
+		err = e
+	}
+	result, err = tx.ParagraphComment.Get(ctx, id)
+	if err != nil {
+		rollback(err)
+		return
+	}
+	if result.Status != schema.ParagraphCommentStatusNormal {
+		rollback(hes.New("该评论已被隐藏", errNovelCategory))
+		return
+	}
+	_, err = tx.ParagraphCommentAction.Create().
+		SetComment(id).
+		SetAccount(account).
+		SetAction(paragraphcommentaction.Action(action)).
+		Save(ctx)
+	if err != nil {
+		if ent.IsConstraintError(err) {
+			err = hes.New("请勿重复操作", errNovelCategory)
+		}
+		rollback(err)
+		return
+	}
+	update := tx.ParagraphComment.UpdateOneID(id)
+	if action == schema.ParagraphCommentActionLike {
+		update = update.AddLikeCount(1)
+	} else {
+		update = update.AddReportCount(1)
+	}
+	result, err = update.Save(ctx)
+	if err != nil {
+		rollback(err)
+		return
+	}
+	err = tx.Commit()
+	return
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 小说审核，包括禁止与解除禁止
+
+package novel
+
+import (
+	"context"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/novel"
+	"github.com/vicanso/elite/ent/novelmoderation"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/hes"
+)
+
+// ModerateParams 小说审核参数
+type ModerateParams struct {
+	// IDS 小说id列表
+	IDS []int
+	// Action 审核操作，ban或unban
+	Action string
+	// Reason 操作原因
+	Reason string
+	// Operator 操作者
+	Operator string
+}
+
+// IsBanned 判断小说是否禁止状态
+func (*Srv) IsBanned(ctx context.Context, id int) (banned bool, err error) {
+	result, err := getEntClient().Novel.Query().
+		Where(novel.ID(id)).
+		Select(novel.FieldStatus).
+		First(ctx)
+	if err != nil {
+		return
+	}
+	banned = result.Status == schema.NovelStatusBan
+	return
+}
+
+// moderateOne 审核单本小说，如果状态无需变化则返回false
+func (params *ModerateParams) moderateOne(ctx context.Context, tx *ent.Tx, id int) (changed bool, err error) {
+	result, err := tx.Novel.Get(ctx, id)
+	if err != nil {
+		return
+	}
+	banned := result.Status == schema.NovelStatusBan
+	status := schema.NovelStatusBan
+	switch params.Action {
+	case schema.NovelModerationActionBan:
+		if banned {
+			return
+		}
+	case schema.NovelModerationActionUnban:
+		if !banned {
+			return
+		}
+		// 恢复为禁止前的状态
+		status = schema.NovelStatusWritting
+		record, e := tx.NovelModeration.Query().
+			Where(novelmoderation.Novel(id)).
+			Where(novelmoderation.ActionEQ(novelmoderation.ActionBan)).
+			Order(ent.Desc(novelmoderation.FieldCreatedAt)).
+			First(ctx)
+		if e != nil && !ent.IsNotFound(e) {
+			err = e
+			return
+		}
+		if record != nil &&
+			record.PreviousStatus != schema.NovelStatusBan &&
+			record.PreviousStatus > schema.NovelStatusUnknown &&
+			record.PreviousStatus < schema.NovelStatusEnd {
+			status = record.PreviousStatus
+		}
+	default:
+		err = hes.New("审核操作不支持", errNovelCategory)
+		return
+	}
+	_, err = tx.NovelModeration.Create().
+		SetNovel(id).
+		SetAction(novelmoderation.Action(params.Action)).
+		SetPreviousStatus(result.Status).
+		SetReason(params.Reason).
+		SetOperator(params.Operator).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.Novel.UpdateOneID(id).
+		SetStatus(status).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	changed = true
+	return
+}
+
+// Moderate 批量审核小说并记录审核日志，返回状态有变化的小说数量
+func (*Srv) Moderate(ctx context.Context, params ModerateParams) (count int, err error) {
+	tx, err := getEntClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	for _, id := range params.IDS {
+		changed, e := params.moderateOne(ctx, tx, id)
+		if e != nil {
+			_ = tx.Rollback()
+			err = e
+			return
+		}
+		if changed {
+			count++
+		}
+	}
+	err = tx.Commit()
+	return
+}
@@ -585,25 +585,6 @@ func (srv *Srv) GetChapterDetail(novelID, no int) (result *ent.Chapter, err erro
 	return
 }
 
-// UpdateChapterContent 更新章节内容
-func (srv *Srv) UpdateChapterContent(novelID, no int, content string) (*ent.Chapter, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*defaultQueryTimeout)
-	defer cancel()
-
-	chapter, err := getEntClient().Chapter.Query().
-		Where(chapter.NovelEQ(novelID)).
-		Where(chapter.NoEQ(no)).
-		First(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return getEntClient().Chapter.
-		UpdateOneID(chapter.ID).
-		SetContent(content).
-		SetWordCount(len(content)).
-		Save(ctx)
-}
-
 // GetCover 获取小说封面
 func (*Srv) GetCover(id int) (cover string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
@@ -0,0 +1,187 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 章节内容按段落分页读取
+
+package novel
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/chapter"
+)
+
+type (
+	// Paragraph 章节段落
+	Paragraph struct {
+		// ID 段落id，由段落内容生成，内容不变则id不变
+		ID      string `json:"id"`
+		Index   int    `json:"index"`
+		Content string `json:"content"`
+	}
+	// ChapterNeighbor 相邻章节信息
+	ChapterNeighbor struct {
+		No    int    `json:"no"`
+		Title string `json:"title"`
+	}
+	// ChapterParagraphs 章节段落分页数据
+	ChapterParagraphs struct {
+		Novel     int    `json:"novel"`
+		No        int    `json:"no"`
+		Title     string `json:"title"`
+		WordCount int    `json:"wordCount"`
+		// Hash 章节内容的hash
+		Hash string `json:"hash"`
+		// Total 段落总数
+		Total      int          `json:"total"`
+		Offset     int          `json:"offset"`
+		Paragraphs []*Paragraph `json:"paragraphs"`
+		// Prev 上一章节，第一章时为空
+		Prev *ChapterNeighbor `json:"prev"`
+		// Next 下一章节，最后一章时为空
+		Next *ChapterNeighbor `json:"next"`
+	}
+	// ChapterParagraphsParams 章节段落查询参数
+	ChapterParagraphsParams struct {
+		NovelID int
+		No      int
+		Offset  int
+		Limit   int
+	}
+)
+
+// hashString 计算字符串的sha1
+func hashString(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// SplitParagraphs 将章节内容按行拆分为段落，忽略空行。
+// 段落id由段落内容的hash生成，相同内容的段落以出现次数区分
+func SplitParagraphs(content string) []*Paragraph {
+	lines := strings.Split(content, "\n")
+	paragraphs := make([]*Paragraph, 0, len(lines))
+	counts := make(map[string]int)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		id := hashString(line)[:12]
+		count := counts[id]
+		counts[id] = count + 1
+		if count != 0 {
+			id = fmt.Sprintf("%s-%d", id, count)
+		}
+		paragraphs = append(paragraphs, &Paragraph{
+			ID:      id,
+			Index:   len(paragraphs),
+			Content: line,
+		})
+	}
+	return paragraphs
+}
+
+// ETag 根据内容hash、分页以及相邻章节生成ETag
+func (cp *ChapterParagraphs) ETag() string {
+	prev := ""
+	if cp.Prev != nil {
+		prev = fmt.Sprintf("%d:%s", cp.Prev.No, cp.Prev.Title)
+	}
+	next := ""
+	if cp.Next != nil {
+		next = fmt.Sprintf("%d:%s", cp.Next.No, cp.Next.Title)
+	}
+	value := fmt.Sprintf("%s|%s|%d|%d|%s|%s", cp.Hash, cp.Title, cp.Offset, len(cp.Paragraphs), prev, next)
+	return fmt.Sprintf(`"%s"`, hashString(value))
+}
+
+// getParagraphRange 根据段落总数、offset与limit获取分页的起止位置，
+// 超出范围的offset与limit会被限制在段落总数内，limit不大于0表示获取剩余所有段落
+func getParagraphRange(total, offset, limit int) (start, end int) {
+	start = offset
+	if start < 0 {
+		start = 0
+	}
+	if start > total {
+		start = total
+	}
+	end = total
+	if limit > 0 && start+limit < total {
+		end = start + limit
+	}
+	return
+}
+
+// getChapterNeighbor 获取相邻章节，prev为true时获取上一章节
+func getChapterNeighbor(ctx context.Context, novelID, no int, prev bool) (*ChapterNeighbor, error) {
+	query := getEntClient().Chapter.Query().
+		Where(chapter.NovelEQ(novelID))
+	if prev {
+		query = query.Where(chapter.NoLT(no)).
+			Order(ent.Desc(chapter.FieldNo))
+	} else {
+		query = query.Where(chapter.NoGT(no)).
+			Order(ent.Asc(chapter.FieldNo))
+	}
+	result, err := query.Select(chapter.FieldNo, chapter.FieldTitle).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ChapterNeighbor{
+		No:    result.No,
+		Title: result.Title,
+	}, nil
+}
+
+// GetChapterParagraphs 获取章节的段落分页数据以及相邻章节信息
+func (srv *Srv) GetChapterParagraphs(ctx context.Context, params ChapterParagraphsParams) (result *ChapterParagraphs, err error) {
+	detail, err := srv.GetChapterDetail(params.NovelID, params.No)
+	if err != nil {
+		return
+	}
+	paragraphs := SplitParagraphs(detail.Content)
+	total := len(paragraphs)
+	start, end := getParagraphRange(total, params.Offset, params.Limit)
+	prev, err := getChapterNeighbor(ctx, params.NovelID, params.No, true)
+	if err != nil {
+		return
+	}
+	next, err := getChapterNeighbor(ctx, params.NovelID, params.No, false)
+	if err != nil {
+		return
+	}
+	result = &ChapterParagraphs{
+		Novel:      params.NovelID,
+		No:         params.No,
+		Title:      detail.Title,
+		WordCount:  detail.WordCount,
+		Hash:       hashString(detail.Content),
+		Total:      total,
+		Offset:     start,
+		Paragraphs: paragraphs[start:end],
+		Prev:       prev,
+		Next:       next,
+	}
+	return
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package novel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitParagraphs(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		content  string
+		contents []string
+	}{
+		{
+			content:  "",
+			contents: []string{},
+		},
+		{
+			content:  "\n  \n\t\n",
+			contents: []string{},
+		},
+		{
+			content:  "第一段\n\n  第二段  \r\n\n第三段",
+			contents: []string{"第一段", "第二段", "第三段"},
+		},
+	}
+	for _, tt := range tests {
+		paragraphs := SplitParagraphs(tt.content)
+		contents := make([]string, len(paragraphs))
+		for index, p := range paragraphs {
+			contents[index] = p.Content
+			assert.Equal(index, p.Index)
+		}
+		assert.Equal(tt.contents, contents)
+	}
+
+	// 段落id由内容生成，插入其它段落或空行不影响原有段落的id
+	paragraphs := SplitParagraphs("第一段\n第二段")
+	updatedParagraphs := SplitParagraphs("新增段落\n\n第一段\n\n第二段")
+	assert.Equal(paragraphs[0].ID, updatedParagraphs[1].ID)
+	assert.Equal(paragraphs[1].ID, updatedParagraphs[2].ID)
+	assert.NotEqual(paragraphs[0].ID, paragraphs[1].ID)
+
+	// 相同内容的段落以出现次数区分
+	paragraphs = SplitParagraphs("重复\n重复\n重复")
+	assert.Equal(paragraphs[0].ID+"-1", paragraphs[1].ID)
+	assert.Equal(paragraphs[0].ID+"-2", paragraphs[2].ID)
+}
+
+func TestChapterParagraphsETag(t *testing.T) {
+	assert := assert.New(t)
+
+	newChapterParagraphs := func(content string) *ChapterParagraphs {
+		return &ChapterParagraphs{
+			Title:      "第一章",
+			Hash:       hashString(content),
+			Paragraphs: SplitParagraphs(content),
+		}
+	}
+	cp := newChapterParagraphs("第一段\n第二段")
+	eTag := cp.ETag()
+	assert.Equal(eTag, newChapterParagraphs("第一段\n第二段").ETag())
+	assert.Equal(`"`, eTag[:1])
+
+	tests := []func(cp *ChapterParagraphs){
+		// 内容变化
+		func(cp *ChapterParagraphs) {
+			*cp = *newChapterParagraphs("第一段\n第二段修改")
+		},
+		// 标题变化
+		func(cp *ChapterParagraphs) {
+			cp.Title = "第一章（修订）"
+		},
+		// 分页变化
+		func(cp *ChapterParagraphs) {
+			cp.Offset = 1
+			cp.Paragraphs = cp.Paragraphs[1:]
+		},
+		// 相邻章节变化
+		func(cp *ChapterParagraphs) {
+			cp.Next = &ChapterNeighbor{
+				No:    2,
+				Title: "第二章",
+			}
+		},
+	}
+	for _, fn := range tests {
+		cp := newChapterParagraphs("第一段\n第二段")
+		fn(cp)
+		assert.NotEqual(eTag, cp.ETag())
+	}
+}
+
+func TestGetParagraphRange(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		total  int
+		offset int
+		limit  int
+		start  int
+		end    int
+	}{
+		{total: 10, offset: 0, limit: 3, start: 0, end: 3},
+		{total: 10, offset: 8, limit: 3, start: 8, end: 10},
+		{total: 10, offset: 2, limit: 0, start: 2, end: 10},
+		{total: 10, offset: 10, limit: 3, start: 10, end: 10},
+		{total: 10, offset: 20, limit: 3, start: 10, end: 10},
+		{total: 10, offset: -1, limit: 3, start: 0, end: 3},
+		{total: 10, offset: 0, limit: 100, start: 0, end: 10},
+		{total: 0, offset: 0, limit: 3, start: 0, end: 0},
+	}
+	for _, tt := range tests {
+		start, end := getParagraphRange(tt.total, tt.offset, tt.limit)
+		assert.Equal(tt.start, start)
+		assert.Equal(tt.end, end)
+	}
+}
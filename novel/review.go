@@ -0,0 +1,232 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 小说书评与评分，评分的汇总信息在书评增删改时增量更新至小说
+
+package novel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/novelreviewvote"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/hes"
+)
+
+var novelReviewConfig = config.GetNovelReviewConfig()
+
+// 已阅读章节记录的有效期
+const novelReadChaptersTTL = 180 * 24 * time.Hour
+
+// ReviewParams 书评参数
+type ReviewParams struct {
+	Novel   int
+	Account string
+	Rating  int
+	Content string
+}
+
+// getReadChaptersKey 获取已阅读章节记录的key
+func getReadChaptersKey(account string, novelID int) string {
+	return fmt.Sprintf("novelReadChapters:%s:%d", account, novelID)
+}
+
+// RecordChapterRead 记录用户已阅读的章节
+func (*Srv) RecordChapterRead(ctx context.Context, account string, novelID, no int) (err error) {
+	key := getReadChaptersKey(account, novelID)
+	pipe := helper.RedisGetClient().TxPipeline()
+	pipe.SAdd(ctx, key, no)
+	pipe.Expire(ctx, key, novelReadChaptersTTL)
+	_, err = pipe.Exec(ctx)
+	return
+}
+
+// CountReadChapters 获取用户已阅读的章节数
+func (*Srv) CountReadChapters(ctx context.Context, account string, novelID int) (count int, err error) {
+	result, err := helper.RedisGetClient().SCard(ctx, getReadChaptersKey(account, novelID)).Result()
+	if err != nil {
+		return
+	}
+	count = int(result)
+	return
+}
+
+// updateRating 增量更新小说的评分汇总，oldRating为0表示新增，newRating为0表示删除。
+// 先以原子增量的方式更新评分人数与总和，此时该记录已被当前事务锁定，
+// 再基于更新后的数据计算分布与平均分，保证并发时汇总数据的正确
+func updateRating(ctx context.Context, tx *ent.Tx, novelID, oldRating, newRating int) (err error) {
+	countDelta := 0
+	if oldRating == 0 {
+		countDelta++
+	}
+	if newRating == 0 {
+		countDelta--
+	}
+	result, err := tx.Novel.UpdateOneID(novelID).
+		AddRatingCount(countDelta).
+		AddRatingSum(newRating - oldRating).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	distribution := make([]int, schema.NovelReviewRatingMax)
+	copy(distribution, result.RatingDistribution)
+	if oldRating != 0 && distribution[oldRating-1] > 0 {
+		distribution[oldRating-1]--
+	}
+	if newRating != 0 {
+		distribution[newRating-1]++
+	}
+	rating := 0.0
+	if result.RatingCount > 0 {
+		rating = float64(result.RatingSum) / float64(result.RatingCount)
+		// 保留两位小数
+		rating = math.Round(rating*100) / 100
+	}
+	_, err = tx.Novel.UpdateOneID(novelID).
+		SetRatingDistribution(distribution).
+		SetRating(rating).
+		Save(ctx)
+	return
+}
+
+// withTx 在事务中执行，出错时回滚
+func withTx(ctx context.Context, fn func(tx *ent.Tx) error) (err error) {
+	tx, err := getEntClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// AddReview 发表书评，需要阅读足够的章节，且每个账户每本小说仅可发表一篇
+func (srv *Srv) AddReview(ctx context.Context, params ReviewParams) (result *ent.NovelReview, err error) {
+	count, err := srv.CountReadChapters(ctx, params.Account, params.Novel)
+	if err != nil {
+		return
+	}
+	if count < novelReviewConfig.MinReadChapters {
+		err = hes.New(fmt.Sprintf("至少阅读%d个章节才可发表书评", novelReviewConfig.MinReadChapters), errNovelCategory)
+		return
+	}
+	err = withTx(ctx, func(tx *ent.Tx) error {
+		var e error
+		result, e = tx.NovelReview.Create().
+			SetNovel(params.Novel).
+			SetAccount(params.Account).
+			SetRating(params.Rating).
+			SetContent(params.Content).
+			Save(ctx)
+		if e != nil {
+			if ent.IsConstraintError(e) {
+				e = hes.New("已发表过书评，请勿重复发表", errNovelCategory)
+			}
+			return e
+		}
+		return updateRating(ctx, tx, params.Novel, 0, params.Rating)
+	})
+	return
+}
+
+// UpdateReview 更新书评，仅可更新自己的书评
+func (*Srv) UpdateReview(ctx context.Context, id int, params ReviewParams) (result *ent.NovelReview, err error) {
+	err = withTx(ctx, func(tx *ent.Tx) error {
+		review, e := tx.NovelReview.Get(ctx, id)
+		if e != nil {
+			return e
+		}
+		if review.Account != params.Account {
+			return hes.New("仅可修改自己的书评", errNovelCategory)
+		}
+		update := review.Update()
+		if params.Content != "" {
+			update = update.SetContent(params.Content)
+		}
+		if params.Rating != 0 {
+			update = update.SetRating(params.Rating)
+		}
+		result, e = update.Save(ctx)
+		if e != nil {
+			return e
+		}
+		if params.Rating == 0 || params.Rating == review.Rating {
+			return nil
+		}
+		return updateRating(ctx, tx, review.Novel, review.Rating, params.Rating)
+	})
+	return
+}
+
+// DeleteReview 删除书评以及书评的投票，account为空时表示管理员删除，不校验账户
+func (*Srv) DeleteReview(ctx context.Context, id int, account string) (err error) {
+	return withTx(ctx, func(tx *ent.Tx) error {
+		review, e := tx.NovelReview.Get(ctx, id)
+		if e != nil {
+			return e
+		}
+		if account != "" && review.Account != account {
+			return hes.New("仅可删除自己的书评", errNovelCategory)
+		}
+		_, e = tx.NovelReviewVote.Delete().
+			Where(novelreviewvote.Review(id)).
+			Exec(ctx)
+		if e != nil {
+			return e
+		}
+		e = tx.NovelReview.DeleteOne(review).Exec(ctx)
+		if e != nil {
+			return e
+		}
+		return updateRating(ctx, tx, review.Novel, review.Rating, 0)
+	})
+}
+
+// VoteReviewHelpful 认为书评有帮助，每个账户仅可投票一次且不可为自己的书评投票
+func (*Srv) VoteReviewHelpful(ctx context.Context, id int, account string) (result *ent.NovelReview, err error) {
+	err = withTx(ctx, func(tx *ent.Tx) error {
+		review, e := tx.NovelReview.Get(ctx, id)
+		if e != nil {
+			return e
+		}
+		if review.Account == account {
+			return hes.New("不可为自己的书评投票", errNovelCategory)
+		}
+		_, e = tx.NovelReviewVote.Create().
+			SetReview(id).
+			SetAccount(account).
+			Save(ctx)
+		if e != nil {
+			if ent.IsConstraintError(e) {
+				e = hes.New("请勿重复投票", errNovelCategory)
+			}
+			return e
+		}
+		result, e = review.Update().
+			AddHelpfulCount(1).
+			Save(ctx)
+		return e
+	})
+	return
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 章节内容修订记录，每次修改章节内容均生成新的修订版本
+
+package novel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/chapter"
+	"github.com/vicanso/elite/ent/chapterrevision"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+)
+
+// 首次修订时记录原始内容所使用的修订者
+const chapterRevisionOriginEditor = "system"
+
+// ChapterUpdateParams 章节内容更新参数
+type ChapterUpdateParams struct {
+	// NovelID 小说id
+	NovelID int
+	// No 章节序号
+	No int
+	// Content 章节内容
+	Content string
+	// Editor 修订者
+	Editor string
+	// Reason 修订原因
+	Reason string
+}
+
+// ChapterRevisionDiff 章节修订版本对比
+type ChapterRevisionDiff struct {
+	// From 对比的源版本，0表示空内容
+	From int `json:"from"`
+	// To 对比的目标版本
+	To int `json:"to"`
+	// Size 变更的字符数
+	Size  int             `json:"size"`
+	Lines []util.DiffLine `json:"lines"`
+}
+
+// chapterRevisionQuery 章节修订记录查询
+func chapterRevisionQuery(client *ent.ChapterRevisionClient, novelID, no int) *ent.ChapterRevisionQuery {
+	return client.Query().
+		Where(chapterrevision.Novel(novelID)).
+		Where(chapterrevision.No(no))
+}
+
+// update 更新章节内容并生成修订记录，内容无变化时不生成修订记录
+func (params *ChapterUpdateParams) update(ctx context.Context, tx *ent.Tx) (result *ent.Chapter, err error) {
+	result, err = tx.Chapter.Query().
+		Where(chapter.NovelEQ(params.NovelID)).
+		Where(chapter.NoEQ(params.No)).
+		First(ctx)
+	if err != nil {
+		return
+	}
+	if result.Content == params.Content {
+		return
+	}
+	latest, err := chapterRevisionQuery(tx.ChapterRevision, params.NovelID, params.No).
+		Order(ent.Desc(chapterrevision.FieldVersion)).
+		First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return
+	}
+	err = nil
+	version := 0
+	if latest != nil {
+		version = latest.Version
+	}
+	// 首次修订时，先保存原始内容，以便可回滚至原始版本
+	if version == 0 && result.Content != "" {
+		version++
+		_, err = tx.ChapterRevision.Create().
+			SetNovel(params.NovelID).
+			SetNo(params.No).
+			SetVersion(version).
+			SetContent(result.Content).
+			SetWordCount(result.WordCount).
+			SetDiffSize(util.DiffSize(util.DiffLines("", result.Content))).
+			SetEditor(chapterRevisionOriginEditor).
+			Save(ctx)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.ChapterRevision.Create().
+		SetNovel(params.NovelID).
+		SetNo(params.No).
+		SetVersion(version + 1).
+		SetContent(params.Content).
+		SetWordCount(len(params.Content)).
+		SetDiffSize(util.DiffSize(util.DiffLines(result.Content, params.Content))).
+		SetEditor(params.Editor).
+		SetReason(params.Reason).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	return tx.Chapter.UpdateOneID(result.ID).
+		SetContent(params.Content).
+		SetWordCount(len(params.Content)).
+		Save(ctx)
+}
+
+// UpdateChapterContent 更新章节内容，并记录修订版本
+func (*Srv) UpdateChapterContent(params ChapterUpdateParams) (result *ent.Chapter, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*defaultQueryTimeout)
+	defer cancel()
+	tx, err := getEntClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	result, err = params.update(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// GetChapterRevision 获取章节指定版本的修订记录
+func (*Srv) GetChapterRevision(ctx context.Context, novelID, no, version int) (*ent.ChapterRevision, error) {
+	return chapterRevisionQuery(getEntClient().ChapterRevision, novelID, no).
+		Where(chapterrevision.Version(version)).
+		First(ctx)
+}
+
+// DiffChapterRevision 对比章节的两个修订版本，from为0时与上一版本对比
+func (srv *Srv) DiffChapterRevision(ctx context.Context, novelID, no, from, to int) (diff *ChapterRevisionDiff, err error) {
+	target, err := srv.GetChapterRevision(ctx, novelID, no, to)
+	if err != nil {
+		return
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from >= to {
+		err = hes.New("对比的源版本需小于目标版本", errNovelCategory)
+		return
+	}
+	content := ""
+	// 版本号从1开始，第一个版本与空内容对比
+	if from > 0 {
+		source, e := srv.GetChapterRevision(ctx, novelID, no, from)
+		if e != nil {
+			err = e
+			return
+		}
+		content = source.Content
+	}
+	lines := util.DiffLines(content, target.Content)
+	diff = &ChapterRevisionDiff{
+		From:  from,
+		To:    to,
+		Size:  util.DiffSize(lines),
+		Lines: lines,
+	}
+	return
+}
+
+// RollbackChapter 将章节内容回滚至指定版本，回滚也会生成新的修订版本
+func (srv *Srv) RollbackChapter(ctx context.Context, novelID, no, version int, editor string) (*ent.Chapter, error) {
+	revision, err := srv.GetChapterRevision(ctx, novelID, no, version)
+	if err != nil {
+		return nil, err
+	}
+	return srv.UpdateChapterContent(ChapterUpdateParams{
+		NovelID: novelID,
+		No:      no,
+		Content: revision.Content,
+		Editor:  editor,
+		Reason:  fmt.Sprintf("回滚至版本%d", version),
+	})
+}
@@ -0,0 +1,323 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/vicanso/go-axios"
+)
+
+const (
+	// 校验时间时允许的误差
+	clockSkew = time.Minute
+	// 未找到对应key时重新拉取JWKS的最小间隔
+	jwksRefreshInterval = time.Minute
+)
+
+type (
+	// jwk JSON web key，仅支持RSA与EC(P-256)
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	// jwks JSON web key set
+	jwks struct {
+		keys      map[string]crypto.PublicKey
+		fetchedAt time.Time
+	}
+	// jwtHeader JWT的头部
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	// IDToken ID token中的数据
+	IDToken struct {
+		Issuer        string
+		Subject       string
+		Email         string
+		EmailVerified bool
+		Name          string
+		// 所有的数据
+		Claims map[string]interface{}
+	}
+)
+
+// decodeSegment 解码base64url的数据（无填充）
+func decodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+}
+
+// toPublicKey 转换为公钥
+func (key *jwk) toPublicKey() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeSegment(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(key.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() <= 1 {
+			return nil, errIDTokenInvalid
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, errIDTokenInvalid
+		}
+		x, err := decodeSegment(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errIDTokenInvalid
+		}
+		return pub, nil
+	}
+	return nil, errIDTokenInvalid
+}
+
+// fetchJWKS 拉取JWKS，忽略不支持或非签名用途的key
+func (p *Provider) fetchJWKS(ctx context.Context) (*jwks, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	err = p.ins.EnhanceRequest(&result, &axios.Config{
+		Context: ctx,
+		URL:     discovery.JWKSURI,
+	})
+	if err != nil {
+		return nil, err
+	}
+	keySet := &jwks{
+		keys:      make(map[string]crypto.PublicKey),
+		fetchedAt: time.Now(),
+	}
+	for _, item := range result.Keys {
+		if item.Use != "" && item.Use != "sig" {
+			continue
+		}
+		key, e := item.toPublicKey()
+		if e != nil {
+			continue
+		}
+		keySet.keys[item.Kid] = key
+	}
+	return keySet, nil
+}
+
+// getKey 获取kid对应的公钥，未找到时重新拉取（key轮换）
+func (p *Provider) getKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mutex.RLock()
+	keySet := p.jwks
+	p.mutex.RUnlock()
+	if keySet != nil {
+		if key, ok := keySet.keys[kid]; ok {
+			return key, nil
+		}
+		// 避免无效的kid导致频繁拉取
+		if time.Since(keySet.fetchedAt) < jwksRefreshInterval {
+			return nil, errIDTokenInvalid
+		}
+	}
+	keySet, err := p.fetchJWKS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	p.jwks = keySet
+	p.mutex.Unlock()
+	key, ok := keySet.keys[kid]
+	if !ok {
+		return nil, errIDTokenInvalid
+	}
+	return key, nil
+}
+
+// verifySignature 校验签名，仅支持RS256与ES256
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, sig []byte) bool {
+	hash := sha256.Sum256([]byte(signingInput))
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, hash[:], r, s)
+	}
+	return false
+}
+
+// containsAudience 判断aud（字符串或数组）中是否包含client id
+func containsAudience(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok && str == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getNumericDate 获取数值类型的时间
+func getNumericDate(claims map[string]interface{}, key string) (time.Time, bool) {
+	value, ok := claims[key].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Verify 校验ID token的签名、issuer、audience、有效期与nonce
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	arr := strings.Split(rawIDToken, ".")
+	if len(arr) != 3 {
+		return nil, errIDTokenInvalid
+	}
+	buf, err := decodeSegment(arr[0])
+	if err != nil {
+		return nil, errIDTokenInvalid
+	}
+	header := jwtHeader{}
+	err = json.Unmarshal(buf, &header)
+	if err != nil {
+		return nil, errIDTokenInvalid
+	}
+	sig, err := decodeSegment(arr[2])
+	if err != nil {
+		return nil, errIDTokenInvalid
+	}
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(header.Alg, key, arr[0]+"."+arr[1], sig) {
+		return nil, errIDTokenInvalid
+	}
+
+	buf, err = decodeSegment(arr[1])
+	if err != nil {
+		return nil, errIDTokenInvalid
+	}
+	claims := make(map[string]interface{})
+	err = json.Unmarshal(buf, &claims)
+	if err != nil {
+		return nil, errIDTokenInvalid
+	}
+	token := &IDToken{
+		Claims: claims,
+	}
+	token.Issuer, _ = claims["iss"].(string)
+	token.Subject, _ = claims["sub"].(string)
+	token.Email, _ = claims["email"].(string)
+	token.EmailVerified, _ = claims["email_verified"].(bool)
+	token.Name, _ = claims["name"].(string)
+	tokenNonce, _ := claims["nonce"].(string)
+
+	if token.Issuer != p.Config.Issuer ||
+		token.Subject == "" ||
+		!containsAudience(claims["aud"], p.Config.ClientID) ||
+		tokenNonce != nonce {
+		return nil, errIDTokenInvalid
+	}
+	now := time.Now()
+	expiredAt, ok := getNumericDate(claims, "exp")
+	if !ok || now.After(expiredAt.Add(clockSkew)) {
+		return nil, errIDTokenInvalid
+	}
+	if issuedAt, ok := getNumericDate(claims, "iat"); ok && issuedAt.After(now.Add(clockSkew)) {
+		return nil, errIDTokenInvalid
+	}
+	return token, nil
+}
+
+// GetRoles 根据配置的角色字段与映射获取ID token对应的用户角色，
+// 第二个返回值为由provider管理的所有用户角色
+func (p *Provider) GetRoles(token *IDToken) (roles []string, managedRoles []string) {
+	mapping := p.Config.RoleMapping
+	for _, role := range mapping {
+		managedRoles = append(managedRoles, role)
+	}
+	if p.Config.RolesClaim == "" || len(mapping) == 0 {
+		return
+	}
+	values := make([]string, 0)
+	switch value := token.Claims[p.Config.RolesClaim].(type) {
+	case string:
+		values = append(values, value)
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+	for _, value := range values {
+		// 配置的key已转换为小写
+		role, ok := mapping[strings.ToLower(value)]
+		if ok {
+			roles = append(roles, role)
+		}
+	}
+	return
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// OpenID Connect登录，使用授权码模式（PKCE），
+// 通过discovery文档获取provider的相关地址，并使用JWKS校验ID token
+
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/request"
+	"github.com/vicanso/go-axios"
+	"github.com/vicanso/hes"
+)
+
+const (
+	errOIDCCategory = "oidc"
+	// discoveryPath discovery文档的路径
+	discoveryPath = "/.well-known/openid-configuration"
+	// discoveryTTL discovery文档的缓存时长
+	discoveryTTL = time.Hour
+)
+
+var (
+	// ErrProviderNotFound provider不存在
+	ErrProviderNotFound = &hes.Error{
+		Message:    "登录方式不存在",
+		StatusCode: http.StatusNotFound,
+		Category:   errOIDCCategory,
+	}
+	errIDTokenInvalid = newError("ID token无效")
+)
+
+type (
+	// Discovery discovery文档中使用的字段
+	Discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	// tokenResp 授权码换取token的响应
+	tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		IDToken     string `json:"id_token"`
+	}
+	// Provider OpenID Connect provider
+	Provider struct {
+		Config      config.OIDCProviderConfig
+		redirectURL string
+		ins         *axios.Instance
+
+		mutex        sync.RWMutex
+		discovery    *Discovery
+		discoveredAt time.Time
+		jwks         *jwks
+	}
+)
+
+var providers = newProviders()
+
+func newError(message string) *hes.Error {
+	return &hes.Error{
+		Message:    message,
+		StatusCode: http.StatusBadRequest,
+		Category:   errOIDCCategory,
+	}
+}
+
+func newProviders() map[string]*Provider {
+	oidcConfig := config.GetOIDCConfig()
+	result := make(map[string]*Provider)
+	for _, item := range oidcConfig.Providers {
+		redirectURL := strings.ReplaceAll(oidcConfig.RedirectURL, "{provider}", item.Name)
+		result[item.Name] = NewProvider(item, redirectURL, oidcConfig.Timeout)
+	}
+	return result
+}
+
+// NewProvider 创建provider
+func NewProvider(conf config.OIDCProviderConfig, redirectURL string, timeout time.Duration) *Provider {
+	return &Provider{
+		Config:      conf,
+		redirectURL: redirectURL,
+		ins:         request.NewHTTP("oidc-"+conf.Name, "", timeout),
+	}
+}
+
+// GetProvider 获取provider
+func GetProvider(name string) (*Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// ListProviders 获取所有provider
+func ListProviders() []*Provider {
+	result := make([]*Provider, 0, len(providers))
+	for _, item := range config.GetOIDCConfig().Providers {
+		if p, ok := providers[item.Name]; ok {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// NewCodeChallenge 根据code verifier生成PKCE的code challenge（S256）
+func NewCodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// Discover 获取discovery文档，缓存一小时
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mutex.RLock()
+	discovery := p.discovery
+	discoveredAt := p.discoveredAt
+	p.mutex.RUnlock()
+	if discovery != nil && time.Since(discoveredAt) < discoveryTTL {
+		return discovery, nil
+	}
+	result := &Discovery{}
+	err := p.ins.EnhanceRequest(result, &axios.Config{
+		Context: ctx,
+		URL:     strings.TrimSuffix(p.Config.Issuer, "/") + discoveryPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// issuer需要与配置的一致
+	if result.Issuer != p.Config.Issuer {
+		return nil, errors.New("issuer of discovery document is not match")
+	}
+	if result.AuthorizationEndpoint == "" ||
+		result.TokenEndpoint == "" ||
+		result.JWKSURI == "" {
+		return nil, errors.New("discovery document is invalid")
+	}
+	p.mutex.Lock()
+	p.discovery = result
+	p.discoveredAt = time.Now()
+	p.mutex.Unlock()
+	return result, nil
+}
+
+// AuthCodeURL 获取授权地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := append([]string{
+		"openid",
+	}, p.Config.Scopes...)
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.Config.ClientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", NewCodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	authURL := discovery.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&"
+	} else {
+		authURL += "?"
+	}
+	return authURL + query.Encode(), nil
+}
+
+// Exchange 使用授权码换取ID token并校验，返回ID token中的数据
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDToken, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("client_id", p.Config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.Config.ClientSecret != "" {
+		form.Set("client_secret", p.Config.ClientSecret)
+	}
+	result := &tokenResp{}
+	err = p.ins.EnhanceRequest(result, &axios.Config{
+		Context: ctx,
+		Method:  http.MethodPost,
+		URL:     discovery.TokenEndpoint,
+		Body:    form,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.IDToken == "" {
+		return nil, errIDTokenInvalid
+	}
+	return p.Verify(ctx, result.IDToken, nonce)
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/config"
+)
+
+// stubProvider 本地的OpenID Connect provider，用于测试
+type stubProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	// 授权码对应的nonce与code challenge
+	codes map[string][2]string
+	// 签发ID token时附加的数据
+	claims map[string]interface{}
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := &stubProvider{
+		key:      key,
+		clientID: "elite",
+		codes:    make(map[string][2]string),
+		claims:   make(map[string]interface{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 sp.server.URL,
+			"authorization_endpoint": sp.server.URL + "/authorize",
+			"token_endpoint":         sp.server.URL + "/token",
+			"jwks_uri":               sp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "k1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		data, ok := sp.codes[r.Form.Get("code")]
+		if !ok || NewCodeChallenge(r.Form.Get("code_verifier")) != data[1] {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{
+				"error": "invalid_grant",
+			})
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   sp.server.URL,
+			"sub":   "10001",
+			"aud":   sp.clientID,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": data[0],
+		}
+		for k, v := range sp.claims {
+			claims[k] = v
+		}
+		writeJSON(w, map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     sp.sign(claims),
+		})
+	})
+	sp.server = httptest.NewServer(mux)
+	return sp
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	buf, _ := json.Marshal(data)
+	_, _ = w.Write(buf)
+}
+
+// sign 使用RS256签发token
+func (sp *stubProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"kid": "k1",
+	})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, sp.key, crypto.SHA256, hash[:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (sp *stubProvider) newProvider() *Provider {
+	return NewProvider(config.OIDCProviderConfig{
+		Name:        "stub",
+		DisplayName: "Stub",
+		Issuer:      sp.server.URL,
+		ClientID:    sp.clientID,
+		Scopes: []string{
+			"email",
+		},
+		RolesClaim: "groups",
+		RoleMapping: map[string]string{
+			"elite-admins": "admin",
+		},
+	}, "http://127.0.0.1:7001/users/v1/oidc/stub/callback", 3*time.Second)
+}
+
+func TestProvider(t *testing.T) {
+	assert := assert.New(t)
+	sp := newStubProvider(t)
+	defer sp.server.Close()
+	p := sp.newProvider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	assert.Nil(err)
+	urlInfo, err := url.Parse(authURL)
+	assert.Nil(err)
+	query := urlInfo.Query()
+	assert.Equal(sp.server.URL+"/authorize", urlInfo.Scheme+"://"+urlInfo.Host+urlInfo.Path)
+	assert.Equal("openid email", query.Get("scope"))
+	assert.Equal("S256", query.Get("code_challenge_method"))
+	assert.Equal(NewCodeChallenge("verifier"), query.Get("code_challenge"))
+	assert.Equal("state", query.Get("state"))
+
+	sp.codes["code"] = [2]string{
+		"nonce",
+		query.Get("code_challenge"),
+	}
+	sp.claims["email"] = "tree@example.com"
+	sp.claims["email_verified"] = true
+	sp.claims["groups"] = []string{
+		"elite-admins",
+		"others",
+	}
+
+	// code verifier不匹配
+	_, err = p.Exchange(ctx, "code", "other", "nonce")
+	assert.NotNil(err)
+
+	// nonce不匹配
+	_, err = p.Exchange(ctx, "code", "verifier", "other")
+	assert.Equal(errIDTokenInvalid, err)
+
+	token, err := p.Exchange(ctx, "code", "verifier", "nonce")
+	assert.Nil(err)
+	assert.Equal("10001", token.Subject)
+	assert.Equal("tree@example.com", token.Email)
+	assert.True(token.EmailVerified)
+
+	roles, managedRoles := p.GetRoles(token)
+	assert.Equal([]string{"admin"}, roles)
+	assert.Equal([]string{"admin"}, managedRoles)
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	sp := newStubProvider(t)
+	defer sp.server.Close()
+	p := sp.newProvider()
+	ctx := context.Background()
+
+	newClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   sp.server.URL,
+			"sub":   "10001",
+			"aud":   []string{sp.clientID, "other"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	token, err := p.Verify(ctx, sp.sign(newClaims()), "nonce")
+	assert.Nil(err)
+	assert.Equal("10001", token.Subject)
+
+	// 已过期
+	claims := newClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.Verify(ctx, sp.sign(claims), "nonce")
+	assert.Equal(errIDTokenInvalid, err)
+
+	// audience不匹配
+	claims = newClaims()
+	claims["aud"] = "other"
+	_, err = p.Verify(ctx, sp.sign(claims), "nonce")
+	assert.Equal(errIDTokenInvalid, err)
+
+	// issuer不匹配
+	claims = newClaims()
+	claims["iss"] = "http://127.0.0.1"
+	_, err = p.Verify(ctx, sp.sign(claims), "nonce")
+	assert.Equal(errIDTokenInvalid, err)
+
+	// 签名不匹配
+	raw := sp.sign(newClaims())
+	_, err = p.Verify(ctx, raw[:len(raw)-4]+"AAAA", "nonce")
+	assert.Equal(errIDTokenInvalid, err)
+
+	// 不支持的算法
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`))
+	payload, _ := json.Marshal(newClaims())
+	_, err = p.Verify(ctx, header+"."+base64.RawURLEncoding.EncodeToString(payload)+".", "nonce")
+	assert.Equal(errIDTokenInvalid, err)
+}
@@ -53,6 +53,8 @@ func init() {
 	_, _ = c.AddFunc("0 2 * * *", clearHotKeywords)
 	_, _ = c.AddFunc("0 3 * * *", updateAllNovelCategory)
 	_, _ = c.AddFunc("0 1 * * *", updateNovelCategorySummary)
+	_, _ = c.AddFunc("@every 1h", anonymizeDeletedUsers)
+	_, _ = c.AddFunc("0 4 * * *", pruneAuditLogs)
 
 	// 如果是开发环境，则不执行定时任务
 	if util.IsDevelopment() {
@@ -250,3 +252,11 @@ func updateNovelCategorySummary() {
 	srv := novel.Srv{}
 	doTask("update novel category summary", srv.UpdateCategorySummary)
 }
+
+func anonymizeDeletedUsers() {
+	doTask("anonymize deleted users", service.AnonymizeExpiredDeletionUsers)
+}
+
+func pruneAuditLogs() {
+	doTask("prune audit logs", service.PruneAuditLogs)
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// API key的权限范围
+const (
+	// APIKeyScopeNovelRead 小说管理查询
+	APIKeyScopeNovelRead = "novel:read"
+	// APIKeyScopeNovelWrite 小说管理更新
+	APIKeyScopeNovelWrite = "novel:write"
+	// APIKeyScopeConfigRead 配置查询
+	APIKeyScopeConfigRead = "config:read"
+	// APIKeyScopeConfigWrite 配置更新
+	APIKeyScopeConfigWrite = "config:write"
+)
+
+// APIKeyScopeInfo API key权限范围信息
+type APIKeyScopeInfo struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GetAPIKeyScopeList 获取API key的权限范围列表
+func GetAPIKeyScopeList() []*APIKeyScopeInfo {
+	return []*APIKeyScopeInfo{
+		{
+			Name:  "小说查询",
+			Value: APIKeyScopeNovelRead,
+		},
+		{
+			Name:  "小说更新",
+			Value: APIKeyScopeNovelWrite,
+		},
+		{
+			Name:  "配置查询",
+			Value: APIKeyScopeConfigRead,
+		},
+		{
+			Name:  "配置更新",
+			Value: APIKeyScopeConfigWrite,
+		},
+	}
+}
+
+// APIKey holds the schema definition for the APIKey entity.
+type APIKey struct {
+	ent.Schema
+}
+
+// Mixin API key的mixin
+func (APIKey) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields API key的相关字段
+func (APIKey) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("所属账户"),
+		field.String("name").
+			NotEmpty().
+			Comment("名称"),
+		field.String("prefix").
+			NotEmpty().
+			Immutable().
+			Comment("key的前缀，用于展示区分"),
+		field.String("key_hash").
+			NotEmpty().
+			Immutable().
+			Unique().
+			Sensitive().
+			Comment("key的hash，key仅在创建时返回"),
+		field.Strings("scopes").
+			Comment("权限范围"),
+		field.Time("expired_at").
+			Optional().
+			Nillable().
+			StructTag(`json:"expiredAt,omitempty" sql:"expired_at"`).
+			Comment("过期时间，为空则不过期"),
+		field.Time("last_used_at").
+			Optional().
+			Nillable().
+			StructTag(`json:"lastUsedAt,omitempty" sql:"last_used_at"`).
+			Comment("最近使用时间"),
+		field.String("last_used_ip").
+			Optional().
+			StructTag(`json:"lastUsedIP,omitempty" sql:"last_used_ip"`).
+			Comment("最近使用的IP"),
+		field.Bool("two_factor_verified").
+			Default(false).
+			Immutable().
+			StructTag(`json:"twoFactorVerified" sql:"two_factor_verified"`).
+			Comment("创建时是否已完成两步验证，使用key访问时以此判断是否满足两步验证的要求"),
+	}
+}
+
+// Edges of the APIKey.
+func (APIKey) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes API key的索引
+func (APIKey) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("account"),
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// 审计日志的操作类型
+const (
+	// AuditActionCreate 创建
+	AuditActionCreate = "create"
+	// AuditActionUpdate 更新
+	AuditActionUpdate = "update"
+	// AuditActionDelete 删除
+	AuditActionDelete = "delete"
+)
+
+// AuditLog holds the schema definition for the AuditLog entity.
+type AuditLog struct {
+	ent.Schema
+}
+
+// Mixin 审计日志的mixin
+func (AuditLog) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 审计日志的相关字段，记录后不可修改，仅注销账户时匿名其操作者信息
+func (AuditLog) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("actor").
+			Optional().
+			Comment("操作者账号，定时任务等系统操作为空，注销后替换为匿名账户"),
+		field.String("impersonator").
+			Optional().
+			Comment("模拟登录的管理员账号，注销后替换为匿名账户"),
+		field.Enum("action").
+			Values(
+				AuditActionCreate,
+				AuditActionUpdate,
+				AuditActionDelete,
+			).
+			Immutable().
+			Comment("操作类型"),
+		field.String("entity_type").
+			StructTag(`json:"entityType" sql:"entity_type"`).
+			NotEmpty().
+			Immutable().
+			Comment("操作的数据类型"),
+		field.Int("entity_id").
+			StructTag(`json:"entityID,omitempty" sql:"entity_id"`).
+			Optional().
+			Immutable().
+			Comment("操作的数据ID，批量更新时为空"),
+		field.String("before").
+			Optional().
+			Immutable().
+			Comment("变更前的数据（json），仅包含变更的字段"),
+		field.String("after").
+			Optional().
+			Immutable().
+			Comment("变更后的数据（json），仅包含变更的字段"),
+		field.String("ip").
+			Optional().
+			Comment("操作者IP，注销后清除"),
+		field.String("trace_id").
+			StructTag(`json:"traceID,omitempty" sql:"trace_id"`).
+			Optional().
+			Immutable().
+			Comment("请求的trace id"),
+	}
+}
+
+// Edges of the AuditLog.
+func (AuditLog) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 审计日志索引
+func (AuditLog) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("actor"),
+		index.Fields("entity_type", "entity_id"),
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// ChapterRevision holds the schema definition for the ChapterRevision entity.
+type ChapterRevision struct {
+	ent.Schema
+}
+
+// Mixin 章节修订记录的mixin
+func (ChapterRevision) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 章节修订记录的相关字段
+func (ChapterRevision) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Int("no").
+			Immutable().
+			Comment("章节序号"),
+		field.Int("version").
+			Immutable().
+			Comment("修订版本号，从1开始递增"),
+		field.String("content").
+			Immutable().
+			Comment("修订后的章节内容"),
+		field.Int("word_count").
+			StructTag(`json:"wordCount" sql:"word_count"`).
+			Immutable().
+			Comment("修订后的章节字数"),
+		field.Int("diff_size").
+			StructTag(`json:"diffSize" sql:"diff_size"`).
+			Immutable().
+			Comment("与上一版本相比变更的字符数"),
+		field.String("editor").
+			Immutable().
+			Comment("修订者"),
+		field.String("reason").
+			Optional().
+			Immutable().
+			Comment("修订原因"),
+	}
+}
+
+// Edges of the ChapterRevision.
+func (ChapterRevision) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 章节修订记录索引
+func (ChapterRevision) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("novel", "no", "version").Unique(),
+	}
+}
@@ -37,6 +37,10 @@ const (
 	ConfigurationCategoryRequestConcurrency = "requestConcurrency"
 	// ConfigurationCategoryApplicationSetting 应用设置
 	ConfigurationCategoryApplicationSetting = "applicationSetting"
+	// ConfigurationCategoryFeatureFlag 功能开关
+	ConfigurationCategoryFeatureFlag = "featureFlag"
+	// ConfigurationCategoryMaintenance 维护模式
+	ConfigurationCategoryMaintenance = "maintenance"
 )
 
 // Configuration holds the schema definition for the Configuration entity.
@@ -69,6 +73,8 @@ func (Configuration) Fields() []ent.Field {
 				ConfigurationCategorySessionInterceptor,
 				ConfigurationCategoryRequestConcurrency,
 				ConfigurationCategoryApplicationSetting,
+				ConfigurationCategoryFeatureFlag,
+				ConfigurationCategoryMaintenance,
 			).
 			Comment("配置分类"),
 		field.String("owner").
@@ -0,0 +1,82 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// ConfigurationVersion holds the schema definition for the ConfigurationVersion entity.
+type ConfigurationVersion struct {
+	ent.Schema
+}
+
+// Mixin 配置版本的mixin
+func (ConfigurationVersion) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+		StatusMixin{},
+	}
+}
+
+// Fields 配置版本的相关字段，保存每次变更后配置的完整快照
+func (ConfigurationVersion) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("configuration").
+			Immutable().
+			Comment("配置id"),
+		field.Int("version").
+			Immutable().
+			Comment("版本号，从1开始递增"),
+		field.String("name").
+			Immutable().
+			Comment("配置名称"),
+		field.String("category").
+			Immutable().
+			Comment("配置分类"),
+		field.String("data").
+			Immutable().
+			Comment("配置信息"),
+		field.Time("started_at").
+			StructTag(`json:"startedAt"`).
+			Immutable().
+			Comment("配置启用时间"),
+		field.Time("ended_at").
+			StructTag(`json:"endedAt"`).
+			Immutable().
+			Comment("配置停用时间"),
+		field.String("author").
+			Immutable().
+			Comment("变更者"),
+		field.String("reason").
+			Optional().
+			Immutable().
+			Comment("变更原因"),
+	}
+}
+
+// Edges of the ConfigurationVersion.
+func (ConfigurationVersion) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 配置版本索引
+func (ConfigurationVersion) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("configuration", "version").Unique(),
+	}
+}
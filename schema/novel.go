@@ -104,6 +104,23 @@ func (Novel) Fields() []ent.Field {
 		field.Strings("categories").
 			Optional().
 			Comment("小说分类"),
+		// 评分相关字段，在书评增删改时增量更新
+		field.Int("rating_count").
+			Default(0).
+			StructTag(`json:"ratingCount" sql:"rating_count"`).
+			Comment("评分人数"),
+		field.Int("rating_sum").
+			Default(0).
+			StructTag(`json:"ratingSum" sql:"rating_sum"`).
+			Comment("评分总和"),
+		field.Float("rating").
+			Default(0).
+			Comment("平均评分"),
+		// 下标0-4分别对应1-5分的评分人数
+		field.Ints("rating_distribution").
+			Optional().
+			StructTag(`json:"ratingDistribution" sql:"rating_distribution"`).
+			Comment("评分分布"),
 	}
 }
 
@@ -0,0 +1,81 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+const (
+	// NovelModerationActionBan 禁止
+	NovelModerationActionBan = "ban"
+	// NovelModerationActionUnban 解除禁止
+	NovelModerationActionUnban = "unban"
+)
+
+// NovelModeration holds the schema definition for the NovelModeration entity.
+type NovelModeration struct {
+	ent.Schema
+}
+
+// Mixin 小说审核记录的mixin
+func (NovelModeration) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 小说审核记录的相关字段
+func (NovelModeration) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Enum("action").
+			Values(
+				NovelModerationActionBan,
+				NovelModerationActionUnban,
+			).
+			Immutable().
+			Comment("审核操作"),
+		field.Int("previous_status").
+			StructTag(`json:"previousStatus" sql:"previous_status"`).
+			Immutable().
+			Comment("操作前的小说状态，解除禁止时恢复为此状态"),
+		field.String("reason").
+			NotEmpty().
+			Immutable().
+			Comment("操作原因"),
+		field.String("operator").
+			NotEmpty().
+			Immutable().
+			Comment("操作者"),
+	}
+}
+
+// Edges of the NovelModeration.
+func (NovelModeration) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 小说审核记录索引
+func (NovelModeration) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("novel"),
+		index.Fields("operator"),
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"errors"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+const (
+	NovelReportStatusUnknown = iota
+	// NovelReportStatusPending 待处理
+	NovelReportStatusPending
+	// NovelReportStatusHandled 已处理
+	NovelReportStatusHandled
+	// NovelReportStatusIgnored 已忽略
+	NovelReportStatusIgnored
+	NovelReportStatusEnd
+)
+
+// 举报分类
+const (
+	// NovelReportCategoryPorn 色情低俗
+	NovelReportCategoryPorn = "porn"
+	// NovelReportCategoryPolitics 政治敏感
+	NovelReportCategoryPolitics = "politics"
+	// NovelReportCategoryViolence 暴力血腥
+	NovelReportCategoryViolence = "violence"
+	// NovelReportCategoryCopyright 侵权
+	NovelReportCategoryCopyright = "copyright"
+	// NovelReportCategoryOther 其它
+	NovelReportCategoryOther = "other"
+)
+
+// NovelReport holds the schema definition for the NovelReport entity.
+type NovelReport struct {
+	ent.Schema
+}
+
+// Mixin 小说举报的mixin
+func (NovelReport) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 小说举报的相关字段
+func (NovelReport) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Int("chapter").
+			Optional().
+			Immutable().
+			Comment("章节序号，针对章节的举报"),
+		field.Enum("category").
+			Values(
+				NovelReportCategoryPorn,
+				NovelReportCategoryPolitics,
+				NovelReportCategoryViolence,
+				NovelReportCategoryCopyright,
+				NovelReportCategoryOther,
+			).
+			Immutable().
+			Comment("举报分类"),
+		field.String("content").
+			Optional().
+			Immutable().
+			Comment("举报内容"),
+		field.String("reporter").
+			Optional().
+			Comment("举报者账户，未登录则为空，注销后清除"),
+		field.String("track_id").
+			StructTag(`json:"trackID" sql:"track_id"`).
+			Optional().
+			Comment("举报者的track id，注销后清除"),
+		field.String("ip").
+			Optional().
+			Comment("举报者IP，注销后清除"),
+		field.Int("status").
+			Default(NovelReportStatusPending).
+			Validate(func(i int) error {
+				if i <= NovelReportStatusUnknown || i >= NovelReportStatusEnd {
+					return errors.New("status is invalid")
+				}
+				return nil
+			}).
+			Comment("处理状态"),
+		field.String("handler").
+			Optional().
+			Comment("处理人"),
+		field.Time("handled_at").
+			StructTag(`json:"handledAt" sql:"handled_at"`).
+			Optional().
+			Comment("处理时间"),
+	}
+}
+
+// Edges of the NovelReport.
+func (NovelReport) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 小说举报索引
+func (NovelReport) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("novel"),
+		index.Fields("status"),
+	}
+}
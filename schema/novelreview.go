@@ -0,0 +1,82 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"errors"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+const (
+	// NovelReviewRatingMin 最低评分
+	NovelReviewRatingMin = 1
+	// NovelReviewRatingMax 最高评分
+	NovelReviewRatingMax = 5
+)
+
+// NovelReview holds the schema definition for the NovelReview entity.
+type NovelReview struct {
+	ent.Schema
+}
+
+// Mixin 书评的mixin
+func (NovelReview) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 书评的相关字段
+func (NovelReview) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Comment("评论者账户，账户注销时替换为匿名账户"),
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Int("rating").
+			Validate(func(i int) error {
+				if i < NovelReviewRatingMin || i > NovelReviewRatingMax {
+					return errors.New("rating is invalid")
+				}
+				return nil
+			}).
+			Comment("评分，1-5"),
+		field.String("content").
+			Optional().
+			Comment("书评内容"),
+		field.Int("helpful_count").
+			Default(0).
+			StructTag(`json:"helpfulCount" sql:"helpful_count"`).
+			Comment("认为有帮助的人数"),
+	}
+}
+
+// Edges of the NovelReview.
+func (NovelReview) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 书评索引，每个账户对每本小说仅可发表一篇书评
+func (NovelReview) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("novel", "account").Unique(),
+		index.Fields("novel", "helpful_count"),
+	}
+}
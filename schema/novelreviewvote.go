@@ -0,0 +1,57 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// NovelReviewVote holds the schema definition for the NovelReviewVote entity.
+type NovelReviewVote struct {
+	ent.Schema
+}
+
+// Mixin 书评投票的mixin
+func (NovelReviewVote) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 书评投票的相关字段
+func (NovelReviewVote) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("review").
+			Immutable().
+			Comment("书评id"),
+		field.String("account").
+			NotEmpty().
+			Comment("投票者账户，注销后替换为匿名账户"),
+	}
+}
+
+// Edges of the NovelReviewVote.
+func (NovelReviewVote) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 书评投票索引，每个账户对同一书评仅可投票一次
+func (NovelReviewVote) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("review", "account").Unique(),
+	}
+}
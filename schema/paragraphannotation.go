@@ -0,0 +1,92 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// 标注可见范围
+const (
+	// ParagraphAnnotationVisibilityPrivate 仅自己可见
+	ParagraphAnnotationVisibilityPrivate = "private"
+	// ParagraphAnnotationVisibilityPublic 所有人可见
+	ParagraphAnnotationVisibilityPublic = "public"
+)
+
+// ParagraphAnnotation holds the schema definition for the ParagraphAnnotation entity.
+type ParagraphAnnotation struct {
+	ent.Schema
+}
+
+// Mixin 段落标注的mixin
+func (ParagraphAnnotation) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 段落标注的相关字段
+func (ParagraphAnnotation) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("标注者账户"),
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Int("no").
+			Immutable().
+			Comment("章节序号"),
+		field.String("paragraph").
+			NotEmpty().
+			Immutable().
+			Comment("段落id"),
+		field.Int("start").
+			Default(0).
+			NonNegative().
+			Comment("标注在段落中的开始位置（字符）"),
+		field.Int("end").
+			Default(0).
+			NonNegative().
+			Comment("标注在段落中的结束位置（字符），为0表示整个段落"),
+		field.String("note").
+			Optional().
+			Comment("笔记"),
+		field.Enum("visibility").
+			Values(
+				ParagraphAnnotationVisibilityPrivate,
+				ParagraphAnnotationVisibilityPublic,
+			).
+			Default(ParagraphAnnotationVisibilityPrivate).
+			Comment("可见范围"),
+	}
+}
+
+// Edges of the ParagraphAnnotation.
+func (ParagraphAnnotation) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 段落标注索引
+func (ParagraphAnnotation) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("account", "novel", "no"),
+		index.Fields("novel", "no", "paragraph"),
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"errors"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+const (
+	ParagraphCommentStatusUnknown = iota
+	// ParagraphCommentStatusNormal 正常
+	ParagraphCommentStatusNormal
+	// ParagraphCommentStatusHidden 已隐藏（管理员屏蔽）
+	ParagraphCommentStatusHidden
+	ParagraphCommentStatusEnd
+)
+
+// ParagraphComment holds the schema definition for the ParagraphComment entity.
+type ParagraphComment struct {
+	ent.Schema
+}
+
+// Mixin 段评的mixin
+func (ParagraphComment) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 段评的相关字段
+func (ParagraphComment) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Comment("评论者账户，账户注销时替换为匿名账户"),
+		field.Int("novel").
+			Immutable().
+			Comment("小说id"),
+		field.Int("no").
+			Immutable().
+			Comment("章节序号"),
+		field.String("paragraph").
+			NotEmpty().
+			Immutable().
+			Comment("段落id"),
+		field.String("content").
+			NotEmpty().
+			Immutable().
+			Comment("评论内容"),
+		field.Int("like_count").
+			StructTag(`json:"likeCount" sql:"like_count"`).
+			Default(0).
+			Comment("点赞数"),
+		field.Int("report_count").
+			StructTag(`json:"reportCount" sql:"report_count"`).
+			Default(0).
+			Comment("举报数"),
+		field.Int("status").
+			Default(ParagraphCommentStatusNormal).
+			Validate(func(i int) error {
+				if i <= ParagraphCommentStatusUnknown || i >= ParagraphCommentStatusEnd {
+					return errors.New("status is invalid")
+				}
+				return nil
+			}).
+			Comment("状态"),
+		field.String("ip").
+			Optional().
+			Immutable().
+			Comment("评论者IP"),
+	}
+}
+
+// Edges of the ParagraphComment.
+func (ParagraphComment) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 段评索引
+func (ParagraphComment) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("novel", "no", "paragraph"),
+		index.Fields("account"),
+		index.Fields("status"),
+	}
+}
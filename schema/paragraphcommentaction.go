@@ -0,0 +1,72 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// 段评操作
+const (
+	// ParagraphCommentActionLike 点赞
+	ParagraphCommentActionLike = "like"
+	// ParagraphCommentActionReport 举报
+	ParagraphCommentActionReport = "report"
+)
+
+// ParagraphCommentAction holds the schema definition for the ParagraphCommentAction entity.
+type ParagraphCommentAction struct {
+	ent.Schema
+}
+
+// Mixin 段评操作记录的mixin
+func (ParagraphCommentAction) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 段评操作记录的相关字段
+func (ParagraphCommentAction) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("comment").
+			Immutable().
+			Comment("段评id"),
+		field.String("account").
+			NotEmpty().
+			Comment("操作者账户，注销后替换为匿名账户"),
+		field.Enum("action").
+			Values(
+				ParagraphCommentActionLike,
+				ParagraphCommentActionReport,
+			).
+			Immutable().
+			Comment("操作类型"),
+	}
+}
+
+// Edges of the ParagraphCommentAction.
+func (ParagraphCommentAction) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 段评操作记录索引，每个账户对同一段评的同一操作仅允许一次
+func (ParagraphCommentAction) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("comment", "account", "action").Unique(),
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"regexp"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+)
+
+// 内置权限
+const (
+	// PermissionNovelUpdate 小说及章节更新
+	PermissionNovelUpdate = "novel.update"
+	// PermissionNovelModerate 小说审核
+	PermissionNovelModerate = "novel.moderate"
+	// PermissionNovelReport 小说举报处理
+	PermissionNovelReport = "novel.report"
+	// PermissionNovelPublish 小说批量更新与发布
+	PermissionNovelPublish = "novel.publish"
+	// PermissionCommentModerate 段评管理
+	PermissionCommentModerate = "comment.moderate"
+	// PermissionUserRead 用户查询
+	PermissionUserRead = "user.read"
+	// PermissionUserUpdate 用户更新
+	PermissionUserUpdate = "user.update"
+	// PermissionUserCreate 用户创建
+	PermissionUserCreate = "user.create"
+	// PermissionUserImpersonate 模拟用户登录
+	PermissionUserImpersonate = "user.impersonate"
+	// PermissionConfigRead 配置查询
+	PermissionConfigRead = "config.read"
+	// PermissionConfigUpdate 配置更新
+	PermissionConfigUpdate = "config.update"
+	// PermissionAuditRead 审计日志查询
+	PermissionAuditRead = "audit.read"
+)
+
+// PermissionInfo 权限信息
+type PermissionInfo struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GetPermissionList 获取内置权限列表
+func GetPermissionList() []*PermissionInfo {
+	return []*PermissionInfo{
+		{
+			Name:  "小说更新",
+			Value: PermissionNovelUpdate,
+		},
+		{
+			Name:  "小说审核",
+			Value: PermissionNovelModerate,
+		},
+		{
+			Name:  "小说举报处理",
+			Value: PermissionNovelReport,
+		},
+		{
+			Name:  "小说批量更新与发布",
+			Value: PermissionNovelPublish,
+		},
+		{
+			Name:  "段评管理",
+			Value: PermissionCommentModerate,
+		},
+		{
+			Name:  "用户查询",
+			Value: PermissionUserRead,
+		},
+		{
+			Name:  "用户更新",
+			Value: PermissionUserUpdate,
+		},
+		{
+			Name:  "用户创建",
+			Value: PermissionUserCreate,
+		},
+		{
+			Name:  "模拟用户登录",
+			Value: PermissionUserImpersonate,
+		},
+		{
+			Name:  "配置查询",
+			Value: PermissionConfigRead,
+		},
+		{
+			Name:  "配置更新",
+			Value: PermissionConfigUpdate,
+		},
+		{
+			Name:  "审计日志查询",
+			Value: PermissionAuditRead,
+		},
+	}
+}
+
+// Permission holds the schema definition for the Permission entity.
+type Permission struct {
+	ent.Schema
+}
+
+// Mixin 权限的mixin
+func (Permission) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 权限的相关字段
+func (Permission) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			Match(regexp.MustCompile(`^[a-z]+\.[a-z]+$`)).
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("权限名称，格式为：模块.操作"),
+		field.String("description").
+			Optional().
+			Comment("权限描述"),
+	}
+}
+
+// Edges of the Permission.
+func (Permission) Edges() []ent.Edge {
+	return nil
+}
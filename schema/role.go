@@ -0,0 +1,74 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"regexp"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+)
+
+// Role holds the schema definition for the Role entity.
+type Role struct {
+	ent.Schema
+}
+
+// GetDefaultRolePermissions 获取内置角色的默认权限，su拥有所有权限因此无需配置
+func GetDefaultRolePermissions() map[string][]string {
+	return map[string][]string{
+		UserRoleNormal: {},
+		UserRoleAdmin: {
+			PermissionNovelUpdate,
+			PermissionNovelModerate,
+			PermissionNovelReport,
+			PermissionNovelPublish,
+			PermissionCommentModerate,
+			PermissionUserRead,
+			PermissionUserUpdate,
+			PermissionUserCreate,
+		},
+	}
+}
+
+// Mixin 角色的mixin
+func (Role) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 角色的相关字段
+func (Role) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			Match(regexp.MustCompile("^[a-zA-Z_0-9]+$")).
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("角色名称"),
+		field.String("description").
+			Optional().
+			Comment("角色描述"),
+		field.Strings("permissions").
+			Optional().
+			Comment("角色拥有的权限"),
+	}
+}
+
+// Edges of the Role.
+func (Role) Edges() []ent.Edge {
+	return nil
+}
@@ -32,6 +32,34 @@ const (
 	UserRoleAdmin = "admin"
 )
 
+// 用户隐私设置
+const (
+	// UserPrivacyHideProfile 不公开个人资料
+	UserPrivacyHideProfile = "hideProfile"
+	// UserPrivacyHideReviews 个人资料中不展示书评
+	UserPrivacyHideReviews = "hideReviews"
+)
+
+// UserPrivacyInfo 用户隐私设置信息
+type UserPrivacyInfo struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GetUserPrivacyList 获取用户隐私设置列表
+func GetUserPrivacyList() []*UserPrivacyInfo {
+	return []*UserPrivacyInfo{
+		{
+			Name:  "不公开个人资料",
+			Value: UserPrivacyHideProfile,
+		},
+		{
+			Name:  "个人资料中不展示书评",
+			Value: UserPrivacyHideReviews,
+		},
+	}
+}
+
 // UserRoleInfo 用户角色信息
 type UserRoleInfo struct {
 	Name  string `json:"name"`
@@ -82,6 +110,10 @@ func (User) Fields() []ent.Field {
 			Sensitive().
 			NotEmpty().
 			Comment("用户密码，保存hash之后的值"),
+		field.String("password_verifier").
+			Sensitive().
+			Optional().
+			Comment("登录挑战使用的校验数据，仅保存StoredKey，无法直接用于登录"),
 		field.String("name").
 			Optional().
 			Comment("用户名称"),
@@ -94,6 +126,49 @@ func (User) Fields() []ent.Field {
 		field.String("email").
 			Optional().
 			Comment("用户邮箱"),
+		field.Time("email_verified_at").
+			StructTag(`json:"emailVerifiedAt,omitempty" sql:"email_verified_at"`).
+			Optional().
+			Nillable().
+			Comment("邮箱验证时间，为空表示未验证，修改邮箱时清除"),
+		field.String("totp_secret").
+			Sensitive().
+			Optional().
+			Comment("两步验证的密钥，加密后保存"),
+		field.Time("totp_enabled_at").
+			StructTag(`json:"totpEnabledAt,omitempty" sql:"totp_enabled_at"`).
+			Optional().
+			Nillable().
+			Comment("两步验证启用时间，为空表示未启用"),
+		field.Strings("totp_recovery_codes").
+			StructTag(`json:"-" sql:"totp_recovery_codes"`).
+			Optional().
+			Comment("两步验证的恢复码，保存HMAC之后的值，使用后删除"),
+		field.String("avatar").
+			Optional().
+			Comment("头像文件名"),
+		field.String("bio").
+			MaxLen(200).
+			Optional().
+			Comment("个人简介"),
+		field.Strings("privacy").
+			Optional().
+			Comment("隐私设置，保存已启用的设置项"),
+		field.Time("deletion_requested_at").
+			StructTag(`json:"deletionRequestedAt,omitempty" sql:"deletion_requested_at"`).
+			Optional().
+			Nillable().
+			Comment("申请注销时间，宽限期内登录则取消注销"),
+		field.Time("deleted_at").
+			StructTag(`json:"deletedAt,omitempty" sql:"deleted_at"`).
+			Optional().
+			Nillable().
+			Comment("注销时间，注销后个人信息已清除"),
+		field.Time("password_reset_required_at").
+			StructTag(`json:"passwordResetRequiredAt,omitempty" sql:"password_reset_required_at"`).
+			Optional().
+			Nillable().
+			Comment("要求修改密码的时间，登录后需先修改密码"),
 	}
 }
 
@@ -0,0 +1,57 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"regexp"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+)
+
+// UserGroup holds the schema definition for the UserGroup entity.
+type UserGroup struct {
+	ent.Schema
+}
+
+// Mixin 用户分组的mixin
+func (UserGroup) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 用户分组的相关字段，分组内的用户均拥有分组的角色
+func (UserGroup) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			Match(regexp.MustCompile("^[a-zA-Z_0-9]+$")).
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("分组名称"),
+		field.String("description").
+			Optional().
+			Comment("分组描述"),
+		field.Strings("roles").
+			Optional().
+			Comment("分组授予的角色"),
+	}
+}
+
+// Edges of the UserGroup.
+func (UserGroup) Edges() []ent.Edge {
+	return nil
+}
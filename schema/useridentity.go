@@ -0,0 +1,67 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// UserIdentity holds the schema definition for the UserIdentity entity.
+type UserIdentity struct {
+	ent.Schema
+}
+
+// Mixin 外部身份的mixin
+func (UserIdentity) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 外部身份（OpenID Connect）的相关字段
+func (UserIdentity) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("关联的账户"),
+		field.String("provider").
+			NotEmpty().
+			Immutable().
+			Comment("provider名称"),
+		field.String("subject").
+			NotEmpty().
+			Immutable().
+			Comment("provider中的用户标识（sub）"),
+		field.String("email").
+			Optional().
+			Comment("provider中的邮箱"),
+	}
+}
+
+// Edges of the UserIdentity.
+func (UserIdentity) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 外部身份索引，每个provider的用户仅可关联一个账户，每个账户在同一provider仅可关联一个用户
+func (UserIdentity) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("provider", "subject").Unique(),
+		index.Fields("account", "provider").Unique(),
+	}
+}
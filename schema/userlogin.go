@@ -56,6 +56,14 @@ func (UserLogin) Fields() []ent.Field {
 		field.String("isp").
 			Optional().
 			Comment("用户登录IP的网络服务商"),
+		field.Int("risk_score").
+			StructTag(`json:"riskScore" sql:"risk_score"`).
+			Default(0).
+			Comment("登录风险分值（0-100）"),
+		field.Strings("risk_reasons").
+			StructTag(`json:"riskReasons,omitempty" sql:"risk_reasons"`).
+			Optional().
+			Comment("登录风险原因"),
 	}
 }
 
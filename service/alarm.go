@@ -68,15 +68,7 @@ func AlarmError(message string) {
 		m.SetBody("text/plain", message)
 		// 避免发送邮件时太慢影响现有流程
 		go func() {
-			// 一次只允许一个email发送（由于使用的邮件服务有限制）
-			sendingMailMutex.Lock()
-			defer sendingMailMutex.Unlock()
-			err := d.DialAndSend(m)
-			if err != nil {
-				log.Default().Error().
-					Err(err).
-					Msg("send mail fail")
-			}
+			_ = dialAndSend(d, m)
 		}()
 	}
 }
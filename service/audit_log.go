@@ -0,0 +1,41 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/ent/auditlog"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/log"
+)
+
+// PruneAuditLogs 清除超过保留时长的审计日志
+func PruneAuditLogs() (err error) {
+	retention := config.GetAuditLogConfig().Retention
+	count, err := helper.EntGetClient().AuditLog.Delete().
+		Where(auditlog.CreatedAtLT(time.Now().Add(-retention))).
+		Exec(context.Background())
+	if err != nil {
+		return
+	}
+	log.Default().Info().
+		Str("category", "auditLog").
+		Int("count", count).
+		Msg("prune audit logs")
+	return
+}
@@ -129,9 +129,22 @@ func parseColor(s string) (c color.RGBA, err error) {
 	return
 }
 
+// 图形验证码长度
+const (
+	// CaptchaLength 默认的图形验证码长度
+	CaptchaLength = 4
+	// CaptchaStrongLength 登录失败较多时要求的图形验证码长度
+	CaptchaStrongLength = 6
+)
+
 // GetCaptcha 获取图形验证码
 func GetCaptcha(ctx context.Context, fontColor, bgColor string) (info CaptchaInfo, err error) {
-	value := util.RandomDigit(4)
+	return GetCaptchaWithLength(ctx, fontColor, bgColor, CaptchaLength)
+}
+
+// GetCaptchaWithLength 获取指定长度的图形验证码
+func GetCaptchaWithLength(ctx context.Context, fontColor, bgColor string, length int) (info CaptchaInfo, err error) {
+	value := util.RandomDigit(length)
 	fc, err := parseColor(fontColor)
 	if err != nil {
 		return
@@ -141,7 +154,8 @@ func GetCaptcha(ctx context.Context, fontColor, bgColor string) (info CaptchaInf
 		return
 	}
 
-	img, err := createCaptcha(fc, bc, 80, 40, value)
+	// 宽度按4位验证码80px等比调整
+	img, err := createCaptcha(fc, bc, 20*length, 40, value)
 	if err != nil {
 		return
 	}
@@ -23,16 +23,17 @@ import (
 	"sync"
 	"time"
 
-	"github.com/blang/semver/v4"
 	"github.com/vicanso/elite/config"
 	"github.com/vicanso/elite/ent"
 	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/flags"
 	"github.com/vicanso/elite/helper"
 	"github.com/vicanso/elite/log"
 	"github.com/vicanso/elite/request"
 	"github.com/vicanso/elite/schema"
 	"github.com/vicanso/elite/util"
 	"github.com/vicanso/elton"
+	"go.uber.org/atomic"
 )
 
 // ConfigurationSrv 配置的相关函数
@@ -49,7 +50,11 @@ type (
 
 	// CurrentValidConfiguration 当前有效配置
 	CurrentValidConfiguration struct {
-		UpdatedAt          time.Time               `json:"updatedAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+		// Version 当前实例生效配置的版本，各实例一致则表示配置一致
+		Version string `json:"version"`
+		// Hostname 当前实例
+		Hostname           string                  `json:"hostname"`
 		MockTime           string                  `json:"mockTime"`
 		IPBlockList        []string                `json:"ipBlockList"`
 		SignedKeys         []string                `json:"signedKeys"`
@@ -82,6 +87,12 @@ var (
 // 配置刷新时间
 var configurationRefreshedAt time.Time
 
+// configurationVersion 当前生效配置的版本，刷新时更新，读取时无需加锁
+var configurationVersion = atomic.NewString("")
+
+// configurationRefreshMutex 定时刷新与变更通知均会刷新配置，避免同时刷新
+var configurationRefreshMutex = new(sync.Mutex)
+
 const (
 	sessionInterceptorKey = "sessionInterceptor"
 )
@@ -99,10 +110,7 @@ func GetSignedKeys() elton.SignedKeysGenerator {
 
 // 获取首个匹配的设置
 func (settings ApplicationSettings) First(currentVersion string) (setting *ApplicationSetting, err error) {
-	if currentVersion == "" {
-		currentVersion = "0.0.0"
-	}
-	ver, err := semver.Parse(currentVersion)
+	ver, err := util.ParseVersion(currentVersion)
 	if err != nil {
 		return
 	}
@@ -119,12 +127,12 @@ func (settings ApplicationSettings) First(currentVersion string) (setting *Appli
 		return v1 > v2
 	})
 	for _, item := range settings {
-		expectedRange, e := semver.ParseRange(item.ApplIcableVersion)
+		matched, e := util.MatchVersionRange(ver, item.ApplIcableVersion)
 		if e != nil {
 			err = e
 			return
 		}
-		if expectedRange(ver) {
+		if matched {
 			setting = item
 			break
 		}
@@ -137,6 +145,8 @@ func GetCurrentValidConfiguration() *CurrentValidConfiguration {
 	interData, _ := GetSessionInterceptorData()
 	result := &CurrentValidConfiguration{
 		UpdatedAt:         configurationRefreshedAt,
+		Version:           configurationVersion.Load(),
+		Hostname:          GetApplicationHostname(),
 		MockTime:          util.GetMockTime(),
 		IPBlockList:       GetIPBlockList(),
 		SignedKeys:        sessionSignedKeys.GetKeys(),
@@ -210,11 +220,14 @@ func (*ConfigurationSrv) ListApplicationSetting(ctx context.Context) (settings A
 
 // Refresh 刷新配置
 func (srv *ConfigurationSrv) Refresh() (err error) {
+	configurationRefreshMutex.Lock()
+	defer configurationRefreshMutex.Unlock()
 	configs, err := srv.available()
 	if err != nil {
 		return
 	}
 	configurationRefreshedAt = time.Now()
+	configurationVersion.Store(getConfigurationFingerprint(configs))
 	var mockTimeConfig *ent.Configuration
 	routerConcurrencyConfigs := make([]string, 0)
 	routerConfigs := make([]string, 0)
@@ -223,6 +236,8 @@ func (srv *ConfigurationSrv) Refresh() (err error) {
 	sessionInterceptorValue := ""
 
 	requestLimitConfigs := make(map[string]int)
+	featureFlags := make([]*flags.Flag, 0)
+	maintenanceWindows := make([]*MaintenanceWindow, 0)
 	for _, item := range configs {
 		switch item.Category {
 		case schema.ConfigurationCategoryMockTime:
@@ -258,6 +273,29 @@ func (srv *ConfigurationSrv) Refresh() (err error) {
 			if c.Name != "" {
 				requestLimitConfigs[c.Name] = c.Max
 			}
+		case schema.ConfigurationCategoryFeatureFlag:
+			flag, err := flags.Parse(item.Data)
+			if err != nil {
+				log.Default().Error().
+					Err(err).
+					Msg("feature flag config is invalid")
+				AlarmError("feature flag config is invalid:" + err.Error())
+				continue
+			}
+			featureFlags = append(featureFlags, flag)
+		case schema.ConfigurationCategoryMaintenance:
+			data, err := parseMaintenanceData(item.Data)
+			if err != nil {
+				log.Default().Error().
+					Err(err).
+					Msg("maintenance config is invalid")
+				AlarmError("maintenance config is invalid:" + err.Error())
+				continue
+			}
+			maintenanceWindows = append(maintenanceWindows, &MaintenanceWindow{
+				MaintenanceData: *data,
+				EndedAt:         item.EndedAt,
+			})
 		}
 	}
 
@@ -308,6 +346,20 @@ func (srv *ConfigurationSrv) Refresh() (err error) {
 	// 更新HTTP请求实例并发限制
 	request.UpdateConcurrencyLimit(requestLimitConfigs)
 
+	// 更新功能开关
+	flags.Update(featureFlags)
+
+	// 更新维护窗口
+	updateMaintenanceWindows(maintenanceWindows)
+
+	// 设置下一次配置变更时的刷新
+	e := srv.scheduleRefresh(context.Background())
+	if e != nil {
+		log.Default().Error().
+			Err(e).
+			Msg("schedule configuration refresh fail")
+	}
+
 	return
 }
 
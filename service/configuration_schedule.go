@@ -0,0 +1,214 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 配置的定时生效与失效，刷新配置时根据最近的启用或停用时间设置定时器，
+// 到达时间后立即刷新，无需等待定时刷新；以及维护模式的配置
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/schema"
+)
+
+const (
+	// ConfigurationChangeActivate 配置生效
+	ConfigurationChangeActivate = "activate"
+	// ConfigurationChangeDeactivate 配置失效
+	ConfigurationChangeDeactivate = "deactivate"
+)
+
+// configurationChangeDelay 定时刷新延后的时长，保证刷新时已过生效（失效）时间
+const configurationChangeDelay = 10 * time.Millisecond
+
+type (
+	// ConfigurationChange 即将发生的配置变更
+	ConfigurationChange struct {
+		// Action 变更类型：activate或deactivate
+		Action        string             `json:"action"`
+		At            time.Time          `json:"at"`
+		Configuration *ent.Configuration `json:"configuration"`
+	}
+	// MaintenanceData 维护模式的配置数据
+	MaintenanceData struct {
+		Message string `json:"message"`
+		// Routes 维护中的路由，为空表示所有路由（登录与配置等路由除外）
+		Routes []string `json:"routes"`
+	}
+	// MaintenanceWindow 维护窗口
+	MaintenanceWindow struct {
+		MaintenanceData
+		// EndedAt 维护结束时间
+		EndedAt time.Time `json:"endedAt"`
+	}
+)
+
+var (
+	// configurationRefreshTimer 下一次配置变更时刷新的定时器
+	configurationRefreshTimer *time.Timer
+
+	maintenanceWindowsMutex = new(sync.RWMutex)
+	// maintenanceWindows 当前生效的维护窗口
+	maintenanceWindows []*MaintenanceWindow
+)
+
+// ListUpcomingChanges 获取即将发生的配置变更（仅启用状态的配置），按时间排序
+func (*ConfigurationSrv) ListUpcomingChanges(ctx context.Context, limit int) (changes []*ConfigurationChange, err error) {
+	now := time.Now()
+	client := helper.EntGetClient()
+	activateConfigs, err := client.Configuration.Query().
+		Where(configuration.Status(schema.StatusEnabled)).
+		Where(configuration.StartedAtGT(now)).
+		Order(ent.Asc(configuration.FieldStartedAt)).
+		Limit(limit).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	deactivateConfigs, err := client.Configuration.Query().
+		Where(configuration.Status(schema.StatusEnabled)).
+		Where(configuration.EndedAtGT(now)).
+		Order(ent.Asc(configuration.FieldEndedAt)).
+		Limit(limit).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	changes = make([]*ConfigurationChange, 0, len(activateConfigs)+len(deactivateConfigs))
+	for _, item := range activateConfigs {
+		changes = append(changes, &ConfigurationChange{
+			Action:        ConfigurationChangeActivate,
+			At:            item.StartedAt,
+			Configuration: item,
+		})
+	}
+	for _, item := range deactivateConfigs {
+		changes = append(changes, &ConfigurationChange{
+			Action:        ConfigurationChangeDeactivate,
+			At:            item.EndedAt,
+			Configuration: item,
+		})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].At.Before(changes[j].At)
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return
+}
+
+// scheduleRefresh 根据最近的配置变更时间设置刷新的定时器，
+// 需要在刷新配置时调用（已加锁）
+func (srv *ConfigurationSrv) scheduleRefresh(ctx context.Context) (err error) {
+	if configurationRefreshTimer != nil {
+		configurationRefreshTimer.Stop()
+		configurationRefreshTimer = nil
+	}
+	changes, err := srv.ListUpcomingChanges(ctx, 1)
+	if err != nil || len(changes) == 0 {
+		return
+	}
+	change := changes[0]
+	configurationRefreshTimer = time.AfterFunc(time.Until(change.At)+configurationChangeDelay, func() {
+		err := srv.Refresh()
+		if err != nil {
+			log.Default().Error().
+				Err(err).
+				Msg("scheduled configuration refresh fail")
+			return
+		}
+		log.Default().Info().
+			Str("action", change.Action).
+			Str("name", change.Configuration.Name).
+			Msg("configuration refreshed by schedule")
+	})
+	return
+}
+
+// parseMaintenanceData 解析维护模式配置
+func parseMaintenanceData(data string) (*MaintenanceData, error) {
+	v := &MaintenanceData{}
+	err := json.Unmarshal([]byte(data), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// updateMaintenanceWindows 更新维护窗口
+func updateMaintenanceWindows(windows []*MaintenanceWindow) {
+	maintenanceWindowsMutex.Lock()
+	defer maintenanceWindowsMutex.Unlock()
+	maintenanceWindows = windows
+}
+
+// maintenanceExemptRoutes 不受维护影响的路由，
+// 保证维护期间可检测服务状态，且管理员可登录并调整配置（如提前结束维护）
+var maintenanceExemptRoutes = []string{
+	"/ping",
+	"/users/v1/me/login",
+	"/users/inner/v1/me/login",
+	"/users/v1/me/login/confirmation",
+	"/users/v1/me/login/totp",
+}
+
+// maintenanceExemptRoutePrefix 不受维护影响的路由前缀
+const maintenanceExemptRoutePrefix = "/configurations/"
+
+// isMaintenanceExemptRoute 判断路由是否不受维护影响
+func isMaintenanceExemptRoute(route string) bool {
+	for _, r := range maintenanceExemptRoutes {
+		if r == route {
+			return true
+		}
+	}
+	return strings.HasPrefix(route, maintenanceExemptRoutePrefix)
+}
+
+// GetMaintenanceWindow 获取路由当前生效的维护窗口，无则返回nil，
+// 登录与配置等路由不受维护影响
+func GetMaintenanceWindow(route string) *MaintenanceWindow {
+	if isMaintenanceExemptRoute(route) {
+		return nil
+	}
+	maintenanceWindowsMutex.RLock()
+	defer maintenanceWindowsMutex.RUnlock()
+	now := time.Now()
+	for _, item := range maintenanceWindows {
+		// 已结束的维护窗口（定时刷新前）忽略
+		if !item.EndedAt.After(now) {
+			continue
+		}
+		if len(item.Routes) == 0 {
+			return item
+		}
+		for _, r := range item.Routes {
+			if r == route {
+				return item
+			}
+		}
+	}
+	return nil
+}
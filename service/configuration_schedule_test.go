@@ -0,0 +1,77 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMaintenanceData(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := parseMaintenanceData(`{"message":"系统维护中","routes":["/novels/v1"]}`)
+	assert.Nil(err)
+	assert.Equal("系统维护中", data.Message)
+	assert.Equal([]string{"/novels/v1"}, data.Routes)
+
+	_, err = parseMaintenanceData("{")
+	assert.NotNil(err)
+}
+
+func TestGetMaintenanceWindow(t *testing.T) {
+	assert := assert.New(t)
+	defer updateMaintenanceWindows(nil)
+
+	assert.Nil(GetMaintenanceWindow("/novels/v1"))
+
+	endedAt := time.Now().Add(time.Hour)
+	novelWindow := &MaintenanceWindow{
+		MaintenanceData: MaintenanceData{
+			Message: "书籍维护中",
+			Routes:  []string{"/novels/v1"},
+		},
+		EndedAt: endedAt,
+	}
+	updateMaintenanceWindows([]*MaintenanceWindow{
+		novelWindow,
+	})
+	assert.Equal(novelWindow, GetMaintenanceWindow("/novels/v1"))
+	assert.Nil(GetMaintenanceWindow("/users/v1/me"))
+
+	// 未指定路由则所有路由均维护中（登录与配置等路由除外）
+	allWindow := &MaintenanceWindow{
+		MaintenanceData: MaintenanceData{
+			Message: "系统维护中",
+		},
+		EndedAt: endedAt,
+	}
+	updateMaintenanceWindows([]*MaintenanceWindow{
+		allWindow,
+	})
+	assert.Equal(allWindow, GetMaintenanceWindow("/users/v1/me"))
+	// 登录与配置等路由不受影响
+	assert.Nil(GetMaintenanceWindow("/ping"))
+	assert.Nil(GetMaintenanceWindow("/users/v1/me/login"))
+	assert.Nil(GetMaintenanceWindow("/users/inner/v1/me/login"))
+	assert.Nil(GetMaintenanceWindow("/users/v1/me/login/totp"))
+	assert.Nil(GetMaintenanceWindow("/configurations/v1"))
+
+	// 已结束的维护窗口忽略
+	allWindow.EndedAt = time.Now().Add(-time.Second)
+	assert.Nil(GetMaintenanceWindow("/users/v1/me"))
+}
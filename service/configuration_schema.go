@@ -0,0 +1,178 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 各分类配置数据的json schema，保存前校验，管理后台也可根据schema生成表单。
+// 非json的配置（如IP、mock时间）的schema类型为string，校验时作为json字符串处理
+
+package service
+
+import (
+	"embed"
+	"encoding/json"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/hes"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+//go:embed configuration_schema/*.json
+var configurationSchemaFS embed.FS
+
+type (
+	// configurationSchema 配置分类对应的schema
+	configurationSchema struct {
+		raw    json.RawMessage
+		schema *gojsonschema.Schema
+		// 配置数据是否为字符串（非json）
+		isString bool
+	}
+	// ConfigurationSchemaError 配置数据校验失败的字段
+	ConfigurationSchemaError struct {
+		// Field 出错字段的路径，如(root).max
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+
+	// ipOrCIDRFormatChecker IP或网段
+	ipOrCIDRFormatChecker struct{}
+	// semverFormatChecker 版本号
+	semverFormatChecker struct{}
+	// semverRangeFormatChecker 版本号范围
+	semverRangeFormatChecker struct{}
+)
+
+var configurationSchemas = mustLoadConfigurationSchemas()
+
+// IsFormat 判断是否IP或网段
+func (ipOrCIDRFormatChecker) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+// IsFormat 判断是否版本号
+func (semverFormatChecker) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+	_, err := semver.Parse(s)
+	return err == nil
+}
+
+// IsFormat 判断是否版本号范围
+func (semverRangeFormatChecker) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+	_, err := semver.ParseRange(s)
+	return err == nil
+}
+
+// mustLoadConfigurationSchemas 加载所有配置分类的schema，文件名为分类名称
+func mustLoadConfigurationSchemas() map[string]*configurationSchema {
+	gojsonschema.FormatCheckers.
+		Add("ip-or-cidr", ipOrCIDRFormatChecker{}).
+		Add("semver", semverFormatChecker{}).
+		Add("semver-range", semverRangeFormatChecker{})
+
+	files, err := configurationSchemaFS.ReadDir("configuration_schema")
+	if err != nil {
+		panic(err)
+	}
+	schemas := make(map[string]*configurationSchema)
+	for _, file := range files {
+		buf, err := configurationSchemaFS.ReadFile("configuration_schema/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		s, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(buf))
+		if err != nil {
+			panic(err)
+		}
+		info := struct {
+			Type string `json:"type"`
+		}{}
+		err = json.Unmarshal(buf, &info)
+		if err != nil {
+			panic(err)
+		}
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		schemas[name] = &configurationSchema{
+			raw:      buf,
+			schema:   s,
+			isString: info.Type == "string",
+		}
+	}
+	return schemas
+}
+
+// GetConfigurationSchemas 获取所有配置分类的schema
+func GetConfigurationSchemas() map[string]json.RawMessage {
+	result := make(map[string]json.RawMessage)
+	for name, item := range configurationSchemas {
+		result[name] = item.raw
+	}
+	return result
+}
+
+// validateConfigurationSchema 根据配置分类的schema校验数据，
+// 出错时返回的hes error中extra.errors为各出错字段
+func validateConfigurationSchema(category configuration.Category, data string) (err error) {
+	s, ok := configurationSchemas[category.String()]
+	// 未定义schema的分类不校验
+	if !ok {
+		return
+	}
+	loader := gojsonschema.NewStringLoader(data)
+	if s.isString {
+		loader = gojsonschema.NewGoLoader(data)
+	} else if !json.Valid([]byte(data)) {
+		return hes.New("配置数据不是合法的json", errConfigurationCategory)
+	}
+	result, err := s.schema.Validate(loader)
+	if err != nil {
+		he := hes.Wrap(err)
+		he.Category = errConfigurationCategory
+		return he
+	}
+	if result.Valid() {
+		return
+	}
+	errs := make([]*ConfigurationSchemaError, len(result.Errors()))
+	messages := make([]string, len(errs))
+	for index, item := range result.Errors() {
+		errs[index] = &ConfigurationSchemaError{
+			Field:   item.Context().String(),
+			Message: item.Description(),
+		}
+		messages[index] = item.Context().String() + ": " + item.Description()
+	}
+	he := hes.New(strings.Join(messages, "; "), errConfigurationCategory)
+	he.Extra = map[string]interface{}{
+		"errors": errs,
+	}
+	return he
+}
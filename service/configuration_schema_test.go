@@ -0,0 +1,70 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/hes"
+)
+
+func TestGetConfigurationSchemas(t *testing.T) {
+	assert := assert.New(t)
+
+	schemas := GetConfigurationSchemas()
+	categories := []string{
+		schema.ConfigurationCategoryMockTime,
+		schema.ConfigurationCategoryBlockIP,
+		schema.ConfigurationCategorySignedKey,
+		schema.ConfigurationCategoryRouterConcurrency,
+		schema.ConfigurationCategoryRouter,
+		schema.ConfigurationCategorySessionInterceptor,
+		schema.ConfigurationCategoryRequestConcurrency,
+		schema.ConfigurationCategoryApplicationSetting,
+		schema.ConfigurationCategoryFeatureFlag,
+		schema.ConfigurationCategoryMaintenance,
+	}
+	for _, category := range categories {
+		assert.NotEmpty(schemas[category], category)
+	}
+}
+
+func TestValidateConfigurationSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	err := validateConfigurationSchema(configuration.CategoryRouterConcurrency, `{
+		"route": "/users/v1/me",
+		"method": "GET",
+		"max": -1
+	}`)
+	assert.NotNil(err)
+	he := hes.Wrap(err)
+	assert.Equal(errConfigurationCategory, he.Category)
+	errs, _ := he.Extra["errors"].([]*ConfigurationSchemaError)
+	assert.Equal(1, len(errs))
+	assert.Equal("(root).max", errs[0].Field)
+
+	err = validateConfigurationSchema(configuration.CategoryBlockIP, "192.168.1.0/24")
+	assert.Nil(err)
+
+	err = validateConfigurationSchema(configuration.CategoryBlockIP, "192.168.1")
+	assert.NotNil(err)
+
+	err = validateConfigurationSchema(configuration.CategoryRouter, `{"route": "/"`)
+	assert.NotNil(err)
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 配置变更通过redis pub/sub通知所有实例立即刷新配置，
+// 定时刷新仍保留，在通知失败或实例未订阅成功时兜底
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/util"
+)
+
+// configurationInvalidationChannel 配置变更通知的channel
+const configurationInvalidationChannel = "configurationInvalidation"
+
+// configurationInvalidation 配置变更通知
+type configurationInvalidation struct {
+	// Hostname 发布通知的实例
+	Hostname string `json:"hostname"`
+	// CreatedAt 发布时间
+	CreatedAt string `json:"createdAt"`
+}
+
+// getConfigurationFingerprint 根据生效配置的id与更新时间生成版本，
+// 各实例的版本一致则表示生效的配置一致
+func getConfigurationFingerprint(configs []*ent.Configuration) string {
+	arr := make([]string, len(configs))
+	for index, item := range configs {
+		arr[index] = strconv.Itoa(item.ID) + ":" + strconv.FormatInt(item.UpdatedAt.UnixNano(), 10)
+	}
+	sort.Strings(arr)
+	sum := sha256.Sum256([]byte(strings.Join(arr, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// PublishConfigurationInvalidation 发布配置变更通知，失败时仅记录日志（由定时刷新兜底）
+func PublishConfigurationInvalidation(ctx context.Context) {
+	buf, _ := json.Marshal(&configurationInvalidation{
+		Hostname:  GetApplicationHostname(),
+		CreatedAt: util.NowString(),
+	})
+	err := helper.RedisGetClient().Publish(ctx, configurationInvalidationChannel, string(buf)).Err()
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Msg("publish configuration invalidation fail")
+	}
+}
+
+// SubscribeConfigurationInvalidation 订阅配置变更通知，收到通知后刷新配置，
+// 连接断开时redis client会自动重新订阅
+func SubscribeConfigurationInvalidation() {
+	srv := NewConfigurationSrv()
+	sub := helper.RedisGetClient().Subscribe(context.Background(), configurationInvalidationChannel)
+	go func() {
+		for msg := range sub.Channel() {
+			info := configurationInvalidation{}
+			_ = json.Unmarshal([]byte(msg.Payload), &info)
+			err := srv.Refresh()
+			if err != nil {
+				log.Default().Error().
+					Err(err).
+					Str("from", info.Hostname).
+					Msg("refresh configuration fail")
+				continue
+			}
+			log.Default().Info().
+				Str("from", info.Hostname).
+				Str("publishedAt", info.CreatedAt).
+				Str("version", configurationVersion.Load()).
+				Msg("configuration refreshed by invalidation")
+		}
+	}()
+}
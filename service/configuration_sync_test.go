@@ -0,0 +1,45 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/ent"
+)
+
+func TestGetConfigurationFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	c1 := &ent.Configuration{
+		ID:        1,
+		UpdatedAt: now,
+	}
+	c2 := &ent.Configuration{
+		ID:        2,
+		UpdatedAt: now,
+	}
+	version := getConfigurationFingerprint([]*ent.Configuration{c1, c2})
+	assert.Equal(16, len(version))
+	// 与顺序无关
+	assert.Equal(version, getConfigurationFingerprint([]*ent.Configuration{c2, c1}))
+
+	c2.UpdatedAt = now.Add(time.Second)
+	assert.NotEqual(version, getConfigurationFingerprint([]*ent.Configuration{c1, c2}))
+	assert.NotEqual(version, getConfigurationFingerprint([]*ent.Configuration{c1}))
+}
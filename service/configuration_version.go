@@ -0,0 +1,321 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 配置版本，每次添加或更新配置均保存完整的配置快照，
+// 可对比任意两个版本或回滚至指定版本（回滚也会生成新的版本）
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/ent/configurationversion"
+	"github.com/vicanso/elite/flags"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+	"github.com/vicanso/ips"
+)
+
+const errConfigurationCategory = "configuration"
+
+// ConfigurationSaveParams 配置保存参数，更新时零值的字段不更新
+type ConfigurationSaveParams struct {
+	Name      string
+	Category  configuration.Category
+	Status    schema.Status
+	Data      string
+	StartedAt time.Time
+	EndedAt   time.Time
+	// Author 变更者
+	Author string
+	// Reason 变更原因
+	Reason string
+}
+
+// ConfigurationVersionDiff 配置版本对比
+type ConfigurationVersionDiff struct {
+	// From 对比的源版本，0表示空配置
+	From int `json:"from"`
+	// To 对比的目标版本
+	To int `json:"to"`
+	// Size 变更的字符数
+	Size  int             `json:"size"`
+	Lines []util.DiffLine `json:"lines"`
+}
+
+// ValidateConfigurationData 校验配置数据，先根据分类的schema校验，
+// 再使用与刷新配置时相同的解析逻辑校验
+func ValidateConfigurationData(category configuration.Category, data string) (err error) {
+	err = validateConfigurationSchema(category, data)
+	if err != nil {
+		return
+	}
+	switch category.String() {
+	case schema.ConfigurationCategoryMockTime:
+		_, err = time.Parse(time.RFC3339, data)
+	case schema.ConfigurationCategoryBlockIP:
+		err = ips.New().Replace(data)
+	case schema.ConfigurationCategoryRouterConcurrency:
+		_, err = parseRouterConcurrencyConfig(data)
+	case schema.ConfigurationCategoryRouter:
+		_, err = parseRouterConfig(data)
+	case schema.ConfigurationCategorySessionInterceptor:
+		err = json.Unmarshal([]byte(data), &SessionInterceptorData{})
+	case schema.ConfigurationCategoryRequestConcurrency:
+		err = json.Unmarshal([]byte(data), &RequestLimitConfiguration{})
+	case schema.ConfigurationCategoryApplicationSetting:
+		err = json.Unmarshal([]byte(data), &ApplicationSetting{})
+	case schema.ConfigurationCategoryFeatureFlag:
+		_, err = flags.Parse(data)
+	case schema.ConfigurationCategoryMaintenance:
+		_, err = parseMaintenanceData(data)
+	}
+	if err != nil {
+		he := hes.Wrap(err)
+		he.Category = errConfigurationCategory
+		err = he
+	}
+	return
+}
+
+// configurationVersionQuery 配置版本查询
+func configurationVersionQuery(client *ent.ConfigurationVersionClient, id int) *ent.ConfigurationVersionQuery {
+	return client.Query().
+		Where(configurationversion.Configuration(id))
+}
+
+// configurationSnapshot 将配置版本转换为文本，用于按行对比
+func configurationSnapshot(v *ent.ConfigurationVersion) string {
+	if v == nil {
+		return ""
+	}
+	data := v.Data
+	// 如果是json则格式化，对比时可按字段展示差异
+	buf := &bytes.Buffer{}
+	if json.Indent(buf, []byte(data), "", "  ") == nil {
+		data = buf.String()
+	}
+	return strings.Join([]string{
+		"name: " + v.Name,
+		"category: " + v.Category,
+		fmt.Sprintf("status: %d", v.Status),
+		"startedAt: " + v.StartedAt.Format(time.RFC3339),
+		"endedAt: " + v.EndedAt.Format(time.RFC3339),
+		"data:",
+		data,
+	}, "\n")
+}
+
+// addConfigurationVersion 添加配置版本
+func addConfigurationVersion(ctx context.Context, tx *ent.Tx, conf *ent.Configuration, version int, author, reason string) (*ent.ConfigurationVersion, error) {
+	return tx.ConfigurationVersion.Create().
+		SetConfiguration(conf.ID).
+		SetVersion(version).
+		SetName(conf.Name).
+		SetCategory(conf.Category.String()).
+		SetStatus(conf.Status).
+		SetData(conf.Data).
+		SetStartedAt(conf.StartedAt).
+		SetEndedAt(conf.EndedAt).
+		SetAuthor(author).
+		SetReason(reason).
+		Save(ctx)
+}
+
+// isConfigurationChanged 判断配置与版本的快照是否不一致
+func isConfigurationChanged(conf *ent.Configuration, v *ent.ConfigurationVersion) bool {
+	return v.Name != conf.Name ||
+		v.Category != conf.Category.String() ||
+		v.Status != conf.Status ||
+		v.Data != conf.Data ||
+		!v.StartedAt.Equal(conf.StartedAt) ||
+		!v.EndedAt.Equal(conf.EndedAt)
+}
+
+// withConfigurationTx 在事务中执行配置的变更，成功后发布变更通知
+func withConfigurationTx(ctx context.Context, fn func(tx *ent.Tx) (*ent.Configuration, error)) (result *ent.Configuration, err error) {
+	tx, err := helper.EntGetClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	result, err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	// 通知所有实例刷新配置
+	PublishConfigurationInvalidation(ctx)
+	return
+}
+
+// Add 校验并添加配置，并保存为第一个版本
+func (*ConfigurationSrv) Add(ctx context.Context, params ConfigurationSaveParams) (*ent.Configuration, error) {
+	err := ValidateConfigurationData(params.Category, params.Data)
+	if err != nil {
+		return nil, err
+	}
+	return withConfigurationTx(ctx, func(tx *ent.Tx) (result *ent.Configuration, err error) {
+		result, err = tx.Configuration.Create().
+			SetName(params.Name).
+			SetStatus(params.Status).
+			SetCategory(params.Category).
+			SetData(params.Data).
+			SetOwner(params.Author).
+			SetStartedAt(params.StartedAt).
+			SetEndedAt(params.EndedAt).
+			Save(ctx)
+		if err != nil {
+			return
+		}
+		_, err = addConfigurationVersion(ctx, tx, result, 1, params.Author, params.Reason)
+		return
+	})
+}
+
+// Update 校验并更新配置，并保存为新的版本，配置无变化时不生成版本
+func (*ConfigurationSrv) Update(ctx context.Context, id int, params ConfigurationSaveParams) (*ent.Configuration, error) {
+	return withConfigurationTx(ctx, func(tx *ent.Tx) (result *ent.Configuration, err error) {
+		current, err := tx.Configuration.Get(ctx, id)
+		if err != nil {
+			return
+		}
+		latest, err := configurationVersionQuery(tx.ConfigurationVersion, id).
+			Order(ent.Desc(configurationversion.FieldVersion)).
+			First(ctx)
+		if err != nil && !ent.IsNotFound(err) {
+			return
+		}
+		err = nil
+		// 未有版本记录的配置（版本功能前添加的），先保存当前配置，以便可回滚
+		if latest == nil {
+			latest, err = addConfigurationVersion(ctx, tx, current, 1, current.Owner, "")
+			if err != nil {
+				return
+			}
+		}
+
+		updateOne := tx.Configuration.UpdateOneID(id)
+		if !params.StartedAt.IsZero() {
+			updateOne = updateOne.SetStartedAt(params.StartedAt)
+		}
+		if !params.EndedAt.IsZero() {
+			updateOne = updateOne.SetEndedAt(params.EndedAt)
+		}
+		if params.Name != "" {
+			updateOne = updateOne.SetName(params.Name)
+		}
+		if params.Status != 0 {
+			updateOne = updateOne.SetStatus(params.Status)
+		}
+		if params.Category != "" {
+			updateOne = updateOne.SetCategory(params.Category)
+		}
+		if params.Data != "" {
+			updateOne = updateOne.SetData(params.Data)
+		}
+		// 分类或数据有调整时，校验更新后的数据
+		if params.Category != "" || params.Data != "" {
+			category := current.Category
+			if params.Category != "" {
+				category = params.Category
+			}
+			data := current.Data
+			if params.Data != "" {
+				data = params.Data
+			}
+			err = ValidateConfigurationData(category, data)
+			if err != nil {
+				return
+			}
+		}
+		result, err = updateOne.Save(ctx)
+		if err != nil {
+			return
+		}
+		if !isConfigurationChanged(result, latest) {
+			return
+		}
+		_, err = addConfigurationVersion(ctx, tx, result, latest.Version+1, params.Author, params.Reason)
+		return
+	})
+}
+
+// GetVersion 获取配置的指定版本
+func (*ConfigurationSrv) GetVersion(ctx context.Context, id, version int) (*ent.ConfigurationVersion, error) {
+	return configurationVersionQuery(helper.EntGetClient().ConfigurationVersion, id).
+		Where(configurationversion.Version(version)).
+		First(ctx)
+}
+
+// DiffVersion 对比配置的两个版本，from为0时与上一版本对比
+func (srv *ConfigurationSrv) DiffVersion(ctx context.Context, id, from, to int) (diff *ConfigurationVersionDiff, err error) {
+	target, err := srv.GetVersion(ctx, id, to)
+	if err != nil {
+		return
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from >= to {
+		err = hes.New("对比的源版本需小于目标版本", errConfigurationCategory)
+		return
+	}
+	var source *ent.ConfigurationVersion
+	// 版本号从1开始，第一个版本与空配置对比
+	if from > 0 {
+		source, err = srv.GetVersion(ctx, id, from)
+		if err != nil {
+			return
+		}
+	}
+	lines := util.DiffLines(configurationSnapshot(source), configurationSnapshot(target))
+	diff = &ConfigurationVersionDiff{
+		From:  from,
+		To:    to,
+		Size:  util.DiffSize(lines),
+		Lines: lines,
+	}
+	return
+}
+
+// Rollback 将配置回滚至指定版本，回滚也会生成新的版本
+func (srv *ConfigurationSrv) Rollback(ctx context.Context, id, version int, author string) (*ent.Configuration, error) {
+	v, err := srv.GetVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return srv.Update(ctx, id, ConfigurationSaveParams{
+		Name:      v.Name,
+		Category:  configuration.Category(v.Category),
+		Status:    v.Status,
+		Data:      v.Data,
+		StartedAt: v.StartedAt,
+		EndedAt:   v.EndedAt,
+		Author:    author,
+		Reason:    fmt.Sprintf("回滚至版本%d", version),
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/configuration"
+	"github.com/vicanso/elite/schema"
+)
+
+func TestValidateConfigurationData(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		category configuration.Category
+		data     string
+		valid    bool
+	}{
+		{
+			category: configuration.CategoryMockTime,
+			data:     "2021-01-01T00:00:00+08:00",
+			valid:    true,
+		},
+		{
+			category: configuration.CategoryMockTime,
+			data:     "2021-01-01",
+		},
+		{
+			category: configuration.CategoryBlockIP,
+			data:     "192.168.1.0/24",
+			valid:    true,
+		},
+		{
+			category: configuration.CategoryBlockIP,
+			data:     "1.1.1",
+		},
+		{
+			category: configuration.CategorySignedKey,
+			data:     "a,b",
+			valid:    true,
+		},
+		{
+			category: configuration.CategorySignedKey,
+			data:     "a,",
+		},
+		{
+			category: configuration.CategoryRouterConcurrency,
+			data:     `{"route": "/users/v1/me", "method": "GET", "max": 10}`,
+			valid:    true,
+		},
+		{
+			category: configuration.CategoryRouterConcurrency,
+			data:     `{"route": "/users/v1/me", "method": "GET", "max": -1}`,
+		},
+		{
+			category: configuration.CategoryRouter,
+			data:     `{"route": "/users/v1/me", "method": "GET"`,
+		},
+		{
+			category: configuration.CategoryApplicationSetting,
+			data:     `{"latestVersion": "1.1.0", "applIcableVersion": ">=1.0.0"}`,
+			valid:    true,
+		},
+		{
+			category: configuration.CategoryApplicationSetting,
+			data:     `{"latestVersion": "1.1.0"}`,
+		},
+	}
+	for _, tt := range tests {
+		err := ValidateConfigurationData(tt.category, tt.data)
+		if tt.valid {
+			assert.Nil(err, tt.data)
+		} else {
+			assert.NotNil(err, tt.data)
+		}
+	}
+}
+
+func TestConfigurationSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(configurationSnapshot(nil))
+
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(`name: test
+category: router
+status: 1
+startedAt: 2021-01-01T00:00:00Z
+endedAt: 2021-01-01T00:00:00Z
+data:
+{
+  "route": "/"
+}`, configurationSnapshot(&ent.ConfigurationVersion{
+		Name:      "test",
+		Category:  "router",
+		Status:    schema.StatusEnabled,
+		StartedAt: date,
+		EndedAt:   date,
+		Data:      `{"route":"/"}`,
+	}))
+}
@@ -76,6 +76,11 @@ func (srv *fileSrv) Get(ctx context.Context, bucket, filename string) (*minio.Ob
 	return defaultMinioClient.GetObject(ctx, bucket, filename, minio.GetObjectOptions{})
 }
 
+// Remove 删除文件
+func (srv *fileSrv) Remove(ctx context.Context, bucket, filename string) error {
+	return defaultMinioClient.RemoveObject(ctx, bucket, filename, minio.RemoveObjectOptions{})
+}
+
 // GetData 获取文件内容及对应的http头
 func (srv *fileSrv) GetData(ctx context.Context, bucket, filename string) (data []byte, header http.Header, err error) {
 	object, err := srv.Get(ctx, bucket, filename)
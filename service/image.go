@@ -15,25 +15,63 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"mime"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/disintegration/imaging"
 	"github.com/vicanso/elite/config"
-	"github.com/vicanso/elite/util"
+	"github.com/vicanso/elite/log"
 	"github.com/vicanso/elton"
 	"github.com/vicanso/tiny/pb"
+	"go.uber.org/atomic"
+	"golang.org/x/image/webp"
 	"google.golang.org/grpc"
 )
 
 var (
-	grpcConn *grpc.ClientConn
+	tinyConfig       = config.GetTinyConfig()
+	imageOptimConfig = config.GetImageOptimConfig()
 
-	tinyConfig = config.GetTinyConfig()
+	defaultImageOptimizer = newImageOptimizer()
+)
+
+const (
+	imageOptimizerTiny  = "tiny"
+	imageOptimizerLocal = "local"
+
+	defaultJPEGQuality = 80
+)
+
+// 图片裁剪方式，与tiny服务的定义保持一致
+const (
+	// ImageCropNone 不裁剪，仅调整尺寸
+	ImageCropNone = iota
+	// ImageCropLeftTop 左上
+	ImageCropLeftTop
+	// ImageCropTopCenter 上中
+	ImageCropTopCenter
+	// ImageCropRightTop 右上
+	ImageCropRightTop
+	// ImageCropLeftCenter 左中
+	ImageCropLeftCenter
+	// ImageCropCenterCenter 居中
+	ImageCropCenterCenter
+	// ImageCropRightCenter 右中
+	ImageCropRightCenter
+	// ImageCropLeftBottom 左下
+	ImageCropLeftBottom
+	// ImageCropBottomCenter 下中
+	ImageCropBottomCenter
+	// ImageCropRightBottom 右下
+	ImageCropRightBottom
 )
 
 type (
@@ -47,45 +85,114 @@ type (
 		Height     int
 		Crop       int
 	}
+	// ImageOptimizer 图片优化
+	ImageOptimizer interface {
+		// Optimize 优化图片，返回优化后的数据以及实际输出的图片类型
+		Optimize(ctx context.Context, params *ImageOptimizeParams) (data []byte, imageType string, err error)
+	}
+	// tinyOptimizer 使用tiny服务（grpc）优化图片
+	tinyOptimizer struct {
+		conn *grpc.ClientConn
+	}
+	// localOptimizer 使用imaging在本地优化图片
+	localOptimizer struct{}
+	// fallbackOptimizer 优先使用primary优化，失败时使用fallback，
+	// primary连续失败时熔断，熔断期间直接使用fallback
+	fallbackOptimizer struct {
+		primary  ImageOptimizer
+		fallback ImageOptimizer
+		breaker  *circuitBreaker
+	}
+	// circuitBreaker 熔断器
+	circuitBreaker struct {
+		maxFailures   int32
+		breakDuration time.Duration
+		failures      atomic.Int32
+		// 熔断开始时间（unix nano），为0表示未熔断
+		openedAt atomic.Int64
+	}
 	// imageSrv image service
 	imageSrv struct {
-		fileSrv *fileSrv
+		fileSrv   *fileSrv
+		optimizer ImageOptimizer
 	}
 )
 
 func NewImageSrv() *imageSrv {
 	return &imageSrv{
-		fileSrv: NewFileSrv(),
+		fileSrv:   NewFileSrv(),
+		optimizer: defaultImageOptimizer,
 	}
 }
 
-func init() {
-	done := make(chan int)
-	go func() {
-		opts := make([]grpc.DialOption, 0)
-		opts = append(opts, grpc.WithInsecure())
-		if util.IsProduction() {
-			opts = append(opts, grpc.WithBlock())
-		}
-		target := fmt.Sprintf("%s:%d", tinyConfig.Host, tinyConfig.Port)
-		conn, err := grpc.Dial(target, opts...)
-		if err != nil {
-			panic(err)
-		}
-		done <- 1
-		grpcConn = conn
-	}()
-	select {
-	case <-done:
-	case <-time.After(5 * time.Second):
-		panic(errors.New("grpc dial timeout"))
+// newImageOptimizer 根据配置创建图片优化
+func newImageOptimizer() ImageOptimizer {
+	local := &localOptimizer{}
+	if imageOptimConfig.Optimizer == imageOptimizerLocal {
+		return local
+	}
+	tiny, err := newTinyOptimizer()
+	// 如果tiny服务初始化失败，则仅使用本地处理
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Msg("init tiny optimizer fail, use local optimizer")
+		return local
+	}
+	return &fallbackOptimizer{
+		primary:  tiny,
+		fallback: local,
+		breaker:  newCircuitBreaker(imageOptimConfig.MaxFailures, imageOptimConfig.BreakDuration),
+	}
+}
+
+// newTinyOptimizer 创建tiny优化，grpc连接为延时连接，不会阻塞程序启动
+func newTinyOptimizer() (*tinyOptimizer, error) {
+	target := fmt.Sprintf("%s:%d", tinyConfig.Host, tinyConfig.Port)
+	conn, err := grpc.Dial(target, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &tinyOptimizer{
+		conn: conn,
+	}, nil
+}
+
+// newCircuitBreaker 创建熔断器
+func newCircuitBreaker(maxFailures int, breakDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		maxFailures:   int32(maxFailures),
+		breakDuration: breakDuration,
 	}
 }
 
-// optimize image optimize
-func (*imageSrv) optimize(params *ImageOptimizeParams) (data []byte, err error) {
-	client := pb.NewOptimClient(grpcConn)
-	ctx, cancel := context.WithTimeout(context.Background(), tinyConfig.Timeout)
+// Allow 判断是否允许请求，熔断时长已过时允许请求尝试
+func (b *circuitBreaker) Allow() bool {
+	openedAt := b.openedAt.Load()
+	if openedAt == 0 {
+		return true
+	}
+	return time.Since(time.Unix(0, openedAt)) >= b.breakDuration
+}
+
+// Success 请求成功，重置熔断状态
+func (b *circuitBreaker) Success() {
+	b.failures.Store(0)
+	b.openedAt.Store(0)
+}
+
+// Fail 请求失败，连续失败次数达到限制则熔断
+func (b *circuitBreaker) Fail() {
+	count := b.failures.Inc()
+	if count >= b.maxFailures {
+		b.openedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// Optimize 使用tiny服务优化图片
+func (opt *tinyOptimizer) Optimize(ctx context.Context, params *ImageOptimizeParams) (data []byte, imageType string, err error) {
+	client := pb.NewOptimClient(opt.conn)
+	ctx, cancel := context.WithTimeout(ctx, tinyConfig.Timeout)
 	defer cancel()
 	in := &pb.OptimRequest{
 		Data:    params.Data,
@@ -115,9 +222,114 @@ func (*imageSrv) optimize(params *ImageOptimizeParams) (data []byte, err error)
 		return
 	}
 	data = reply.Data
+	imageType = params.Type
+	return
+}
+
+// cropImage 按裁剪方式裁剪图片
+func cropImage(img image.Image, crop, width, height int) image.Image {
+	currentWidth := img.Bounds().Dx()
+	currentHeight := img.Bounds().Dy()
+	if width == 0 || width > currentWidth {
+		width = currentWidth
+	}
+	if height == 0 || height > currentHeight {
+		height = currentHeight
+	}
+	x0 := 0
+	y0 := 0
+	switch crop {
+	case ImageCropTopCenter:
+		x0 = (currentWidth - width) / 2
+	case ImageCropRightTop:
+		x0 = currentWidth - width
+	case ImageCropLeftCenter:
+		y0 = (currentHeight - height) / 2
+	case ImageCropCenterCenter:
+		x0 = (currentWidth - width) / 2
+		y0 = (currentHeight - height) / 2
+	case ImageCropRightCenter:
+		x0 = currentWidth - width
+		y0 = (currentHeight - height) / 2
+	case ImageCropLeftBottom:
+		y0 = currentHeight - height
+	case ImageCropBottomCenter:
+		x0 = (currentWidth - width) / 2
+		y0 = currentHeight - height
+	case ImageCropRightBottom:
+		x0 = currentWidth - width
+		y0 = currentHeight - height
+	}
+	return imaging.Crop(img, image.Rect(x0, y0, x0+width, y0+height))
+}
+
+// Optimize 本地优化图片，由于纯go无webp编码，webp输出时使用jpeg
+func (*localOptimizer) Optimize(_ context.Context, params *ImageOptimizeParams) (data []byte, imageType string, err error) {
+	var img image.Image
+	reader := bytes.NewReader(params.Data)
+	switch params.SourceType {
+	case "webp":
+		img, err = webp.Decode(reader)
+	case "png":
+		img, err = png.Decode(reader)
+	case "jpg":
+		fallthrough
+	case "jpeg":
+		img, err = jpeg.Decode(reader)
+	default:
+		img, _, err = image.Decode(reader)
+	}
+	if err != nil {
+		return
+	}
+	if params.Width != 0 || params.Height != 0 {
+		if params.Crop == ImageCropNone {
+			img = imaging.Resize(img, params.Width, params.Height, imaging.Lanczos)
+		} else {
+			img = cropImage(img, params.Crop, params.Width, params.Height)
+		}
+	}
+	buffer := new(bytes.Buffer)
+	switch params.Type {
+	case "png":
+		imageType = "png"
+		encoder := png.Encoder{
+			CompressionLevel: png.BestCompression,
+		}
+		err = encoder.Encode(buffer, img)
+	default:
+		imageType = "jpeg"
+		quality := params.Quality
+		if quality <= 0 || quality > 100 {
+			quality = defaultJPEGQuality
+		}
+		err = jpeg.Encode(buffer, img, &jpeg.Options{
+			Quality: quality,
+		})
+	}
+	if err != nil {
+		return
+	}
+	data = buffer.Bytes()
 	return
 }
 
+// Optimize 优先使用primary优化图片，失败或熔断时使用fallback
+func (opt *fallbackOptimizer) Optimize(ctx context.Context, params *ImageOptimizeParams) (data []byte, imageType string, err error) {
+	if opt.breaker.Allow() {
+		data, imageType, err = opt.primary.Optimize(ctx, params)
+		if err == nil {
+			opt.breaker.Success()
+			return
+		}
+		opt.breaker.Fail()
+		log.Default().Error().
+			Err(err).
+			Msg("primary image optimizer fail, use fallback")
+	}
+	return opt.fallback.Optimize(ctx, params)
+}
+
 // GetImageFromBucket get image from bucket
 func (srv *imageSrv) GetImageFromBucket(ctx context.Context, bucket, filename string, params ImageOptimizeParams) (data []byte, header http.Header, err error) {
 	data, header, err = srv.fileSrv.GetData(ctx, bucket, filename)
@@ -128,11 +340,11 @@ func (srv *imageSrv) GetImageFromBucket(ctx context.Context, bucket, filename st
 	source := strings.Split(contentType, "/")[1]
 	params.Data = data
 	params.SourceType = source
-	data, err = srv.optimize(&params)
+	data, imageType, err := srv.optimizer.Optimize(ctx, &params)
 	if err != nil {
 		return
 	}
-	header.Set(elton.HeaderContentType, mime.TypeByExtension("."+params.Type))
+	header.Set(elton.HeaderContentType, mime.TypeByExtension("."+imageType))
 
 	return
 }
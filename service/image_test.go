@@ -0,0 +1,134 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errImageOptimizer struct {
+	count int
+}
+
+func (opt *errImageOptimizer) Optimize(_ context.Context, _ *ImageOptimizeParams) ([]byte, string, error) {
+	opt.count++
+	return nil, "", errors.New("optimize fail")
+}
+
+func newTestPNG() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	buffer := new(bytes.Buffer)
+	_ = png.Encode(buffer, img)
+	return buffer.Bytes()
+}
+
+func TestLocalOptimizer(t *testing.T) {
+	assert := assert.New(t)
+	opt := &localOptimizer{}
+
+	// 调整尺寸并转换为jpeg
+	data, imageType, err := opt.Optimize(context.TODO(), &ImageOptimizeParams{
+		Data:       newTestPNG(),
+		SourceType: "png",
+		Type:       "jpg",
+		Quality:    70,
+		Width:      50,
+	})
+	assert.Nil(err)
+	assert.Equal("jpeg", imageType)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.Nil(err)
+	assert.Equal(50, img.Bounds().Dx())
+	assert.Equal(25, img.Bounds().Dy())
+
+	// webp无法本地编码，使用jpeg
+	_, imageType, err = opt.Optimize(context.TODO(), &ImageOptimizeParams{
+		Data:       newTestPNG(),
+		SourceType: "png",
+		Type:       "webp",
+	})
+	assert.Nil(err)
+	assert.Equal("jpeg", imageType)
+
+	// 裁剪
+	data, imageType, err = opt.Optimize(context.TODO(), &ImageOptimizeParams{
+		Data:       newTestPNG(),
+		SourceType: "png",
+		Type:       "png",
+		Width:      20,
+		Height:     20,
+		Crop:       ImageCropCenterCenter,
+	})
+	assert.Nil(err)
+	assert.Equal("png", imageType)
+	img, err = png.Decode(bytes.NewReader(data))
+	assert.Nil(err)
+	assert.Equal(20, img.Bounds().Dx())
+	assert.Equal(20, img.Bounds().Dy())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	b := newCircuitBreaker(2, 10*time.Millisecond)
+	assert.True(b.Allow())
+	b.Fail()
+	assert.True(b.Allow())
+	b.Fail()
+	assert.False(b.Allow())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(b.Allow())
+	b.Success()
+	assert.True(b.Allow())
+}
+
+func TestFallbackOptimizer(t *testing.T) {
+	assert := assert.New(t)
+	primary := &errImageOptimizer{}
+	opt := &fallbackOptimizer{
+		primary:  primary,
+		fallback: &localOptimizer{},
+		breaker:  newCircuitBreaker(1, time.Minute),
+	}
+	params := &ImageOptimizeParams{
+		Data:       newTestPNG(),
+		SourceType: "png",
+		Type:       "png",
+	}
+	_, imageType, err := opt.Optimize(context.TODO(), params)
+	assert.Nil(err)
+	assert.Equal("png", imageType)
+	assert.Equal(1, primary.count)
+
+	// 已熔断，不再调用primary
+	_, _, err = opt.Optimize(context.TODO(), params)
+	assert.Nil(err)
+	assert.Equal(1, primary.count)
+}
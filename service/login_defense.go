@@ -0,0 +1,317 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 登录防护，分别按账户、IP与IP网段统计滑动窗口内的登录失败次数，
+// 失败后需等待的时长逐次翻倍，失败较多时要求更长的图形验证码，
+// 达到上限则临时锁定，锁定可由管理员解除
+
+package service
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/util"
+)
+
+const (
+	// 登录失败记录（sorted set），score为失败时间（毫秒）
+	loginDefenseFailureKeyPrefix = "loginDefenseFailures:"
+	// 锁定记录，有效期为锁定时长
+	loginDefenseLockKeyPrefix = "loginDefenseLock:"
+	// 锁定记录的索引（sorted set），score为解锁时间（秒），用于查询当前锁定列表
+	loginDefenseLockIndexKey = "loginDefenseLocks"
+)
+
+var loginDefenseConfig = config.GetLoginDefenseConfig()
+
+type (
+	// LoginDefenseTarget 登录防护的统计对象
+	LoginDefenseTarget struct {
+		Category string `json:"category"`
+		Value    string `json:"value"`
+	}
+	// LoginDefenseLock 登录锁定记录
+	LoginDefenseLock struct {
+		Category string `json:"category"`
+		Value    string `json:"value"`
+		// 锁定时的失败次数
+		Failures  int       `json:"failures"`
+		LockedAt  time.Time `json:"lockedAt"`
+		ExpiredAt time.Time `json:"expiredAt"`
+	}
+	// LoginDefenseStatus 登录防护状态
+	LoginDefenseStatus struct {
+		// 已锁定则为对应的锁定记录
+		Lock *LoginDefenseLock
+		// 需要等待多久才可再次登录
+		RetryAfter time.Duration
+		// 是否需要更长的图形验证码
+		StrongCaptcha bool
+	}
+)
+
+// key 统计对象对应的key
+func (target LoginDefenseTarget) key() string {
+	return target.Category + ":" + target.Value
+}
+
+// limit 统计对象对应的锁定上限
+func (target LoginDefenseTarget) limit() int {
+	switch target.Category {
+	case cs.LoginDefenseAccount:
+		return loginDefenseConfig.AccountLimit
+	case cs.LoginDefenseIP:
+		return loginDefenseConfig.IPLimit
+	default:
+		return loginDefenseConfig.SubnetLimit
+	}
+}
+
+// GetIPSubnet 获取IP所在的网段，IPv4为/24，IPv6为/64，非法IP则返回空字符串
+func GetIPSubnet(ip string) string {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return ""
+	}
+	if v4 := parsedIP.To4(); v4 != nil {
+		return (&net.IPNet{
+			IP:   v4.Mask(net.CIDRMask(24, 32)),
+			Mask: net.CIDRMask(24, 32),
+		}).String()
+	}
+	return (&net.IPNet{
+		IP:   parsedIP.Mask(net.CIDRMask(64, 128)),
+		Mask: net.CIDRMask(64, 128),
+	}).String()
+}
+
+// NewLoginDefenseTargets 获取登录请求对应的统计对象
+func NewLoginDefenseTargets(account, ip string) []LoginDefenseTarget {
+	targets := make([]LoginDefenseTarget, 0, 3)
+	if account != "" {
+		targets = append(targets, LoginDefenseTarget{
+			Category: cs.LoginDefenseAccount,
+			Value:    account,
+		})
+	}
+	if ip != "" {
+		targets = append(targets, LoginDefenseTarget{
+			Category: cs.LoginDefenseIP,
+			Value:    ip,
+		})
+	}
+	subnet := GetIPSubnet(ip)
+	if subnet != "" {
+		targets = append(targets, LoginDefenseTarget{
+			Category: cs.LoginDefenseSubnet,
+			Value:    subnet,
+		})
+	}
+	return targets
+}
+
+// GetLoginBackoff 获取失败count次后需等待的时长
+func GetLoginBackoff(count int) time.Duration {
+	if count <= 0 {
+		return 0
+	}
+	backoff := loginDefenseConfig.BackoffBase
+	for i := 1; i < count; i++ {
+		backoff *= 2
+		if backoff >= loginDefenseConfig.BackoffMax {
+			return loginDefenseConfig.BackoffMax
+		}
+	}
+	return backoff
+}
+
+// getLoginFailures 获取窗口内的失败次数及最近一次失败时间
+func getLoginFailures(ctx context.Context, target LoginDefenseTarget) (count int, lastFailedAt time.Time, err error) {
+	client := helper.RedisGetClient()
+	key := loginDefenseFailureKeyPrefix + target.key()
+	min := time.Now().Add(-loginDefenseConfig.Window).UnixNano() / int64(time.Millisecond)
+	err = client.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(min, 10)).Err()
+	if err != nil {
+		return
+	}
+	result, err := client.ZRevRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	count = len(result)
+	if count != 0 {
+		ms := int64(result[0].Score)
+		lastFailedAt = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return
+}
+
+// getLoginDefenseLock 获取锁定记录，未锁定则返回nil
+func getLoginDefenseLock(ctx context.Context, target LoginDefenseTarget) (lock *LoginDefenseLock, err error) {
+	lock = &LoginDefenseLock{}
+	err = redisSrv.GetStruct(ctx, loginDefenseLockKeyPrefix+target.key(), lock)
+	if err != nil {
+		lock = nil
+		if helper.RedisIsNilError(err) {
+			err = nil
+		}
+		return
+	}
+	return
+}
+
+// GetLoginDefenseStatus 获取登录防护状态，任一统计对象锁定则为锁定，
+// 等待时长与是否需要更长的验证码按失败最多的统计对象计算
+func GetLoginDefenseStatus(ctx context.Context, targets []LoginDefenseTarget) (status *LoginDefenseStatus, err error) {
+	status = &LoginDefenseStatus{}
+	for _, target := range targets {
+		lock, e := getLoginDefenseLock(ctx, target)
+		if e != nil {
+			err = e
+			return
+		}
+		if lock != nil {
+			status.Lock = lock
+			return
+		}
+		count, lastFailedAt, e := getLoginFailures(ctx, target)
+		if e != nil {
+			err = e
+			return
+		}
+		if count >= loginDefenseConfig.CaptchaThreshold {
+			status.StrongCaptcha = true
+		}
+		retryAfter := GetLoginBackoff(count) - time.Since(lastFailedAt)
+		if retryAfter > status.RetryAfter {
+			status.RetryAfter = retryAfter
+		}
+	}
+	return
+}
+
+// lockLoginDefenseTarget 锁定统计对象
+func lockLoginDefenseTarget(ctx context.Context, target LoginDefenseTarget, failures int) (err error) {
+	now := time.Now()
+	lock := &LoginDefenseLock{
+		Category:  target.Category,
+		Value:     target.Value,
+		Failures:  failures,
+		LockedAt:  now,
+		ExpiredAt: now.Add(loginDefenseConfig.LockTTL),
+	}
+	err = redisSrv.SetStruct(ctx, loginDefenseLockKeyPrefix+target.key(), lock, loginDefenseConfig.LockTTL)
+	if err != nil {
+		return
+	}
+	return helper.RedisGetClient().ZAdd(ctx, loginDefenseLockIndexKey, &redis.Z{
+		Score:  float64(lock.ExpiredAt.Unix()),
+		Member: target.key(),
+	}).Err()
+}
+
+// AddLoginFailure 记录登录失败，失败次数达到上限的统计对象则锁定
+func AddLoginFailure(ctx context.Context, targets []LoginDefenseTarget) (err error) {
+	client := helper.RedisGetClient()
+	now := time.Now()
+	for _, target := range targets {
+		key := loginDefenseFailureKeyPrefix + target.key()
+		pipe := client.TxPipeline()
+		pipe.ZAdd(ctx, key, &redis.Z{
+			Score:  float64(now.UnixNano() / int64(time.Millisecond)),
+			Member: util.GenXID(),
+		})
+		pipe.Expire(ctx, key, loginDefenseConfig.Window)
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return
+		}
+		count, _, e := getLoginFailures(ctx, target)
+		if e != nil {
+			err = e
+			return
+		}
+		if count >= target.limit() {
+			err = lockLoginDefenseTarget(ctx, target, count)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ClearLoginFailures 清除统计对象的失败记录（如登录成功时清除账户的失败记录）
+func ClearLoginFailures(ctx context.Context, target LoginDefenseTarget) error {
+	return helper.RedisGetClient().Del(ctx, loginDefenseFailureKeyPrefix+target.key()).Err()
+}
+
+// UnlockLoginDefense 解除锁定并清除失败记录
+func UnlockLoginDefense(ctx context.Context, target LoginDefenseTarget) (err error) {
+	client := helper.RedisGetClient()
+	pipe := client.TxPipeline()
+	pipe.ZRem(ctx, loginDefenseLockIndexKey, target.key())
+	pipe.Del(ctx, loginDefenseFailureKeyPrefix+target.key())
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return
+	}
+	_, err = redisSrv.Del(ctx, loginDefenseLockKeyPrefix+target.key())
+	return
+}
+
+// ListLoginDefenseLocks 获取当前锁定的账户、IP与网段，按解锁时间排序，
+// 已解锁的则从索引中清除
+func ListLoginDefenseLocks(ctx context.Context) (locks []*LoginDefenseLock, err error) {
+	client := helper.RedisGetClient()
+	err = client.ZRemRangeByScore(ctx, loginDefenseLockIndexKey, "-inf", strconv.FormatInt(time.Now().Unix(), 10)).Err()
+	if err != nil {
+		return
+	}
+	keys, err := client.ZRange(ctx, loginDefenseLockIndexKey, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	locks = make([]*LoginDefenseLock, 0, len(keys))
+	for _, key := range keys {
+		arr := strings.SplitN(key, ":", 2)
+		if len(arr) != 2 {
+			continue
+		}
+		lock, e := getLoginDefenseLock(ctx, LoginDefenseTarget{
+			Category: arr[0],
+			Value:    arr[1],
+		})
+		if e != nil {
+			err = e
+			return
+		}
+		if lock != nil {
+			locks = append(locks, lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].ExpiredAt.Before(locks[j].ExpiredAt)
+	})
+	return
+}
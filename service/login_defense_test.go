@@ -0,0 +1,69 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/cs"
+)
+
+func TestGetIPSubnet(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1.2.3.0/24", GetIPSubnet("1.2.3.4"))
+	assert.Equal("2001:db8:1:2::/64", GetIPSubnet("2001:db8:1:2:3:4:5:6"))
+	assert.Equal("", GetIPSubnet("abc"))
+}
+
+func TestNewLoginDefenseTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	targets := NewLoginDefenseTargets("treexie", "1.2.3.4")
+	assert.Equal([]LoginDefenseTarget{
+		{
+			Category: cs.LoginDefenseAccount,
+			Value:    "treexie",
+		},
+		{
+			Category: cs.LoginDefenseIP,
+			Value:    "1.2.3.4",
+		},
+		{
+			Category: cs.LoginDefenseSubnet,
+			Value:    "1.2.3.0/24",
+		},
+	}, targets)
+	assert.Equal(5, targets[0].limit())
+	assert.Equal(20, targets[1].limit())
+	assert.Equal(50, targets[2].limit())
+
+	// 无账户
+	targets = NewLoginDefenseTargets("", "1.2.3.4")
+	assert.Equal(2, len(targets))
+}
+
+func TestGetLoginBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), GetLoginBackoff(0))
+	assert.Equal(time.Second, GetLoginBackoff(1))
+	assert.Equal(2*time.Second, GetLoginBackoff(2))
+	assert.Equal(16*time.Second, GetLoginBackoff(5))
+	assert.Equal(30*time.Second, GetLoginBackoff(6))
+	assert.Equal(30*time.Second, GetLoginBackoff(100))
+}
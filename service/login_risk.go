@@ -0,0 +1,154 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 登录风险检测，将本次登录与账户的历史登录记录对比，
+// 根据新的国家、新的设备、不可能的移动速度以及同一IP登录多个账户计算风险分值
+
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/userlogin"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/util"
+)
+
+// 登录风险原因
+const (
+	// LoginRiskNewCountry 首次在该国家登录
+	LoginRiskNewCountry = "newCountry"
+	// LoginRiskNewDevice 首次使用该设备（user-agent）登录
+	LoginRiskNewDevice = "newDevice"
+	// LoginRiskImpossibleTravel 短时间内更换国家登录
+	LoginRiskImpossibleTravel = "impossibleTravel"
+	// LoginRiskSharedIP 同一IP登录多个账户
+	LoginRiskSharedIP = "sharedIP"
+)
+
+// loginRiskScores 各风险原因对应的分值
+var loginRiskScores = map[string]int{
+	LoginRiskNewCountry:       30,
+	LoginRiskNewDevice:        20,
+	LoginRiskImpossibleTravel: 40,
+	LoginRiskSharedIP:         30,
+}
+
+const loginRiskMaxScore = 100
+
+var loginRiskConfig = config.GetLoginRiskConfig()
+
+type (
+	// LoginRiskParams 登录风险检测参数
+	LoginRiskParams struct {
+		Account   string
+		IP        string
+		UserAgent string
+		Country   string
+		LoginAt   time.Time
+	}
+	// LoginRisk 登录风险
+	LoginRisk struct {
+		Score   int      `json:"score"`
+		Reasons []string `json:"reasons"`
+	}
+)
+
+// ShouldStepUp 判断是否需要完成两步验证或邮件确认
+func (risk *LoginRisk) ShouldStepUp() bool {
+	return loginRiskConfig.StepUpScore > 0 &&
+		risk.Score >= loginRiskConfig.StepUpScore
+}
+
+// ShouldNotify 判断是否需要通知用户
+func (risk *LoginRisk) ShouldNotify() bool {
+	return loginRiskConfig.NotifyScore > 0 &&
+		risk.Score >= loginRiskConfig.NotifyScore
+}
+
+// CalcLoginRisk 根据账户的历史登录记录（按时间倒序）与该IP登录的账户数计算风险，
+// 由于IP定位仅能获取到城市，因此以在较短时间内更换国家视为不可能的移动速度
+func CalcLoginRisk(params LoginRiskParams, history []*ent.UserLogin, ipAccountCount int) *LoginRisk {
+	reasons := make([]string, 0)
+	// 首次登录无历史记录，不判断新国家与新设备
+	if len(history) != 0 {
+		countries := make([]string, 0)
+		userAgents := make([]string, 0)
+		for _, item := range history {
+			if item.Country != "" {
+				countries = append(countries, item.Country)
+			}
+			userAgents = append(userAgents, item.UserAgent)
+		}
+		if params.Country != "" &&
+			len(countries) != 0 &&
+			!util.ContainsString(countries, params.Country) {
+			reasons = append(reasons, LoginRiskNewCountry)
+		}
+		if !util.ContainsString(userAgents, params.UserAgent) {
+			reasons = append(reasons, LoginRiskNewDevice)
+		}
+		last := history[0]
+		if params.Country != "" &&
+			last.Country != "" &&
+			last.Country != params.Country &&
+			params.LoginAt.Sub(last.CreatedAt) < loginRiskConfig.TravelInterval {
+			reasons = append(reasons, LoginRiskImpossibleTravel)
+		}
+	}
+	if ipAccountCount >= loginRiskConfig.IPAccountLimit {
+		reasons = append(reasons, LoginRiskSharedIP)
+	}
+	score := 0
+	for _, reason := range reasons {
+		score += loginRiskScores[reason]
+	}
+	if score > loginRiskMaxScore {
+		score = loginRiskMaxScore
+	}
+	return &LoginRisk{
+		Score:   score,
+		Reasons: reasons,
+	}
+}
+
+// EvaluateLoginRisk 获取账户的历史登录记录与该IP登录的账户数，计算本次登录的风险
+func EvaluateLoginRisk(ctx context.Context, params LoginRiskParams) (risk *LoginRisk, err error) {
+	client := helper.EntGetClient()
+	history, err := client.UserLogin.Query().
+		Where(userlogin.Account(params.Account)).
+		Order(ent.Desc(userlogin.FieldCreatedAt)).
+		Limit(loginRiskConfig.HistoryLimit).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	accounts, err := client.UserLogin.Query().
+		Where(
+			userlogin.IP(params.IP),
+			userlogin.CreatedAtGTE(params.LoginAt.Add(-loginRiskConfig.IPAccountWindow)),
+		).
+		GroupBy(userlogin.FieldAccount).
+		Strings(ctx)
+	if err != nil {
+		return
+	}
+	// 包括本次登录的账户
+	accounts = appendUniqueStrings(accounts, params.Account)
+	risk = CalcLoginRisk(params, history, len(accounts))
+	return
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/ent"
+)
+
+func TestCalcLoginRisk(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	params := LoginRiskParams{
+		Account:   "treexie",
+		IP:        "1.1.1.1",
+		UserAgent: "Chrome",
+		Country:   "中国",
+		LoginAt:   now,
+	}
+
+	// 首次登录
+	risk := CalcLoginRisk(params, nil, 1)
+	assert.Equal(0, risk.Score)
+	assert.Empty(risk.Reasons)
+	assert.False(risk.ShouldStepUp())
+	assert.False(risk.ShouldNotify())
+
+	// 与历史记录一致
+	history := []*ent.UserLogin{
+		{
+			CreatedAt: now.Add(-time.Hour),
+			UserAgent: "Chrome",
+			Country:   "中国",
+		},
+	}
+	risk = CalcLoginRisk(params, history, 1)
+	assert.Equal(0, risk.Score)
+
+	// 新设备
+	history[0].UserAgent = "Firefox"
+	risk = CalcLoginRisk(params, history, 1)
+	assert.Equal(20, risk.Score)
+	assert.Equal([]string{LoginRiskNewDevice}, risk.Reasons)
+
+	// 新国家且短时间内更换国家
+	history[0].UserAgent = "Chrome"
+	history[0].Country = "美国"
+	risk = CalcLoginRisk(params, history, 1)
+	assert.Equal(70, risk.Score)
+	assert.Equal([]string{
+		LoginRiskNewCountry,
+		LoginRiskImpossibleTravel,
+	}, risk.Reasons)
+	assert.True(risk.ShouldStepUp())
+	assert.True(risk.ShouldNotify())
+
+	// 间隔较长则非不可能的移动速度
+	history[0].CreatedAt = now.Add(-24 * time.Hour)
+	risk = CalcLoginRisk(params, history, 1)
+	assert.Equal([]string{LoginRiskNewCountry}, risk.Reasons)
+
+	// 所有原因均触发，最高100分
+	history[0].CreatedAt = now.Add(-time.Hour)
+	history[0].UserAgent = "Firefox"
+	risk = CalcLoginRisk(params, history, 5)
+	assert.Equal(100, risk.Score)
+	assert.Equal(4, len(risk.Reasons))
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/hes"
+	"gopkg.in/gomail.v2"
+)
+
+const errMailCategory = "mail"
+
+// 邮件模板
+const (
+	// MailTemplatePasswordReset 重置密码邮件模板
+	MailTemplatePasswordReset = "password_reset.html"
+	// MailTemplateEmailVerify 验证邮箱邮件模板
+	MailTemplateEmailVerify = "email_verify.html"
+	// MailTemplateLoginRisk 异常登录提醒邮件模板
+	MailTemplateLoginRisk = "login_risk.html"
+	// MailTemplateLoginConfirm 确认登录邮件模板
+	MailTemplateLoginConfirm = "login_confirm.html"
+)
+
+//go:embed template/*.html
+var mailTemplateFS embed.FS
+
+var mailTemplates = template.Must(template.ParseFS(mailTemplateFS, "template/*.html"))
+
+// dialAndSend 发送邮件，一次只允许一个email发送（由于使用的邮件服务有限制）
+func dialAndSend(d *gomail.Dialer, m *gomail.Message) error {
+	sendingMailMutex.Lock()
+	defer sendingMailMutex.Unlock()
+	err := d.DialAndSend(m)
+	if err != nil {
+		log.Default().Error().
+			Err(err).
+			Msg("send mail fail")
+	}
+	return err
+}
+
+// SendMail 发送html邮件
+func SendMail(to []string, subject, html string) error {
+	d := newMailDialer()
+	if d == nil {
+		return hes.New("未配置邮件服务", errMailCategory)
+	}
+	m := gomail.NewMessage()
+	m.SetHeader("From", mailConfig.User)
+	m.SetHeader("To", to...)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", html)
+	return dialAndSend(d, m)
+}
+
+// RenderMailTemplate 根据模板生成邮件内容
+func RenderMailTemplate(name string, data interface{}) (string, error) {
+	buffer := new(bytes.Buffer)
+	err := mailTemplates.ExecuteTemplate(buffer, name, data)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// SendTemplateMail 使用模板发送邮件
+func SendTemplateMail(to []string, subject, name string, data interface{}) error {
+	html, err := RenderMailTemplate(name, data)
+	if err != nil {
+		return err
+	}
+	return SendMail(to, subject, html)
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMailTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	html, err := RenderMailTemplate(MailTemplatePasswordReset, map[string]string{
+		"App":     "elite",
+		"Account": "tree",
+		"URL":     "http://127.0.0.1/?token=abc&a=1",
+		"TTL":     "30分钟",
+	})
+	assert.Nil(err)
+	assert.Contains(html, "tree，您好")
+	assert.Contains(html, "http://127.0.0.1/?token=abc&amp;a=1")
+}
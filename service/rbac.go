@@ -0,0 +1,148 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 基于角色的权限控制，用户的角色包括其自身的角色与所在分组授予的角色，
+// 权限为所有角色的权限合集（su拥有所有权限）
+
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/permission"
+	"github.com/vicanso/elite/ent/role"
+	"github.com/vicanso/elite/ent/usergroup"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/util"
+)
+
+// rbacVersionKey 权限配置的版本，角色、分组或权限变化时更新，
+// session中的权限版本不一致时重新获取
+const rbacVersionKey = "rbacVersion"
+
+// GetRBACVersion 获取权限配置的版本
+func GetRBACVersion(ctx context.Context) (string, error) {
+	data, err := redisSrv.GetIgnoreNilErr(ctx, rbacVersionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// UpdateRBACVersion 更新权限配置的版本，有效期与session一致
+func UpdateRBACVersion(ctx context.Context) error {
+	return redisSrv.Set(ctx, rbacVersionKey, util.GenXID(), sessionConfig.TTL)
+}
+
+// InitRBAC 初始化内置的权限与角色，已存在的则忽略
+func InitRBAC(ctx context.Context) error {
+	client := helper.EntGetClient()
+	for _, item := range schema.GetPermissionList() {
+		exists, err := client.Permission.Query().
+			Where(permission.Name(item.Value)).
+			Exist(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = client.Permission.Create().
+			SetName(item.Value).
+			SetDescription(item.Name).
+			Save(ctx)
+		// 多实例同时初始化时可能已添加
+		if err != nil && !ent.IsConstraintError(err) {
+			return err
+		}
+	}
+	defaultRolePermissions := schema.GetDefaultRolePermissions()
+	for _, item := range schema.GetUserRoleList() {
+		exists, err := client.Role.Query().
+			Where(role.Name(item.Value)).
+			Exist(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = client.Role.Create().
+			SetName(item.Value).
+			SetDescription(item.Name).
+			SetPermissions(defaultRolePermissions[item.Value]).
+			Save(ctx)
+		if err != nil && !ent.IsConstraintError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUniqueStrings 添加不存在的字符串
+func appendUniqueStrings(arr []string, values ...string) []string {
+	for _, value := range values {
+		if !util.ContainsString(arr, value) {
+			arr = append(arr, value)
+		}
+	}
+	return arr
+}
+
+// ResolveUserPermissions 获取用户的所有角色（包括分组授予的角色）及权限
+func ResolveUserPermissions(ctx context.Context, roles, groups []string) (resolvedRoles, permissions []string, err error) {
+	client := helper.EntGetClient()
+	resolvedRoles = appendUniqueStrings(make([]string, 0), roles...)
+	if len(groups) != 0 {
+		userGroups, e := client.UserGroup.Query().
+			Where(usergroup.NameIn(groups...)).
+			All(ctx)
+		if e != nil {
+			err = e
+			return
+		}
+		for _, item := range userGroups {
+			resolvedRoles = appendUniqueStrings(resolvedRoles, item.Roles...)
+		}
+	}
+	permissions = make([]string, 0)
+	// su拥有所有权限
+	if util.ContainsString(resolvedRoles, schema.UserRoleSu) {
+		items, e := client.Permission.Query().
+			All(ctx)
+		if e != nil {
+			err = e
+			return
+		}
+		for _, item := range items {
+			permissions = appendUniqueStrings(permissions, item.Name)
+		}
+	} else if len(resolvedRoles) != 0 {
+		items, e := client.Role.Query().
+			Where(role.NameIn(resolvedRoles...)).
+			All(ctx)
+		if e != nil {
+			err = e
+			return
+		}
+		for _, item := range items {
+			permissions = appendUniqueStrings(permissions, item.Permissions...)
+		}
+	}
+	sort.Strings(permissions)
+	return
+}
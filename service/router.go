@@ -155,12 +155,31 @@ func (l *rcLimiter) GetStats() map[string]uint32 {
 	return result
 }
 
+// parseRouterConfig 解析路由mock配置
+func parseRouterConfig(data string) (*RouterConfig, error) {
+	v := &RouterConfig{}
+	err := json.Unmarshal([]byte(data), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parseRouterConcurrencyConfig 解析路由并发配置
+func parseRouterConcurrencyConfig(data string) (*routerConcurrencyConfig, error) {
+	v := &routerConcurrencyConfig{}
+	err := json.Unmarshal([]byte(data), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 // 更新router config配置
 func updateRouterMockConfigs(configs []string) {
 	result := make(map[string]*RouterConfig)
 	for _, item := range configs {
-		v := &RouterConfig{}
-		err := json.Unmarshal([]byte(item), v)
+		v, err := parseRouterConfig(item)
 		if err != nil {
 			log.Default().Error().
 				Err(err).
@@ -215,8 +234,7 @@ func GetRouterConcurrencyLimiter() *rcLimiter {
 func ResetRouterConcurrency(arr []string) {
 	concurrencyConfigList := make([]*routerConcurrencyConfig, 0)
 	for _, str := range arr {
-		v := &routerConcurrencyConfig{}
-		err := json.Unmarshal([]byte(str), v)
+		v, err := parseRouterConcurrencyConfig(str)
 		if err != nil {
 			log.Default().Error().
 				Err(err).
@@ -0,0 +1,227 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 访问令牌（bearer token），令牌与session绑定，
+// 认证时加载对应的session，因此与cookie session的处理一致
+
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	authTokenRevokedKeyPrefix = "authTokenRevoked:"
+
+	errAuthTokenCategory = "authToken"
+)
+
+// 令牌类型
+const (
+	// AuthTokenAccess 访问令牌
+	AuthTokenAccess = "access"
+	// AuthTokenRefresh 刷新令牌
+	AuthTokenRefresh = "refresh"
+)
+
+var authTokenConfig = config.GetAuthTokenConfig()
+
+// ErrAuthTokenInvalid 访问令牌无效或已过期
+var ErrAuthTokenInvalid = &hes.Error{
+	Message:    "访问令牌无效或已过期",
+	StatusCode: http.StatusUnauthorized,
+	Category:   errAuthTokenCategory,
+}
+
+type (
+	// AuthTokenClaims 令牌中的数据
+	AuthTokenClaims struct {
+		// 令牌的唯一标识，用于吊销
+		ID string `json:"jti"`
+		// 令牌绑定的session id
+		SID string `json:"sid"`
+		// 账户
+		Account string `json:"account"`
+		// 令牌类型
+		Category string `json:"category"`
+		// 过期时间（unix时间戳）
+		ExpiredAt int64 `json:"exp"`
+	}
+	// AuthTokenPair 访问令牌与刷新令牌
+	AuthTokenPair struct {
+		AccessToken string `json:"accessToken"`
+		// 访问令牌的有效期（秒）
+		ExpiresIn    int    `json:"expiresIn"`
+		RefreshToken string `json:"refreshToken"`
+		TokenType    string `json:"tokenType"`
+	}
+)
+
+// signAuthToken 使用key对数据签名
+func signAuthToken(key, payload string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	_, _ = h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// encodeAuthToken 生成令牌，格式为：base64(数据).签名
+func encodeAuthToken(claims *AuthTokenClaims) (token string, err error) {
+	buf, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(buf)
+	token = payload + "." + signAuthToken(authTokenConfig.Keys[0], payload)
+	return
+}
+
+// decodeAuthToken 校验签名、类型及有效期并获取令牌中的数据
+func decodeAuthToken(token, category string) (claims *AuthTokenClaims, err error) {
+	arr := strings.Split(token, ".")
+	if len(arr) != 2 {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	payload := arr[0]
+	valid := false
+	for _, key := range authTokenConfig.Keys {
+		if hmac.Equal([]byte(arr[1]), []byte(signAuthToken(key, payload))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	claims = &AuthTokenClaims{}
+	err = json.Unmarshal(buf, claims)
+	if err != nil {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	if claims.Category != category ||
+		claims.SID == "" ||
+		claims.ExpiredAt <= time.Now().Unix() {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	return
+}
+
+// newAuthToken 生成指定类型的令牌
+func newAuthToken(sid, account, category string, ttl time.Duration) (string, error) {
+	buf, err := util.RandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return encodeAuthToken(&AuthTokenClaims{
+		ID:        hex.EncodeToString(buf),
+		SID:       sid,
+		Account:   account,
+		Category:  category,
+		ExpiredAt: time.Now().Add(ttl).Unix(),
+	})
+}
+
+// getAuthTokenRevokedKey 获取令牌吊销记录的key
+func getAuthTokenRevokedKey(claims *AuthTokenClaims) string {
+	return authTokenRevokedKeyPrefix + claims.ID
+}
+
+// getAuthTokenTTL 获取令牌的剩余有效期
+func getAuthTokenTTL(claims *AuthTokenClaims) time.Duration {
+	ttl := time.Until(time.Unix(claims.ExpiredAt, 0))
+	// 至少保留1秒，避免设置redis时ttl为0
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return ttl
+}
+
+// CreateAuthTokens 为session生成访问令牌与刷新令牌
+func CreateAuthTokens(sid, account string) (pair *AuthTokenPair, err error) {
+	accessToken, err := newAuthToken(sid, account, AuthTokenAccess, authTokenConfig.AccessTTL)
+	if err != nil {
+		return
+	}
+	refreshToken, err := newAuthToken(sid, account, AuthTokenRefresh, authTokenConfig.RefreshTTL)
+	if err != nil {
+		return
+	}
+	pair = &AuthTokenPair{
+		AccessToken:  accessToken,
+		ExpiresIn:    int(authTokenConfig.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+	}
+	return
+}
+
+// VerifyAuthToken 校验令牌，已吊销的令牌视为无效
+func VerifyAuthToken(ctx context.Context, token, category string) (claims *AuthTokenClaims, err error) {
+	claims, err = decodeAuthToken(token, category)
+	if err != nil {
+		return
+	}
+	data, err := redisSrv.GetIgnoreNilErr(ctx, getAuthTokenRevokedKey(claims))
+	if err != nil {
+		return
+	}
+	if len(data) != 0 {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	return
+}
+
+// RevokeAuthToken 吊销令牌，吊销记录保存至令牌过期
+func RevokeAuthToken(ctx context.Context, claims *AuthTokenClaims) error {
+	return redisSrv.Set(ctx, getAuthTokenRevokedKey(claims), util.NowString(), getAuthTokenTTL(claims))
+}
+
+// ConsumeRefreshToken 使用刷新令牌，刷新令牌仅可使用一次，
+// 并发使用同一刷新令牌时仅有一个成功
+func ConsumeRefreshToken(ctx context.Context, token string) (claims *AuthTokenClaims, err error) {
+	claims, err = decodeAuthToken(token, AuthTokenRefresh)
+	if err != nil {
+		return
+	}
+	success, err := redisSrv.Lock(ctx, getAuthTokenRevokedKey(claims), getAuthTokenTTL(claims))
+	if err != nil {
+		return
+	}
+	if !success {
+		err = ErrAuthTokenInvalid
+		return
+	}
+	return
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthToken(t *testing.T) {
+	assert := assert.New(t)
+
+	pair, err := CreateAuthTokens("sid", "tree")
+	assert.Nil(err)
+	assert.Equal("Bearer", pair.TokenType)
+
+	claims, err := decodeAuthToken(pair.AccessToken, AuthTokenAccess)
+	assert.Nil(err)
+	assert.Equal("sid", claims.SID)
+	assert.Equal("tree", claims.Account)
+
+	// 类型不匹配
+	_, err = decodeAuthToken(pair.RefreshToken, AuthTokenAccess)
+	assert.Equal(ErrAuthTokenInvalid, err)
+	_, err = decodeAuthToken(pair.RefreshToken, AuthTokenRefresh)
+	assert.Nil(err)
+
+	// 签名不匹配
+	_, err = decodeAuthToken(pair.AccessToken+"a", AuthTokenAccess)
+	assert.Equal(ErrAuthTokenInvalid, err)
+
+	// 已过期
+	token, err := newAuthToken("sid", "tree", AuthTokenAccess, -time.Second)
+	assert.Nil(err)
+	_, err = decodeAuthToken(token, AuthTokenAccess)
+	assert.Equal(ErrAuthTokenInvalid, err)
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 账户注销，申请注销后有一定的宽限期，超过宽限期则清除个人信息，
+// 账户本身保留（禁用状态）以避免被重新注册后关联到旧数据
+
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/ent"
+	"github.com/vicanso/elite/ent/apikey"
+	"github.com/vicanso/elite/ent/auditlog"
+	"github.com/vicanso/elite/ent/novelreport"
+	"github.com/vicanso/elite/ent/novelreview"
+	"github.com/vicanso/elite/ent/novelreviewvote"
+	"github.com/vicanso/elite/ent/paragraphannotation"
+	"github.com/vicanso/elite/ent/paragraphcomment"
+	"github.com/vicanso/elite/ent/paragraphcommentaction"
+	"github.com/vicanso/elite/ent/user"
+	"github.com/vicanso/elite/ent/useridentity"
+	"github.com/vicanso/elite/ent/userlogin"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/log"
+	"github.com/vicanso/elite/schema"
+	"github.com/vicanso/elite/util"
+)
+
+// UserAvatarBucket 用户头像保存的bucket
+const UserAvatarBucket = "elite-avatars"
+
+// anonymousAccountPrefix 注销账户的书评与段评替换的匿名账户前缀
+const anonymousAccountPrefix = "deleted_"
+
+// anonymizeUser 在事务中清除个人信息、删除关联记录并匿名该账户的相关记录，
+// 仅在账户仍为申请注销状态时执行（宽限期内登录会取消注销），返回是否已注销
+func anonymizeUser(ctx context.Context, tx *ent.Tx, u *ent.User, password string) (anonymized bool, err error) {
+	account := u.Account
+	// 先以批量更新锁定记录并确认仍为申请注销状态（仅更新updated_at，不记录审计日志）
+	count, err := tx.User.Update().
+		Where(
+			user.ID(u.ID),
+			user.DeletionRequestedAtNotNil(),
+			user.DeletedAtIsNil(),
+		).
+		Save(ctx)
+	if err != nil || count == 0 {
+		return
+	}
+	_, err = tx.User.UpdateOneID(u.ID).
+		SetPassword(password).
+		ClearPasswordVerifier().
+		SetStatus(schema.StatusDisabled).
+		SetDeletedAt(time.Now()).
+		ClearName().
+		ClearEmail().
+		ClearEmailVerifiedAt().
+		ClearTotpSecret().
+		ClearTotpEnabledAt().
+		ClearTotpRecoveryCodes().
+		ClearRoles().
+		ClearGroups().
+		ClearAvatar().
+		ClearBio().
+		ClearPrivacy().
+		ClearDeletionRequestedAt().
+		Save(ctx)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.UserLogin.Delete().
+		Where(userlogin.Account(account)).
+		Exec(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.APIKey.Delete().
+		Where(apikey.Account(account)).
+		Exec(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.UserIdentity.Delete().
+		Where(useridentity.Account(account)).
+		Exec(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.ParagraphAnnotation.Delete().
+		Where(paragraphannotation.Account(account)).
+		Exec(ctx)
+	if err != nil {
+		return
+	}
+
+	anonymousAccount := anonymousAccountPrefix + util.GenXID()
+	_, err = tx.NovelReview.Update().
+		Where(novelreview.Account(account)).
+		SetAccount(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.ParagraphComment.Update().
+		Where(paragraphcomment.Account(account)).
+		SetAccount(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.NovelReviewVote.Update().
+		Where(novelreviewvote.Account(account)).
+		SetAccount(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.ParagraphCommentAction.Update().
+		Where(paragraphcommentaction.Account(account)).
+		SetAccount(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.NovelReport.Update().
+		Where(novelreport.Reporter(account)).
+		ClearReporter().
+		ClearTrackID().
+		ClearIP().
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	// 审计日志保留操作记录，仅匿名操作者
+	_, err = tx.AuditLog.Update().
+		Where(auditlog.Actor(account)).
+		SetActor(anonymousAccount).
+		ClearIP().
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	_, err = tx.AuditLog.Update().
+		Where(auditlog.Impersonator(account)).
+		SetImpersonator(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return
+	}
+	anonymized = true
+	return
+}
+
+// AnonymizeUser 注销账户，清除个人信息，删除登录记录、API key、第三方账户关联与段落笔记，
+// 书评、段评、投票及审计日志等保留记录但替换为匿名账户，举报清除举报者信息，并清除账户的所有session。
+// 数据库的修改在同一事务中完成，失败时账户仍未标记为已注销，下次可重新执行，
+// 若账户已取消注销则不做处理
+func AnonymizeUser(ctx context.Context, u *ent.User) (err error) {
+	account := u.Account
+	buf, err := util.RandomBytes(32)
+	if err != nil {
+		return
+	}
+	// 设置为随机密码，无法再登录
+	password, err := util.HashPassword(hex.EncodeToString(buf))
+	if err != nil {
+		return
+	}
+	tx, err := helper.EntGetClient().Tx(ctx)
+	if err != nil {
+		return
+	}
+	anonymized, err := anonymizeUser(ctx, tx, u, password)
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if !anonymized {
+		return tx.Rollback()
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	// 头像在事务提交后才删除，删除失败不影响注销
+	if u.Avatar != "" {
+		e := NewFileSrv().Remove(ctx, UserAvatarBucket, u.Avatar)
+		if e != nil {
+			log.Default().Error().
+				Err(e).
+				Str("account", account).
+				Msg("remove avatar fail")
+		}
+	}
+	// 确认已注销后才清除session，避免清除已取消注销的账户的session
+	return DestroyUserSessions(ctx, account)
+}
+
+// AnonymizeExpiredDeletionUsers 注销已超过宽限期的账户，单个账户失败不影响其它账户
+func AnonymizeExpiredDeletionUsers() (err error) {
+	ctx := context.Background()
+	gracePeriod := config.GetAccountConfig().DeletionGracePeriod
+	users, err := helper.EntGetClient().User.Query().
+		Where(
+			user.DeletionRequestedAtLT(time.Now().Add(-gracePeriod)),
+			user.DeletedAtIsNil(),
+		).
+		All(ctx)
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		e := AnonymizeUser(ctx, u)
+		if e != nil {
+			log.Default().Error().
+				Err(e).
+				Str("account", u.Account).
+				Msg("anonymize user fail")
+		}
+	}
+	return
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/elite/cache"
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	userSessionRevokedKeyPrefix = "userSessionRevokedAt:"
+	// 账户的session索引（sorted set），score为最近活跃时间
+	userSessionIndexKeyPrefix = "userSessions:"
+
+	errUserSessionCategory = "userSession"
+)
+
+// UserSessionActive 账户的session及其最近活跃时间
+type UserSessionActive struct {
+	// session id，不可返回至客户端
+	SID string
+	// 用于客户端展示与操作的标识
+	ID       string
+	ActiveAt time.Time
+}
+
+var sessionConfig = config.GetSessionConfig()
+
+// RevokeUserSessions 使账户在此之前登录的所有session失效，
+// 记录的有效期与session一致，过期后旧的session也已失效
+func RevokeUserSessions(ctx context.Context, account string) error {
+	return redisSrv.Set(ctx, userSessionRevokedKeyPrefix+account, util.NowString(), sessionConfig.TTL)
+}
+
+// IsUserSessionRevoked 判断登录时间为loginAt的session是否已失效，
+// 时间精度为秒，因此同一秒内登录的session也视为失效
+func IsUserSessionRevoked(ctx context.Context, account, loginAt string) (revoked bool, err error) {
+	data, err := redisSrv.GetIgnoreNilErr(ctx, userSessionRevokedKeyPrefix+account)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	revokedAt, err := util.ParseTime(string(data))
+	if err != nil {
+		return
+	}
+	loginTime, err := util.ParseTime(loginAt)
+	if err != nil {
+		// 无法获取登录时间的session视为失效
+		revoked = true
+		err = nil
+		return
+	}
+	revoked = !loginTime.After(revokedAt)
+	return
+}
+
+// getUserSessionIndexKey 获取账户session索引的key
+func getUserSessionIndexKey(account string) string {
+	return userSessionIndexKeyPrefix + account
+}
+
+// GetUserSessionHandle 获取session对应的标识，session id为凭证，因此仅返回其hash
+func GetUserSessionHandle(sid string) string {
+	hash := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(hash[:8])
+}
+
+// UpdateUserSessionActive 将session添加至账户的索引并更新最近活跃时间
+func UpdateUserSessionActive(ctx context.Context, account, sid string) error {
+	if sid == "" {
+		return nil
+	}
+	key := getUserSessionIndexKey(account)
+	pipe := helper.RedisGetClient().TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: sid,
+	})
+	pipe.Expire(ctx, key, sessionConfig.TTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RemoveUserSession 从账户的索引中删除session
+func RemoveUserSession(ctx context.Context, account, sid string) error {
+	if sid == "" {
+		return nil
+	}
+	return helper.RedisGetClient().ZRem(ctx, getUserSessionIndexKey(account), sid).Err()
+}
+
+// ListUserSessions 获取账户的有效session，按最近活跃时间倒序，
+// 已过期或已删除的session则从索引中清除
+func ListUserSessions(ctx context.Context, account string) (sessions []*UserSessionActive, err error) {
+	key := getUserSessionIndexKey(account)
+	client := helper.RedisGetClient()
+	// 超过session有效期未活跃的已过期
+	expiredAt := time.Now().Add(-sessionConfig.TTL).Unix()
+	err = client.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(expiredAt, 10)).Err()
+	if err != nil {
+		return
+	}
+	result, err := client.ZRevRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	store := cache.GetRedisSession()
+	sessions = make([]*UserSessionActive, 0, len(result))
+	for _, item := range result {
+		sid, _ := item.Member.(string)
+		data, e := store.Get(sid)
+		if e != nil {
+			err = e
+			return
+		}
+		if len(data) == 0 {
+			_ = client.ZRem(ctx, key, sid).Err()
+			continue
+		}
+		sessions = append(sessions, &UserSessionActive{
+			SID:      sid,
+			ID:       GetUserSessionHandle(sid),
+			ActiveAt: time.Unix(int64(item.Score), 0),
+		})
+	}
+	return
+}
+
+// DestroyUserSession 根据标识删除账户的session
+func DestroyUserSession(ctx context.Context, account, id string) (err error) {
+	sessions, err := ListUserSessions(ctx, account)
+	if err != nil {
+		return
+	}
+	for _, item := range sessions {
+		if item.ID != id {
+			continue
+		}
+		err = cache.GetRedisSession().Destroy(item.SID)
+		if err != nil {
+			return
+		}
+		return RemoveUserSession(ctx, account, item.SID)
+	}
+	return hes.NewWithStatusCode("该session不存在或已过期", http.StatusNotFound, errUserSessionCategory)
+}
+
+// DestroyUserSessions 删除账户所有的session（退出所有设备的登录），
+// 索引之外的session（如索引建立之前登录的）则通过失效时间处理
+func DestroyUserSessions(ctx context.Context, account string) (err error) {
+	sessions, err := ListUserSessions(ctx, account)
+	if err != nil {
+		return
+	}
+	store := cache.GetRedisSession()
+	for _, item := range sessions {
+		err = store.Destroy(item.SID)
+		if err != nil {
+			return
+		}
+	}
+	err = helper.RedisGetClient().Del(ctx, getUserSessionIndexKey(account)).Err()
+	if err != nil {
+		return
+	}
+	return RevokeUserSessions(ctx, account)
+}
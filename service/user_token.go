@@ -0,0 +1,93 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户相关的一次性令牌（如重置密码），redis中仅保存令牌的hash，
+// 使用时获取并删除，保证只可使用一次
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	userTokenKeyPrefix = "userToken:"
+
+	errUserTokenCategory = "userToken"
+)
+
+// 令牌类型
+const (
+	// UserTokenPasswordReset 重置密码
+	UserTokenPasswordReset = "passwordReset"
+	// UserTokenEmailVerify 验证邮箱
+	UserTokenEmailVerify = "emailVerify"
+	// UserTokenOIDCState OpenID Connect登录的state
+	UserTokenOIDCState = "oidcState"
+	// UserTokenLoginConfirm 确认风险较高的登录
+	UserTokenLoginConfirm = "loginConfirm"
+)
+
+// 令牌的随机字节长度
+const userTokenSize = 32
+
+var errUserTokenInvalid = &hes.Error{
+	Message:    "令牌无效或已过期",
+	StatusCode: 400,
+	Category:   errUserTokenCategory,
+}
+
+// getUserTokenKey 获取令牌对应的key，仅使用令牌的hash
+func getUserTokenKey(category, token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return userTokenKeyPrefix + category + ":" + hex.EncodeToString(hash[:])
+}
+
+// CreateUserToken 创建用户令牌，value为令牌对应的数据（如账户），在有效期内仅可使用一次
+func CreateUserToken(ctx context.Context, category, value string, ttl time.Duration) (token string, err error) {
+	buf, err := util.RandomBytes(userTokenSize)
+	if err != nil {
+		return
+	}
+	token = hex.EncodeToString(buf)
+	err = redisSrv.Set(ctx, getUserTokenKey(category, token), value, ttl)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// ConsumeUserToken 使用令牌，返回令牌对应的数据，令牌使用后则失效
+func ConsumeUserToken(ctx context.Context, category, token string) (value string, err error) {
+	data, err := redisSrv.GetAndDel(ctx, getUserTokenKey(category, token))
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = errUserTokenInvalid
+		}
+		return
+	}
+	value = string(data)
+	if value == "" {
+		err = errUserTokenInvalid
+		return
+	}
+	return
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户两步验证（TOTP）相关处理，启用前的密钥临时保存于redis，
+// 确认验证码正确后再加密保存至用户信息，恢复码仅保存其HMAC
+
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/vicanso/elite/config"
+	"github.com/vicanso/elite/helper"
+	"github.com/vicanso/elite/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	totpEnrollKeyPrefix = "totpEnroll:"
+	totpUsedKeyPrefix   = "totpUsed:"
+
+	errTOTPCategory = "totp"
+
+	// 启用两步验证的有效期
+	totpEnrollTTL = 10 * time.Minute
+	// 恢复码的数量与字节数
+	totpRecoveryCodeCount = 10
+	totpRecoveryCodeSize  = 10
+	// 二维码图片大小
+	totpQRCodeSize = 256
+)
+
+var accountConfig = config.GetAccountConfig()
+
+// totpSecretKey 加密两步验证密钥的key（aes需要32字节）
+var totpSecretKey = sha256.Sum256([]byte(accountConfig.TOTPKey))
+
+// TOTPEnrollment 启用两步验证的信息
+type TOTPEnrollment struct {
+	// 密钥，用于无法扫描二维码时手动输入
+	Secret string `json:"secret"`
+	// otpauth链接
+	URI string `json:"uri"`
+	// 二维码（png）
+	QRCode []byte `json:"qrCode"`
+	// 过期时间
+	ExpiredAt time.Time `json:"expiredAt"`
+}
+
+// CreateTOTPEnrollment 生成两步验证的密钥与二维码，需要在有效期内确认
+func CreateTOTPEnrollment(ctx context.Context, account string) (enrollment *TOTPEnrollment, err error) {
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return
+	}
+	uri := util.TOTPURI(accountConfig.TOTPIssuer, account, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return
+	}
+	err = redisSrv.Set(ctx, totpEnrollKeyPrefix+account, secret, totpEnrollTTL)
+	if err != nil {
+		return
+	}
+	enrollment = &TOTPEnrollment{
+		Secret:    secret,
+		URI:       uri,
+		QRCode:    png,
+		ExpiredAt: time.Now().Add(totpEnrollTTL),
+	}
+	return
+}
+
+// GetTOTPEnrollment 获取待确认的两步验证密钥
+func GetTOTPEnrollment(ctx context.Context, account string) (secret string, err error) {
+	data, err := redisSrv.Get(ctx, totpEnrollKeyPrefix+account)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = hes.New("两步验证的密钥已过期，请重新获取", errTOTPCategory)
+		}
+		return
+	}
+	secret = string(data)
+	return
+}
+
+// ClearTOTPEnrollment 清除待确认的两步验证密钥
+func ClearTOTPEnrollment(ctx context.Context, account string) error {
+	_, err := redisSrv.Del(ctx, totpEnrollKeyPrefix+account)
+	return err
+}
+
+// ValidateUserTOTP 校验用户的两步验证码，每个验证码仅可使用一次
+func ValidateUserTOTP(ctx context.Context, account, secret, code string) (valid bool, err error) {
+	step, valid := util.ValidateTOTP(secret, code, time.Now())
+	if !valid {
+		return
+	}
+	// 记录已使用的验证码，有效期覆盖允许偏差的周期
+	key := fmt.Sprintf("%s%s:%d", totpUsedKeyPrefix, account, step)
+	return redisSrv.Lock(ctx, key, 3*util.TOTPPeriod)
+}
+
+// EncryptTOTPSecret 加密两步验证的密钥，用于保存至用户信息
+func EncryptTOTPSecret(secret string) (string, error) {
+	data, err := util.Encrypt(totpSecretKey[:], []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptTOTPSecret 解密用户信息中保存的两步验证密钥
+func DecryptTOTPSecret(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	secret, err := util.Decrypt(totpSecretKey[:], data)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// hashRecoveryCode 计算恢复码的HMAC，避免数据库泄露后恢复码可被穷举
+func hashRecoveryCode(code string) string {
+	h := hmac.New(sha256.New, []byte(accountConfig.TOTPKey))
+	_, _ = h.Write([]byte(strings.ToLower(code)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GenerateRecoveryCodes 生成两步验证的恢复码，返回恢复码与其hash
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes = make([]string, totpRecoveryCodeCount)
+	hashes = make([]string, totpRecoveryCodeCount)
+	for i := 0; i < totpRecoveryCodeCount; i++ {
+		buf, e := util.RandomBytes(totpRecoveryCodeSize)
+		if e != nil {
+			err = e
+			return
+		}
+		codes[i] = hex.EncodeToString(buf)
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return
+}
+
+// MatchRecoveryCode 判断恢复码是否匹配，返回匹配的位置，不匹配则返回-1
+func MatchRecoveryCode(hashes []string, code string) int {
+	hash := hashRecoveryCode(code)
+	for index, item := range hashes {
+		if hmac.Equal([]byte(item), []byte(hash)) {
+			return index
+		}
+	}
+	return -1
+}
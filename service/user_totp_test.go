@@ -0,0 +1,49 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	value, err := EncryptTOTPSecret("JBSWY3DPEHPK3PXP")
+	assert.Nil(err)
+	assert.NotContains(value, "JBSWY3DPEHPK3PXP")
+
+	secret, err := DecryptTOTPSecret(value)
+	assert.Nil(err)
+	assert.Equal("JBSWY3DPEHPK3PXP", secret)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	assert.Nil(err)
+	assert.Equal(totpRecoveryCodeCount, len(codes))
+	assert.Equal(2*totpRecoveryCodeSize, len(codes[0]))
+	assert.NotEqual(codes[0], hashes[0])
+
+	assert.Equal(1, MatchRecoveryCode(hashes, codes[1]))
+	// 不区分大小写
+	assert.Equal(2, MatchRecoveryCode(hashes, strings.ToUpper(codes[2])))
+	assert.Equal(-1, MatchRecoveryCode(hashes, "0123456789"))
+}
@@ -39,3 +39,34 @@ func New() elton.Handler {
 		HttpOnly: true,
 	})
 }
+
+// Load 加载指定id的session并保存至context中，用于非cookie的认证方式（如访问令牌），
+// 返回的函数用于请求处理完成后提交session
+func Load(c *elton.Context, id string) (commit func() error, err error) {
+	s := &se.Session{
+		Store: cache.GetRedisSession(),
+		ID:    id,
+	}
+	_, err = s.Fetch()
+	if err != nil {
+		return
+	}
+	c.Set(se.Key, s)
+	ttl := config.GetSessionConfig().TTL
+	commit = func() error {
+		// 已删除的session无需提交
+		if s.ID == "" {
+			return nil
+		}
+		return s.Commit(ttl)
+	}
+	return
+}
+
+// NewTemporary 创建不保存的临时session并保存至context中，用于API key等无状态的认证方式
+func NewTemporary(c *elton.Context) {
+	s := &se.Session{}
+	// 无session id，不会从store中获取数据
+	_, _ = s.Fetch()
+	c.Set(se.Key, s)
+}
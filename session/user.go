@@ -16,6 +16,7 @@ package session
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/vicanso/elite/cs"
 	"github.com/vicanso/elite/util"
@@ -41,10 +42,41 @@ type (
 		Roles []string `json:"roles"`
 		// 用户分组列表
 		Groups []string `json:"groups"`
+		// 用户权限列表（包括分组授予的角色的权限）
+		Permissions []string `json:"permissions,omitempty"`
+		// 权限配置的版本，不一致时需重新获取权限
+		PermissionVersion string `json:"permissionVersion,omitempty"`
 		// Session信息更新时间
 		UpdatedAt string `json:"updatedAt"`
 		// Session信息创建时间
 		LoginAt string `json:"loginAt"`
+		// 已校验密码但未完成两步验证的账户
+		TwoFactorPending string `json:"twoFactorPending,omitempty"`
+		// 是否已完成两步验证
+		TwoFactorVerified bool `json:"twoFactorVerified,omitempty"`
+		// 风险较高的登录，已发送确认邮件但未确认的账户
+		LoginConfirmPending string `json:"loginConfirmPending,omitempty"`
+		// OpenID Connect登录的state，用于校验回调请求
+		OIDCState string `json:"oidcState,omitempty"`
+		// 是否要求修改密码，修改密码前仅可访问少数接口
+		PasswordResetRequired bool `json:"passwordResetRequired,omitempty"`
+		// 模拟登录时为管理员的信息，用于展示模拟登录状态及结束后恢复
+		Impersonator *Impersonator `json:"impersonator,omitempty"`
+	}
+	// Impersonator 模拟登录的管理员信息
+	Impersonator struct {
+		// 管理员账号
+		Account string `json:"account"`
+		// 管理员ID
+		ID int `json:"id"`
+		// 管理员是否已完成两步验证
+		TwoFactorVerified bool `json:"twoFactorVerified,omitempty"`
+		// 管理员的登录时间
+		LoginAt string `json:"loginAt"`
+		// 模拟登录的开始时间
+		StartedAt string `json:"startedAt"`
+		// 模拟登录的结束时间
+		ExpiredAt string `json:"expiredAt"`
 	}
 	// UserSession 用户session
 	UserSession struct {
@@ -113,6 +145,25 @@ func (us *UserSession) SetInfo(info UserInfo) (err error) {
 	return
 }
 
+// IsImpersonating 判断是否模拟登录中
+func (info UserInfo) IsImpersonating() bool {
+	return info.Impersonator != nil
+}
+
+// IsExpired 判断模拟登录是否已结束，无法获取结束时间的视为已结束
+func (impersonator *Impersonator) IsExpired() bool {
+	expiredAt, err := util.ParseTime(impersonator.ExpiredAt)
+	if err != nil {
+		return true
+	}
+	return !time.Now().Before(expiredAt)
+}
+
+// ID 获取session id，新的session在请求处理完成后才生成id，此时返回空字符串
+func (us *UserSession) ID() string {
+	return us.se.ID
+}
+
 // Destroy 清除用户session
 func (us *UserSession) Destroy() error {
 	return us.se.Destroy()
@@ -16,8 +16,10 @@ package session
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/util"
 	"github.com/vicanso/elton"
 	se "github.com/vicanso/elton-session"
 )
@@ -66,6 +68,29 @@ func TestUserSession(t *testing.T) {
 	})
 }
 
+func TestImpersonator(t *testing.T) {
+	assert := assert.New(t)
+
+	info := UserInfo{
+		Account: "treexie",
+	}
+	assert.False(info.IsImpersonating())
+
+	info.Impersonator = &Impersonator{
+		Account:   "admin",
+		ExpiredAt: util.FormatTime(time.Now().Add(time.Minute)),
+	}
+	assert.True(info.IsImpersonating())
+	assert.False(info.Impersonator.IsExpired())
+
+	info.Impersonator.ExpiredAt = util.FormatTime(time.Now().Add(-time.Second))
+	assert.True(info.Impersonator.IsExpired())
+
+	// 无法获取结束时间
+	info.Impersonator.ExpiredAt = ""
+	assert.True(info.Impersonator.IsExpired())
+}
+
 func TestNewUserSession(t *testing.T) {
 	assert := assert.New(t)
 	c := elton.NewContext(nil, nil)
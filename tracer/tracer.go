@@ -30,6 +30,9 @@ type TracerInfo struct {
 	DeviceID string
 	Account  string
 	TraceID  string
+	IP       string
+	// 模拟登录的管理员账号
+	Impersonator string
 }
 
 var tracerInfoCache = mustNewTracerCache()
@@ -86,6 +89,7 @@ func New() elton.Handler {
 		SetTracerInfo(TracerInfo{
 			TraceID:  c.ID,
 			DeviceID: deviceID,
+			IP:       c.RealIP(),
 		})
 		return c.Next()
 	}
@@ -24,6 +24,7 @@ import (
 var sessionConfig = config.GetSessionConfig()
 var uuidReg = regexp.MustCompile(`uuid/(\S+)`)
 var versionReg = regexp.MustCompile(`elite/(\S+)`)
+var platformReg = regexp.MustCompile(`platform/(\S+)`)
 
 // GetDeviceID 获取设备ID
 func GetDeviceID(c *elton.Context) string {
@@ -48,6 +49,16 @@ func GetAppVersion(c *elton.Context) string {
 	return version
 }
 
+// GetPlatform 获取客户端平台，如ios、android
+func GetPlatform(c *elton.Context) string {
+	platform := ""
+	arr := platformReg.FindStringSubmatch(c.Request.UserAgent())
+	if len(arr) == 2 {
+		platform = arr[1]
+	}
+	return platform
+}
+
 // GetTrackID 获取track id
 func GetTrackID(c *elton.Context) string {
 	trackCookie := sessionConfig.TrackKey
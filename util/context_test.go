@@ -48,3 +48,11 @@ func TestGetSessionID(t *testing.T) {
 	c := elton.NewContext(nil, req)
 	assert.Equal(cookie.Value, GetSessionID(c))
 }
+
+func TestGetPlatform(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "elite/1.0.0 platform/ios uuid/abcd")
+	c := elton.NewContext(nil, req)
+	assert.Equal("ios", GetPlatform(c))
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DiffEqual 相同的行
+	DiffEqual = "="
+	// DiffInsert 新增的行
+	DiffInsert = "+"
+	// DiffDelete 删除的行
+	DiffDelete = "-"
+)
+
+// DiffLine 按行对比的结果
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines 按行对比两段文本（基于最长公共子序列）
+func DiffLines(a, b string) []DiffLine {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	// 先去除相同的前缀与后缀，减少计算量
+	prefix := 0
+	for prefix < len(aLines) && prefix < len(bLines) && aLines[prefix] == bLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(aLines)-prefix &&
+		suffix < len(bLines)-prefix &&
+		aLines[len(aLines)-1-suffix] == bLines[len(bLines)-1-suffix] {
+		suffix++
+	}
+
+	result := make([]DiffLine, 0, len(aLines)+len(bLines))
+	for _, line := range aLines[:prefix] {
+		result = append(result, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	x := aLines[prefix : len(aLines)-suffix]
+	y := bLines[prefix : len(bLines)-suffix]
+	// lcs[i][j] 表示x[i:]与y[j:]的最长公共子序列长度
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			result = append(result, DiffLine{Op: DiffEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, DiffLine{Op: DiffDelete, Text: x[i]})
+			i++
+		default:
+			result = append(result, DiffLine{Op: DiffInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		result = append(result, DiffLine{Op: DiffDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		result = append(result, DiffLine{Op: DiffInsert, Text: y[j]})
+	}
+
+	for _, line := range aLines[len(aLines)-suffix:] {
+		result = append(result, DiffLine{Op: DiffEqual, Text: line})
+	}
+	return result
+}
+
+// DiffSize 计算变更的字符数（新增与删除的字符总数）
+func DiffSize(lines []DiffLine) int {
+	size := 0
+	for _, line := range lines {
+		if line.Op != DiffEqual {
+			size += utf8.RuneCountInString(line.Text)
+		}
+	}
+	return size
+}
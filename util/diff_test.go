@@ -0,0 +1,41 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := DiffLines("a\nb\nc\nd", "a\nc\n测试\nd")
+	assert.Equal([]DiffLine{
+		{Op: DiffEqual, Text: "a"},
+		{Op: DiffDelete, Text: "b"},
+		{Op: DiffEqual, Text: "c"},
+		{Op: DiffInsert, Text: "测试"},
+		{Op: DiffEqual, Text: "d"},
+	}, lines)
+	assert.Equal(3, DiffSize(lines))
+
+	lines = DiffLines("a", "a")
+	assert.Equal([]DiffLine{
+		{Op: DiffEqual, Text: "a"},
+	}, lines)
+	assert.Equal(0, DiffSize(lines))
+}
@@ -0,0 +1,175 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vicanso/elite/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordAlgorithmArgon2id argon2id
+	PasswordAlgorithmArgon2id = "argon2id"
+	// PasswordAlgorithmBcrypt bcrypt
+	PasswordAlgorithmBcrypt = "bcrypt"
+
+	argon2idPrefix = "$argon2id$"
+	argon2SaltLen  = 16
+	argon2KeyLen   = 32
+)
+
+var passwordConfig = config.GetPasswordConfig()
+
+var errPasswordHashInvalid = errors.New("password hash is invalid")
+
+// argon2Params argon2id的参数
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// HashPassword 根据配置的算法对密码hash，argon2id使用PHC字符串格式保存
+func HashPassword(password string) (string, error) {
+	return hashPassword(passwordConfig, password)
+}
+
+func hashPassword(conf config.PasswordConfig, password string) (string, error) {
+	if conf.Algorithm == PasswordAlgorithmBcrypt {
+		buf, err := bcrypt.GenerateFromPassword([]byte(password), conf.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	salt, err := RandomBytes(argon2SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, conf.Argon2Time, conf.Argon2Memory, conf.Argon2Threads, argon2KeyLen)
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		conf.Argon2Memory,
+		conf.Argon2Time,
+		conf.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// isBcryptHash 判断是否bcrypt的hash
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+// IsPasswordHashed 判断是否已使用argon2id或bcrypt hash，
+// 旧版本直接保存客户端提交的密码，登录成功时需要升级
+func IsPasswordHashed(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix) || isBcryptHash(hash)
+}
+
+// parseArgon2Hash 解析argon2id的hash，返回参数、salt与key
+func parseArgon2Hash(hash string) (params argon2Params, salt, key []byte, err error) {
+	// $argon2id$v=19$m=65536,t=3,p=2$salt$key
+	arr := strings.Split(hash, "$")
+	if len(arr) != 6 {
+		err = errPasswordHashInvalid
+		return
+	}
+	var version int
+	_, err = fmt.Sscanf(arr[2], "v=%d", &version)
+	if err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = errPasswordHashInvalid
+		return
+	}
+	_, err = fmt.Sscanf(arr[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(arr[4])
+	if err != nil {
+		return
+	}
+	key, err = base64.RawStdEncoding.DecodeString(arr[5])
+	if err != nil {
+		return
+	}
+	return
+}
+
+// VerifyPassword 校验密码与hash是否匹配
+func VerifyPassword(hash, password string) (bool, error) {
+	if isBcryptHash(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return false, errPasswordHashInvalid
+	}
+	params, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return false, err
+	}
+	result := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(result, key) == 1, nil
+}
+
+// PasswordNeedsRehash 判断hash是否与当前配置的算法或参数不一致，需要重新hash
+func PasswordNeedsRehash(hash string) bool {
+	return passwordNeedsRehash(passwordConfig, hash)
+}
+
+func passwordNeedsRehash(conf config.PasswordConfig, hash string) bool {
+	if !IsPasswordHashed(hash) {
+		return true
+	}
+	if conf.Algorithm == PasswordAlgorithmBcrypt {
+		if !isBcryptHash(hash) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != conf.BcryptCost
+	}
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+	params, _, _, err := parseArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params.time != conf.Argon2Time ||
+		params.memory != conf.Argon2Memory ||
+		params.threads != conf.Argon2Threads
+}
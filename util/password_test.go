@@ -0,0 +1,106 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elite/config"
+)
+
+func TestPassword(t *testing.T) {
+	assert := assert.New(t)
+	// 使用较低的参数加快测试
+	conf := config.PasswordConfig{
+		Algorithm:     PasswordAlgorithmArgon2id,
+		Argon2Time:    1,
+		Argon2Memory:  1024,
+		Argon2Threads: 1,
+		BcryptCost:    4,
+	}
+	password := "fEqNCco3Yq9h5ZUglD3CZJT4lBsfEqNCco31Yq9h5ZUB"
+
+	hash, err := hashPassword(conf, password)
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(IsPasswordHashed(hash))
+	ok, err := VerifyPassword(hash, password)
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = VerifyPassword(hash, password+"a")
+	assert.Nil(err)
+	assert.False(ok)
+	assert.False(passwordNeedsRehash(conf, hash))
+
+	// 调整参数后需要重新hash
+	conf.Argon2Time = 2
+	assert.True(passwordNeedsRehash(conf, hash))
+
+	conf.Algorithm = PasswordAlgorithmBcrypt
+	assert.True(passwordNeedsRehash(conf, hash))
+	hash, err = hashPassword(conf, password)
+	assert.Nil(err)
+	assert.True(IsPasswordHashed(hash))
+	ok, err = VerifyPassword(hash, password)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.False(passwordNeedsRehash(conf, hash))
+
+	// 旧版本未hash的密码
+	assert.False(IsPasswordHashed(password))
+	assert.True(passwordNeedsRehash(conf, password))
+	_, err = VerifyPassword(password, password)
+	assert.NotNil(err)
+}
+
+func TestPasswordVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	password := "fEqNCco3Yq9h5ZUglD3CZJT4lBsfEqNCco31Yq9h5ZUB"
+	salt := []byte("0123456789abcdef")
+	params := PasswordVerifierParams{
+		Time:    1,
+		Memory:  1024,
+		Threads: 1,
+	}
+	value := NewPasswordVerifierWithSalt(password, salt, params).String()
+	assert.True(strings.HasPrefix(value, "$scram-argon2id$v=19$m=1024,t=1,p=1$"))
+
+	v, err := ParsePasswordVerifier(value)
+	assert.Nil(err)
+	assert.Equal(salt, v.Salt)
+	assert.Equal(params, v.PasswordVerifierParams)
+	assert.Equal(value, v.String())
+
+	authMessage := "treexie,abcd"
+	proof := NewPasswordProof(password, v.Salt, v.PasswordVerifierParams, authMessage)
+	assert.True(v.Verify(authMessage, proof))
+	// 挑战信息不一致（如重放）
+	assert.False(v.Verify("treexie,abce", proof))
+	// 密码错误
+	assert.False(v.Verify(authMessage, NewPasswordProof(password+"a", v.Salt, v.PasswordVerifierParams, authMessage)))
+	// 保存的StoredKey不可直接作为proof
+	assert.False(v.Verify(authMessage, v.StoredKey))
+
+	_, err = ParsePasswordVerifier(password)
+	assert.NotNil(err)
+
+	// 固定的salt
+	assert.Equal(GetPasswordVerifierSalt("key", "treexie"), GetPasswordVerifierSalt("key", "treexie"))
+	assert.NotEqual(GetPasswordVerifierSalt("key", "treexie"), GetPasswordVerifierSalt("key", "vicanso"))
+	assert.Equal(16, len(GetPasswordVerifierSalt("key", "treexie")))
+}
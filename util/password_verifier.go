@@ -0,0 +1,178 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 登录挑战使用的校验数据，参考SCRAM（RFC 5802），SaltedPassword使用argon2id生成：
+// SaltedPassword = Argon2id(password, salt, time, memory, threads)
+// ClientKey = HMAC(SaltedPassword, "Client Key")
+// StoredKey = SHA256(ClientKey)
+// ClientProof = ClientKey XOR HMAC(StoredKey, AuthMessage)
+// 服务端仅保存StoredKey，客户端每次基于一次性的挑战计算proof，
+// 因此保存的数据与提交的proof均无法直接用于登录，
+// 且使用与密码hash相同的argon2id参数，不会成为更易破解的数据
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	passwordVerifierPrefix  = "$scram-argon2id$"
+	passwordVerifierSaltLen = 16
+	passwordVerifierKeyLen  = 32
+)
+
+// PasswordVerifierParams 生成校验数据的argon2id参数
+type PasswordVerifierParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// PasswordVerifier 登录挑战的校验数据
+type PasswordVerifier struct {
+	PasswordVerifierParams
+	Salt      []byte
+	StoredKey []byte
+}
+
+func hmacSha256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// getPasswordClientKey 根据密码、salt与argon2id参数生成ClientKey
+func getPasswordClientKey(password string, salt []byte, params PasswordVerifierParams) []byte {
+	saltedPassword := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, passwordVerifierKeyLen)
+	return hmacSha256(saltedPassword, []byte("Client Key"))
+}
+
+// NewPasswordVerifier 使用随机salt与配置的argon2id参数生成校验数据
+func NewPasswordVerifier(password string) (*PasswordVerifier, error) {
+	salt, err := RandomBytes(passwordVerifierSaltLen)
+	if err != nil {
+		return nil, err
+	}
+	return NewPasswordVerifierWithSalt(password, salt, GetPasswordVerifierParams()), nil
+}
+
+// NewPasswordVerifierWithSalt 使用指定的salt与argon2id参数生成校验数据
+func NewPasswordVerifierWithSalt(password string, salt []byte, params PasswordVerifierParams) *PasswordVerifier {
+	clientKey := getPasswordClientKey(password, salt, params)
+	storedKey := sha256.Sum256(clientKey)
+	return &PasswordVerifier{
+		PasswordVerifierParams: params,
+		Salt:                   salt,
+		StoredKey:              storedKey[:],
+	}
+}
+
+// GetPasswordVerifierParams 获取配置的argon2id参数（与密码hash一致）
+func GetPasswordVerifierParams() PasswordVerifierParams {
+	return PasswordVerifierParams{
+		Time:    passwordConfig.Argon2Time,
+		Memory:  passwordConfig.Argon2Memory,
+		Threads: passwordConfig.Argon2Threads,
+	}
+}
+
+// GetPasswordVerifierSalt 根据密钥与账户生成固定的salt，
+// 用于账户不存在或未生成校验数据时的挑战，避免账户被枚举
+func GetPasswordVerifierSalt(key, account string) []byte {
+	return hmacSha256([]byte(key), []byte(account))[:passwordVerifierSaltLen]
+}
+
+// String 转换为字符串保存，$scram-argon2id$v=19$m=65536,t=3,p=2$salt$storedKey
+func (v *PasswordVerifier) String() string {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		passwordVerifierPrefix,
+		argon2.Version,
+		v.Memory,
+		v.Time,
+		v.Threads,
+		base64.RawStdEncoding.EncodeToString(v.Salt),
+		base64.RawStdEncoding.EncodeToString(v.StoredKey),
+	)
+}
+
+// ParsePasswordVerifier 解析校验数据
+func ParsePasswordVerifier(value string) (v *PasswordVerifier, err error) {
+	if !strings.HasPrefix(value, passwordVerifierPrefix) {
+		err = errPasswordHashInvalid
+		return
+	}
+	arr := strings.Split(value, "$")
+	if len(arr) != 6 {
+		err = errPasswordHashInvalid
+		return
+	}
+	var version int
+	_, err = fmt.Sscanf(arr[2], "v=%d", &version)
+	if err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = errPasswordHashInvalid
+		return
+	}
+	v = &PasswordVerifier{}
+	_, err = fmt.Sscanf(arr[3], "m=%d,t=%d,p=%d", &v.Memory, &v.Time, &v.Threads)
+	if err != nil {
+		return
+	}
+	v.Salt, err = base64.RawStdEncoding.DecodeString(arr[4])
+	if err != nil {
+		return
+	}
+	v.StoredKey, err = base64.RawStdEncoding.DecodeString(arr[5])
+	if err != nil {
+		return
+	}
+	return
+}
+
+// Verify 校验客户端基于挑战信息生成的proof
+func (v *PasswordVerifier) Verify(authMessage string, proof []byte) bool {
+	if len(proof) != len(v.StoredKey) {
+		return false
+	}
+	clientSignature := hmacSha256(v.StoredKey, []byte(authMessage))
+	clientKey := make([]byte, len(proof))
+	for index := range proof {
+		clientKey[index] = proof[index] ^ clientSignature[index]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	return subtle.ConstantTimeCompare(storedKey[:], v.StoredKey) == 1
+}
+
+// NewPasswordProof 根据密码与挑战信息生成proof，与客户端的计算方式一致
+func NewPasswordProof(password string, salt []byte, params PasswordVerifierParams, authMessage string) []byte {
+	clientKey := getPasswordClientKey(password, salt, params)
+	storedKey := sha256.Sum256(clientKey)
+	clientSignature := hmacSha256(storedKey[:], []byte(authMessage))
+	proof := make([]byte, len(clientKey))
+	for index := range clientKey {
+		proof[index] = clientKey[index] ^ clientSignature[index]
+	}
+	return proof
+}
@@ -69,6 +69,16 @@ func RandomDigit(n int) string {
 	return randomString(digitBytes, n)
 }
 
+// RandomBytes 使用crypto/rand生成指定长度的随机数据
+func RandomBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(crand.Reader, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 // GenXID 生成xid
 func GenXID() string {
 	return strings.ToUpper(xid.New().String())
@@ -29,6 +29,13 @@ func TestRandomString(t *testing.T) {
 	assert.True(reg.MatchString(RandomDigit(10)))
 }
 
+func TestRandomBytes(t *testing.T) {
+	assert := assert.New(t)
+	buf, err := RandomBytes(16)
+	assert.Nil(err)
+	assert.Equal(16, len(buf))
+}
+
 func TestGenXID(t *testing.T) {
 	assert := assert.New(t)
 	assert.Equal(20, len(GenXID()))
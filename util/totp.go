@@ -0,0 +1,122 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// TOTP（RFC 6238）的生成与校验，使用HMAC-SHA1、6位数字、30秒周期，
+// 与常用的身份验证器App默认配置一致
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6
+	// TOTPPeriod TOTP的周期
+	TOTPPeriod = 30 * time.Second
+	// 允许前后一个周期的时间偏差
+	totpSkew       = 1
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成TOTP密钥（base32编码）
+func GenerateTOTPSecret() (string, error) {
+	buf, err := RandomBytes(totpSecretSize)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPStep 获取时间对应的周期数
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// hotp 根据周期数生成验证码
+func hotp(key []byte, counter int64, digits int) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(buf)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// decodeTOTPSecret 解码密钥，忽略空格与大小写
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// TOTPCode 生成指定时间的验证码
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, TOTPStep(t), totpDigits), nil
+}
+
+// ValidateTOTP 校验验证码，允许前后一个周期的偏差，返回匹配的周期数（用于防止重复使用）
+func ValidateTOTP(secret, code string, t time.Time) (step int64, valid bool) {
+	if len(code) != totpDigits {
+		return
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return
+	}
+	current := TOTPStep(t)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		s := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, s, totpDigits)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return
+}
+
+// TOTPURI 生成身份验证器使用的otpauth链接（用于生成二维码）
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", int(TOTPPeriod/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	// RFC 6238 测试数据（取后6位）
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, code := range tests {
+		result, err := TOTPCode(secret, time.Unix(unix, 0))
+		assert.Nil(err)
+		assert.Equal(code, result)
+	}
+
+	now := time.Unix(1111111109, 0)
+	step, valid := ValidateTOTP(secret, "081804", now)
+	assert.True(valid)
+	assert.Equal(TOTPStep(now), step)
+	// 允许一个周期的偏差
+	_, valid = ValidateTOTP(secret, "081804", now.Add(TOTPPeriod))
+	assert.True(valid)
+	_, valid = ValidateTOTP(secret, "081804", now.Add(3*TOTPPeriod))
+	assert.False(valid)
+	_, valid = ValidateTOTP(secret, "12345", now)
+	assert.False(valid)
+
+	secret, err := GenerateTOTPSecret()
+	assert.Nil(err)
+	assert.Equal(32, len(secret))
+	code, err := TOTPCode(secret, now)
+	assert.Nil(err)
+	_, valid = ValidateTOTP(secret, code, now)
+	assert.True(valid)
+
+	assert.Equal("otpauth://totp/elite:tree?algorithm=SHA1&digits=6&issuer=elite&period=30&secret=ABC", TOTPURI("elite", "tree", "ABC"))
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "github.com/blang/semver/v4"
+
+// ParseVersion 解析版本号，版本为空时视为0.0.0
+func ParseVersion(version string) (semver.Version, error) {
+	if version == "" {
+		version = "0.0.0"
+	}
+	return semver.Parse(version)
+}
+
+// MatchVersionRange 判断版本是否在版本范围内，如>=1.0.0 <2.0.0
+func MatchVersionRange(version semver.Version, versionRange string) (bool, error) {
+	expectedRange, err := semver.ParseRange(versionRange)
+	if err != nil {
+		return false, err
+	}
+	return expectedRange(version), nil
+}
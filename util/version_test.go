@@ -0,0 +1,45 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchVersionRange(t *testing.T) {
+	assert := assert.New(t)
+
+	ver, err := ParseVersion("")
+	assert.Nil(err)
+	assert.Equal("0.0.0", ver.String())
+
+	_, err = ParseVersion("1.0")
+	assert.NotNil(err)
+
+	ver, err = ParseVersion("1.2.0")
+	assert.Nil(err)
+	matched, err := MatchVersionRange(ver, ">=1.0.0 <2.0.0")
+	assert.Nil(err)
+	assert.True(matched)
+
+	matched, err = MatchVersionRange(ver, ">=1.3.0")
+	assert.Nil(err)
+	assert.False(matched)
+
+	_, err = MatchVersionRange(ver, "abc")
+	assert.NotNil(err)
+}
@@ -37,6 +37,9 @@ func init() {
 	AddAlias("xPath", "startswith=/")
 	// boolean的字符串形式
 	AddAlias("xBoolean", "oneof=true false")
+	// 审计日志记录的数据类型与ID
+	AddAlias("xAuditEntityType", "oneof=User Configuration Novel")
+	AddAlias("xAuditEntityID", "number")
 	// http(s)校验
 	Add("xHTTP", func(fl validator.FieldLevel) bool {
 		v, ok := toString(fl)
@@ -19,4 +19,7 @@ func init() {
 	AddAlias("xConfigurationName", "min=2,max=20")
 	AddAlias("xConfigurationCategory", "alphanum,min=2,max=20")
 	AddAlias("xConfigurationData", "min=0,max=500")
+	// 配置版本号与变更原因
+	AddAlias("xConfigurationVersion", "number")
+	AddAlias("xConfigurationVersionReason", "max=200")
 }
@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/vicanso/elite/schema"
 )
 
 func init() {
@@ -38,6 +39,47 @@ func init() {
 	}))
 	AddAlias("xNovelChapterTitle", "min=1,max=1000")
 	AddAlias("xNovelChapterContent", "min=1,max=50000")
+	AddAlias("xNovelParagraphOffset", "number")
+	Add("xNovelParagraphLimit", newNumberRange(1, 200))
+	AddAlias("xNovelChapterRevisionReason", "max=200")
+	AddAlias("xNovelChapterRevisionVersion", "number")
+	Add("xNovelModerationAction", newIsInString([]string{
+		schema.NovelModerationActionBan,
+		schema.NovelModerationActionUnban,
+	}))
+	AddAlias("xNovelModerationReason", "min=1,max=200")
+	Add("xNovelReportCategory", newIsInString([]string{
+		schema.NovelReportCategoryPorn,
+		schema.NovelReportCategoryPolitics,
+		schema.NovelReportCategoryViolence,
+		schema.NovelReportCategoryCopyright,
+		schema.NovelReportCategoryOther,
+	}))
+	AddAlias("xNovelReportContent", "max=500")
+	AddAlias("xNovelReportStatus", "number,min=1")
+
+	// 段落id，由内容hash（12位）以及重复序号组成
+	AddAlias("xParagraphID", "ascii,min=12,max=20")
+	AddAlias("xParagraphCommentContent", "min=1,max=500")
+	Add("xParagraphCommentStatus", newNumberRange(
+		schema.ParagraphCommentStatusNormal,
+		schema.ParagraphCommentStatusHidden,
+	))
+	AddAlias("xParagraphAnnotationNote", "max=500")
+	Add("xParagraphAnnotationVisibility", newIsInString([]string{
+		schema.ParagraphAnnotationVisibilityPrivate,
+		schema.ParagraphAnnotationVisibilityPublic,
+	}))
+
+	Add("xNovelReviewRating", newNumberRange(
+		schema.NovelReviewRatingMin,
+		schema.NovelReviewRatingMax,
+	))
+	AddAlias("xNovelReviewContent", "max=2000")
+	Add("xNovelReviewSort", newIsInString([]string{
+		"helpful",
+		"time",
+	}))
 
 	Add("xNovelIDS", func(fl validator.FieldLevel) bool {
 		value, ok := toString(fl)
@@ -14,21 +14,66 @@
 
 package validate
 
-import "github.com/vicanso/elite/cs"
+import (
+	"github.com/vicanso/elite/cs"
+	"github.com/vicanso/elite/schema"
+)
 
 func init() {
 	// 用户账号
 	AddAlias("xUserAccount", "ascii,min=2,max=10")
 	// 用户密码
 	AddAlias("xUserPassword", "ascii,len=44")
+	// 用户令牌（如重置密码）
+	AddAlias("xUserToken", "hexadecimal,len=64")
+	// 两步验证码或恢复码
+	AddAlias("xUserTwoFactorCode", "alphanum,min=6,max=20")
+	// 访问令牌
+	AddAlias("xUserAuthToken", "printascii,max=1000")
+	// API key名称
+	AddAlias("xAPIKeyName", "min=1,max=30")
+	// API key权限范围
+	Add("xAPIKeyScope", newIsInString([]string{
+		schema.APIKeyScopeNovelRead,
+		schema.APIKeyScopeNovelWrite,
+		schema.APIKeyScopeConfigRead,
+		schema.APIKeyScopeConfigWrite,
+	}))
+	// OpenID Connect的provider
+	AddAlias("xOIDCProvider", "alphanum,min=1,max=30")
+	// OpenID Connect的授权码
+	AddAlias("xOIDCCode", "printascii,min=1,max=2048")
+	// 用户session标识
+	AddAlias("xUserSessionID", "hexadecimal,len=16")
 	// 用户名称
 	AddAlias("xUserName", "min=1,max=20")
 	// 用户邮箱
 	AddAlias("xUserEmail", "email")
+	// 用户个人简介
+	AddAlias("xUserBio", "max=200")
+	// 用户头像文件名
+	AddAlias("xUserAvatar", "min=1,max=50,excludesall=/")
+	// 用户隐私设置
+	Add("xUserPrivacy", newIsInString([]string{
+		schema.UserPrivacyHideProfile,
+		schema.UserPrivacyHideReviews,
+	}))
 	// 用户角色
 	AddAlias("xUserRole", "ascii,min=1,max=10")
 	// 用户分组
 	AddAlias("xUserGroup", "ascii,min=1,max=10")
+	// 权限名称，如novel.update
+	AddAlias("xPermission", "min=3,max=30,contains=.")
+	// 权限、角色与分组的描述
+	AddAlias("xRBACDescription", "min=1,max=50")
+	// 登录防护的统计维度
+	Add("xLoginDefenseCategory", newIsInString([]string{
+		cs.LoginDefenseAccount,
+		cs.LoginDefenseIP,
+		cs.LoginDefenseSubnet,
+	}))
+	// 登录防护的统计对象（账户、IP或网段）
+	AddAlias("xLoginDefenseValue", "min=1,max=50")
 	// 用户行为分类
 	// TODO 是否调整为支持配置的方式
 	Add("xUserActionCategory", newIsInString([]string{
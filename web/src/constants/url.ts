@@ -3,9 +3,17 @@
 export const USERS_ME = "/users/v1/me";
 // 用户详细信息
 export const USERS_ME_DETAIL = "/users/v1/detail";
+// 修改密码
+export const USERS_ME_PASSWORD = "/users/v1/me/password";
 // 用户登录
 export const USERS_LOGIN = "/users/v1/me/login";
 export const USERS_INNER_LOGIN = "/users/inner/v1/me/login";
+// 两步验证登录
+export const USERS_LOGIN_TOTP = "/users/v1/me/login/totp";
+// OpenID Connect登录方式列表
+export const USERS_OIDC_PROVIDERS = "/users/v1/oidc/providers";
+// OpenID Connect登录
+export const USERS_OIDC_LOGIN = "/users/v1/oidc/:provider/login";
 // 用户行为
 export const USERS_ACTIONS = "/users/v1/actions";
 // 用户登录记录
@@ -16,6 +24,10 @@ export const USERS_ROLES = "/users/v1/roles";
 export const USERS = "/users/v1";
 // 根据ID查询用户信息
 export const USERS_ID = "/users/v1/:id";
+// 模拟用户登录
+export const USERS_IMPERSONATION = "/users/v1/:id/impersonation";
+// 结束模拟登录
+export const USERS_ME_IMPERSONATION = "/users/v1/me/impersonation";
 
 // flux相关查询
 // 用户行为日志列表
@@ -0,0 +1,415 @@
+// argon2id（RFC 9106）的实现，用于生成登录挑战的proof，
+// 与服务端golang.org/x/crypto/argon2的IDKey结果一致（version 0x13）
+// 64位的整数以两个32位整数（低位、高位）保存
+
+const blake2bIV = new Uint32Array([
+  0xf3bcc908, 0x6a09e667, 0x84caa73b, 0xbb67ae85, 0xfe94f82b, 0x3c6ef372,
+  0x5f1d36f1, 0xa54ff53a, 0xade682d1, 0x510e527f, 0x2b3e6c1f, 0x9b05688c,
+  0xfb41bd6b, 0x1f83d9ab, 0x137e2179, 0x5be0cd19,
+]);
+
+const blake2bSigma = [
+  [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15],
+  [14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3],
+  [11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4],
+  [7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8],
+  [9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13],
+  [2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9],
+  [12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11],
+  [13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10],
+  [6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5],
+  [10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0],
+];
+
+const twoPow32 = 4294967296;
+
+// add64 v[a] = v[a] + v[b] + (lo, hi)
+function add64(
+  v: Uint32Array,
+  a: number,
+  b: number,
+  lo: number,
+  hi: number
+): void {
+  const sum = v[2 * a] + v[2 * b] + lo;
+  v[2 * a + 1] = v[2 * a + 1] + v[2 * b + 1] + hi + Math.floor(sum / twoPow32);
+  v[2 * a] = sum;
+}
+
+// xorRotr64 v[a] = (v[a] ^ v[b]) >>> n，n为32、24、16或63
+function xorRotr64(v: Uint32Array, a: number, b: number, n: number): void {
+  const lo = v[2 * a] ^ v[2 * b];
+  const hi = v[2 * a + 1] ^ v[2 * b + 1];
+  if (n === 32) {
+    v[2 * a] = hi;
+    v[2 * a + 1] = lo;
+  } else if (n === 63) {
+    v[2 * a] = (lo << 1) | (hi >>> 31);
+    v[2 * a + 1] = (hi << 1) | (lo >>> 31);
+  } else {
+    v[2 * a] = (lo >>> n) | (hi << (32 - n));
+    v[2 * a + 1] = (hi >>> n) | (lo << (32 - n));
+  }
+}
+
+function blake2bG(
+  v: Uint32Array,
+  m: Uint32Array,
+  a: number,
+  b: number,
+  c: number,
+  d: number,
+  x: number,
+  y: number
+): void {
+  add64(v, a, b, m[2 * x], m[2 * x + 1]);
+  xorRotr64(v, d, a, 32);
+  add64(v, c, d, 0, 0);
+  xorRotr64(v, b, c, 24);
+  add64(v, a, b, m[2 * y], m[2 * y + 1]);
+  xorRotr64(v, d, a, 16);
+  add64(v, c, d, 0, 0);
+  xorRotr64(v, b, c, 63);
+}
+
+function blake2bCompress(
+  h: Uint32Array,
+  block: Uint8Array,
+  count: number,
+  last: boolean
+): void {
+  const v = new Uint32Array(32);
+  const m = new Uint32Array(32);
+  v.set(h);
+  v.set(blake2bIV, 16);
+  v[24] ^= count >>> 0;
+  v[25] ^= Math.floor(count / twoPow32);
+  if (last) {
+    v[28] = ~v[28];
+    v[29] = ~v[29];
+  }
+  for (let i = 0; i < 32; i++) {
+    m[i] =
+      block[4 * i] |
+      (block[4 * i + 1] << 8) |
+      (block[4 * i + 2] << 16) |
+      (block[4 * i + 3] << 24);
+  }
+  for (let i = 0; i < 12; i++) {
+    const s = blake2bSigma[i % 10];
+    blake2bG(v, m, 0, 4, 8, 12, s[0], s[1]);
+    blake2bG(v, m, 1, 5, 9, 13, s[2], s[3]);
+    blake2bG(v, m, 2, 6, 10, 14, s[4], s[5]);
+    blake2bG(v, m, 3, 7, 11, 15, s[6], s[7]);
+    blake2bG(v, m, 0, 5, 10, 15, s[8], s[9]);
+    blake2bG(v, m, 1, 6, 11, 12, s[10], s[11]);
+    blake2bG(v, m, 2, 7, 8, 13, s[12], s[13]);
+    blake2bG(v, m, 3, 4, 9, 14, s[14], s[15]);
+  }
+  for (let i = 0; i < 16; i++) {
+    h[i] ^= v[i] ^ v[i + 16];
+  }
+}
+
+// blake2b 生成长度为outlen（1-64）的hash
+function blake2b(input: Uint8Array, outlen: number): Uint8Array {
+  const h = new Uint32Array(blake2bIV);
+  h[0] ^= 0x01010000 ^ outlen;
+  const block = new Uint8Array(128);
+  let offset = 0;
+  while (input.length - offset > 128) {
+    blake2bCompress(h, input.subarray(offset, offset + 128), offset + 128, false);
+    offset += 128;
+  }
+  block.set(input.subarray(offset));
+  blake2bCompress(h, block, input.length, true);
+  const result = new Uint8Array(outlen);
+  for (let i = 0; i < outlen; i++) {
+    result[i] = h[i >>> 2] >>> (8 * (i & 3));
+  }
+  return result;
+}
+
+function le32(value: number): Uint8Array {
+  return new Uint8Array([
+    value & 0xff,
+    (value >>> 8) & 0xff,
+    (value >>> 16) & 0xff,
+    (value >>> 24) & 0xff,
+  ]);
+}
+
+function concatBytes(...arr: Uint8Array[]): Uint8Array {
+  let length = 0;
+  arr.forEach((item) => {
+    length += item.length;
+  });
+  const result = new Uint8Array(length);
+  let offset = 0;
+  arr.forEach((item) => {
+    result.set(item, offset);
+    offset += item.length;
+  });
+  return result;
+}
+
+// blake2bLong 生成任意长度的hash（RFC 9106 H'）
+function blake2bLong(input: Uint8Array, outlen: number): Uint8Array {
+  const data = concatBytes(le32(outlen), input);
+  if (outlen <= 64) {
+    return blake2b(data, outlen);
+  }
+  const result = new Uint8Array(outlen);
+  const r = Math.ceil(outlen / 32) - 2;
+  let v = blake2b(data, 64);
+  result.set(v.subarray(0, 32));
+  for (let i = 1; i < r; i++) {
+    v = blake2b(v, 64);
+    result.set(v.subarray(0, 32), i * 32);
+  }
+  result.set(blake2b(v, outlen - 32 * r), 32 * r);
+  return result;
+}
+
+// fBlaMka v[a] = v[a] + v[b] + 2 * lo(v[a]) * lo(v[b])
+function fBlaMka(v: Uint32Array, a: number, b: number): void {
+  const x = v[2 * a];
+  const y = v[2 * b];
+  const x0 = x & 0xffff;
+  const x1 = x >>> 16;
+  const y0 = y & 0xffff;
+  const y1 = y >>> 16;
+  const low = x0 * y0;
+  const mid = x1 * y0 + x0 * y1 + (low >>> 16);
+  const productHi = x1 * y1 + Math.floor(mid / 65536);
+  const productLo = Math.imul(x, y) >>> 0;
+  // 乘以2
+  const lo = (productLo << 1) >>> 0;
+  const hi = (productHi * 2 + (productLo >>> 31)) >>> 0;
+  add64(v, a, b, lo, hi);
+}
+
+function argon2GB(v: Uint32Array, a: number, b: number, c: number, d: number): void {
+  fBlaMka(v, a, b);
+  xorRotr64(v, d, a, 32);
+  fBlaMka(v, c, d);
+  xorRotr64(v, b, c, 24);
+  fBlaMka(v, a, b);
+  xorRotr64(v, d, a, 16);
+  fBlaMka(v, c, d);
+  xorRotr64(v, b, c, 63);
+}
+
+// argon2P 对16个64位整数（以下标指定）做置换
+function argon2P(v: Uint32Array, w: number[]): void {
+  argon2GB(v, w[0], w[4], w[8], w[12]);
+  argon2GB(v, w[1], w[5], w[9], w[13]);
+  argon2GB(v, w[2], w[6], w[10], w[14]);
+  argon2GB(v, w[3], w[7], w[11], w[15]);
+  argon2GB(v, w[0], w[5], w[10], w[15]);
+  argon2GB(v, w[1], w[6], w[11], w[12]);
+  argon2GB(v, w[2], w[7], w[8], w[13]);
+  argon2GB(v, w[3], w[4], w[9], w[14]);
+}
+
+// 行与列置换时的64位整数下标
+const argon2RowIndexes: number[][] = [];
+const argon2ColumnIndexes: number[][] = [];
+for (let i = 0; i < 8; i++) {
+  const row: number[] = [];
+  const column: number[] = [];
+  for (let j = 0; j < 8; j++) {
+    row.push(16 * i + 2 * j, 16 * i + 2 * j + 1);
+    column.push(16 * j + 2 * i, 16 * j + 2 * i + 1);
+  }
+  argon2RowIndexes.push(row);
+  argon2ColumnIndexes.push(column);
+}
+
+const argon2BlockWords = 256;
+
+// argon2Compress 压缩函数G，xor为true时结果与dst中原有数据异或
+function argon2Compress(
+  memory: Uint32Array,
+  x: number,
+  y: number,
+  dst: number,
+  xor: boolean,
+  r: Uint32Array,
+  q: Uint32Array
+): void {
+  for (let i = 0; i < argon2BlockWords; i++) {
+    r[i] = memory[x + i] ^ memory[y + i];
+  }
+  q.set(r);
+  argon2RowIndexes.forEach((w) => argon2P(q, w));
+  argon2ColumnIndexes.forEach((w) => argon2P(q, w));
+  for (let i = 0; i < argon2BlockWords; i++) {
+    const value = q[i] ^ r[i];
+    memory[dst + i] = xor ? memory[dst + i] ^ value : value;
+  }
+}
+
+function bytesToWords(bytes: Uint8Array, memory: Uint32Array, offset: number): void {
+  for (let i = 0; i < argon2BlockWords; i++) {
+    memory[offset + i] =
+      bytes[4 * i] |
+      (bytes[4 * i + 1] << 8) |
+      (bytes[4 * i + 2] << 16) |
+      (bytes[4 * i + 3] << 24);
+  }
+}
+
+// argon2id 生成长度为keyLen的key，memory单位为KB
+export function argon2id(params: {
+  password: Uint8Array;
+  salt: Uint8Array;
+  time: number;
+  memory: number;
+  threads: number;
+  keyLen: number;
+}): Uint8Array {
+  const { password, salt, time, threads, keyLen } = params;
+  const argon2Version = 0x13;
+  const argon2Type = 2;
+  const syncPoints = 4;
+  let blockCount = params.memory;
+  if (blockCount < 2 * syncPoints * threads) {
+    blockCount = 2 * syncPoints * threads;
+  }
+  blockCount -= blockCount % (syncPoints * threads);
+  const laneLength = blockCount / threads;
+  const segmentLength = laneLength / syncPoints;
+
+  const h0 = blake2b(
+    concatBytes(
+      le32(threads),
+      le32(keyLen),
+      le32(params.memory),
+      le32(time),
+      le32(argon2Version),
+      le32(argon2Type),
+      le32(password.length),
+      password,
+      le32(salt.length),
+      salt,
+      le32(0),
+      le32(0)
+    ),
+    64
+  );
+  const memory = new Uint32Array(blockCount * argon2BlockWords);
+  const blockOffset = (lane: number, index: number) =>
+    (lane * laneLength + index) * argon2BlockWords;
+  for (let lane = 0; lane < threads; lane++) {
+    for (let i = 0; i < 2; i++) {
+      bytesToWords(
+        blake2bLong(concatBytes(h0, le32(i), le32(lane)), 1024),
+        memory,
+        blockOffset(lane, i)
+      );
+    }
+  }
+
+  const r = new Uint32Array(argon2BlockWords);
+  const q = new Uint32Array(argon2BlockWords);
+  // 数据无关寻址使用的数据：[zero, input, address]
+  const addressMemory = new Uint32Array(3 * argon2BlockWords);
+  const zeroBlock = 0;
+  const inputBlock = argon2BlockWords;
+  const addressBlock = 2 * argon2BlockWords;
+
+  for (let pass = 0; pass < time; pass++) {
+    for (let slice = 0; slice < syncPoints; slice++) {
+      for (let lane = 0; lane < threads; lane++) {
+        const dataIndependent = pass === 0 && slice < syncPoints / 2;
+        if (dataIndependent) {
+          addressMemory.fill(0, inputBlock);
+          addressMemory[inputBlock] = pass;
+          addressMemory[inputBlock + 2] = lane;
+          addressMemory[inputBlock + 4] = slice;
+          addressMemory[inputBlock + 6] = blockCount;
+          addressMemory[inputBlock + 8] = time;
+          addressMemory[inputBlock + 10] = argon2Type;
+        }
+        const start = pass === 0 && slice === 0 ? 2 : 0;
+        const nextAddresses = () => {
+          addressMemory[inputBlock + 12]++;
+          argon2Compress(addressMemory, zeroBlock, inputBlock, addressBlock, false, r, q);
+          argon2Compress(addressMemory, zeroBlock, addressBlock, addressBlock, false, r, q);
+        };
+        if (dataIndependent && start !== 0) {
+          nextAddresses();
+        }
+        for (let index = start; index < segmentLength; index++) {
+          const current = slice * segmentLength + index;
+          const prev = current === 0 ? laneLength - 1 : current - 1;
+          let j1 = 0;
+          let j2 = 0;
+          if (dataIndependent) {
+            if (index % 128 === 0) {
+              nextAddresses();
+            }
+            j1 = addressMemory[addressBlock + 2 * (index % 128)];
+            j2 = addressMemory[addressBlock + 2 * (index % 128) + 1];
+          } else {
+            j1 = memory[blockOffset(lane, prev)];
+            j2 = memory[blockOffset(lane, prev) + 1];
+          }
+          let refLane = j2 % threads;
+          if (pass === 0 && slice === 0) {
+            refLane = lane;
+          }
+          let area = 0;
+          if (pass === 0) {
+            area = slice * segmentLength;
+          } else {
+            area = laneLength - segmentLength;
+          }
+          if (refLane === lane) {
+            area += index - 1;
+          } else if (index === 0) {
+            area -= 1;
+          }
+          // x = j1 * j1 >> 32, y = area * x >> 32
+          const j1Lo = j1 & 0xffff;
+          const j1Hi = j1 >>> 16;
+          const low = j1Lo * j1Lo;
+          const mid = 2 * j1Hi * j1Lo + (low >>> 16);
+          const x = j1Hi * j1Hi + Math.floor(mid / 65536);
+          const y = Math.floor((area * x) / twoPow32);
+          let startPosition = 0;
+          if (pass !== 0 && slice !== syncPoints - 1) {
+            startPosition = (slice + 1) * segmentLength;
+          }
+          const refIndex = (startPosition + area - 1 - y) % laneLength;
+          argon2Compress(
+            memory,
+            blockOffset(lane, prev),
+            blockOffset(refLane, refIndex),
+            blockOffset(lane, current),
+            pass !== 0,
+            r,
+            q
+          );
+        }
+      }
+    }
+  }
+
+  const final = new Uint32Array(argon2BlockWords);
+  for (let lane = 0; lane < threads; lane++) {
+    const offset = blockOffset(lane, laneLength - 1);
+    for (let i = 0; i < argon2BlockWords; i++) {
+      final[i] ^= memory[offset + i];
+    }
+  }
+  const finalBytes = new Uint8Array(1024);
+  for (let i = 0; i < argon2BlockWords; i++) {
+    finalBytes[4 * i] = final[i];
+    finalBytes[4 * i + 1] = final[i] >>> 8;
+    finalBytes[4 * i + 2] = final[i] >>> 16;
+    finalBytes[4 * i + 3] = final[i] >>> 24;
+  }
+  return blake2bLong(finalBytes, keyLen);
+}
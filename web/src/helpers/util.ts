@@ -1,5 +1,6 @@
 import dayjs from "dayjs";
 
+import { argon2id } from "./argon2";
 import { sha256 } from "./crypto";
 
 const hash = "JT";
@@ -10,6 +11,58 @@ export function generatePassword(pass: string): string {
   return sha256(hash + sha256(pass + hash));
 }
 
+function base64ToBytes(value: string): Uint8Array {
+  return Uint8Array.from(atob(value), (c) => c.charCodeAt(0));
+}
+
+function bytesToBase64(value: Uint8Array): string {
+  return btoa(String.fromCharCode(...Array.from(value)));
+}
+
+async function hmacSha256(
+  key: BufferSource,
+  data: Uint8Array
+): Promise<ArrayBuffer> {
+  const cryptoKey = await crypto.subtle.importKey(
+    "raw",
+    key,
+    { name: "HMAC", hash: "SHA-256" },
+    false,
+    ["sign"]
+  );
+  return crypto.subtle.sign("HMAC", cryptoKey, data);
+}
+
+// generatePasswordProof 根据登录挑战生成proof（SCRAM，SaltedPassword使用argon2id），
+// 服务端仅保存StoredKey，proof基于一次性的token生成，无法重放
+export async function generatePasswordProof(params: {
+  password: string;
+  salt: string;
+  time: number;
+  memory: number;
+  threads: number;
+  authMessage: string;
+}): Promise<string> {
+  const encoder = new TextEncoder();
+  const saltedPassword = argon2id({
+    password: encoder.encode(generatePassword(params.password)),
+    salt: base64ToBytes(params.salt),
+    time: params.time,
+    memory: params.memory,
+    threads: params.threads,
+    keyLen: 32,
+  });
+  const clientKey = new Uint8Array(
+    await hmacSha256(saltedPassword, encoder.encode("Client Key"))
+  );
+  const storedKey = await crypto.subtle.digest("SHA-256", clientKey);
+  const clientSignature = new Uint8Array(
+    await hmacSha256(storedKey, encoder.encode(params.authMessage))
+  );
+  const proof = clientKey.map((value, index) => value ^ clientSignature[index]);
+  return bytesToBase64(proof);
+}
+
 // formatDate 格式化日期
 export function formatDate(str: string): string {
   if (!str) {
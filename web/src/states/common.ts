@@ -75,9 +75,15 @@ interface ReadonlyCommonState {
   httpInstances: DeepReadonly<HTTPInstances>;
 }
 
-// commonGetCaptcha 获取图形验证码
-export async function commonGetCaptcha(): Promise<Captcha> {
-  const { data } = await request.get(COMMONS_CAPTCHA);
+// commonGetCaptcha 获取图形验证码，strong为true时获取更长的验证码（登录失败较多时使用）
+export async function commonGetCaptcha(strong = false): Promise<Captcha> {
+  const params: Record<string, string> = {};
+  if (strong) {
+    params.level = "strong";
+  }
+  const { data } = await request.get(COMMONS_CAPTCHA, {
+    params,
+  });
   return <Captcha>data;
 }
 
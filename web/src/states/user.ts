@@ -1,19 +1,31 @@
 import { reactive, readonly, DeepReadonly } from "vue";
 
 import request from "../helpers/request";
-import { sha256 } from "../helpers/crypto";
 import {
   USERS_ME,
   USERS_LOGIN,
   USERS_INNER_LOGIN,
+  USERS_LOGIN_TOTP,
+  USERS_OIDC_PROVIDERS,
+  USERS_OIDC_LOGIN,
   USERS_LOGINS,
   USERS_ROLES,
   USERS,
   USERS_ID,
   USERS_ME_DETAIL,
+  USERS_ME_PASSWORD,
+  USERS_IMPERSONATION,
+  USERS_ME_IMPERSONATION,
 } from "../constants/url";
-import { generatePassword } from "../helpers/util";
+import { generatePassword, generatePasswordProof } from "../helpers/util";
+import { isDevelopment } from "../constants/env";
 
+// 模拟登录的管理员信息
+interface Impersonator {
+  account: string;
+  startedAt: string;
+  expiredAt: string;
+}
 // 用户信息
 interface UserInfo {
   processing: boolean;
@@ -21,6 +33,8 @@ interface UserInfo {
   account: string;
   groups: string[];
   roles: string[];
+  passwordResetRequired?: boolean;
+  impersonator?: Impersonator;
 }
 const info: UserInfo = reactive({
   processing: false,
@@ -28,6 +42,8 @@ const info: UserInfo = reactive({
   account: "",
   groups: [],
   roles: [],
+  passwordResetRequired: false,
+  impersonator: undefined,
 });
 
 interface UserRole {
@@ -77,6 +93,8 @@ interface UserLoginRecord {
   province?: string;
   city?: string;
   isp?: string;
+  riskScore?: number;
+  riskReasons?: string[];
   updatedAt?: string;
   createdAt?: string;
 }
@@ -106,6 +124,8 @@ function fillUserInfo(data: UserInfo) {
   info.date = data.date;
   info.roles = data.roles || [];
   info.groups = data.groups || [];
+  info.passwordResetRequired = data.passwordResetRequired || false;
+  info.impersonator = data.impersonator;
 }
 
 // userFetchInfo 拉取用户信息
@@ -129,24 +149,36 @@ export async function userFetchDetail(): Promise<UserAccount> {
   return <UserAccount>data;
 }
 
-// userLogin 用户登录
+// userLogin 用户登录，若账户已启用两步验证则返回true，需再提交验证码
 export async function userLogin(params: {
   account: string;
   password: string;
   captcha: string;
-}): Promise<void> {
+}): Promise<boolean> {
   if (info.processing) {
-    return;
+    return false;
   }
   try {
     info.processing = true;
-    const resp = await request.get(USERS_LOGIN);
-    const { token } = resp.data;
+    // 获取一次性的登录令牌以及生成proof的salt
+    const { data: challenge } = await request.get(USERS_LOGIN, {
+      params: {
+        account: params.account,
+      },
+    });
+    const password = await generatePasswordProof({
+      password: params.password,
+      salt: challenge.salt,
+      time: challenge.time,
+      memory: challenge.memory,
+      threads: challenge.threads,
+      authMessage: `${params.account},${challenge.token}`,
+    });
     const { data } = await request.post(
       USERS_INNER_LOGIN,
       {
         account: params.account,
-        password: sha256(generatePassword(params.password) + token),
+        password,
       },
       {
         headers: {
@@ -154,12 +186,57 @@ export async function userLogin(params: {
         },
       }
     );
+    if (data.twoFactorPending) {
+      return true;
+    }
+    // 风险较高的登录需通过邮件中的链接确认
+    if (data.loginConfirmPending) {
+      throw new Error("本次登录存在风险，已发送确认邮件，请通过邮件中的链接完成登录");
+    }
     fillUserInfo(<UserInfo>data);
+    return false;
   } finally {
     info.processing = false;
   }
 }
 
+// userLoginTwoFactor 提交两步验证码（或恢复码）完成登录
+export async function userLoginTwoFactor(code: string): Promise<void> {
+  if (info.processing) {
+    return;
+  }
+  try {
+    info.processing = true;
+    const { data } = await request.post(USERS_LOGIN_TOTP, {
+      code,
+    });
+    fillUserInfo(<UserInfo>data);
+  } finally {
+    info.processing = false;
+  }
+}
+
+// OpenID Connect登录方式
+interface OIDCProvider {
+  name: string;
+  displayName: string;
+}
+
+// userListOIDCProvider 获取OpenID Connect登录方式列表
+export async function userListOIDCProvider(): Promise<OIDCProvider[]> {
+  const { data } = await request.get(USERS_OIDC_PROVIDERS);
+  return <OIDCProvider[]>(data.providers || []);
+}
+
+// userGetOIDCLoginURL 获取OpenID Connect登录地址，由浏览器跳转
+export function userGetOIDCLoginURL(provider: string): string {
+  const url = USERS_OIDC_LOGIN.replace(":provider", provider);
+  if (isDevelopment()) {
+    return `/api${url}`;
+  }
+  return url;
+}
+
 // userRegister 用户注册
 export async function userRegister(params: {
   account: string;
@@ -212,10 +289,39 @@ export async function userLogout(): Promise<void> {
   }
 }
 
+// userImpersonate 模拟用户登录
+export async function userImpersonate(id: number): Promise<void> {
+  if (info.processing) {
+    return;
+  }
+  try {
+    info.processing = true;
+    const { data } = await request.post(
+      USERS_IMPERSONATION.replace(":id", `${id}`)
+    );
+    fillUserInfo(<UserInfo>data);
+  } finally {
+    info.processing = false;
+  }
+}
+
+// userStopImpersonation 结束模拟登录
+export async function userStopImpersonation(): Promise<void> {
+  if (info.processing) {
+    return;
+  }
+  try {
+    info.processing = true;
+    const { data } = await request.delete(USERS_ME_IMPERSONATION);
+    fillUserInfo(<UserInfo>data);
+  } finally {
+    info.processing = false;
+  }
+}
+
 // userUpdate 更新用户信息
 export async function userUpdate(params: {
-  password?: string;
-  newPassword?: string;
+  email?: string;
   roles?: string[];
 }): Promise<void> {
   if (info.processing) {
@@ -223,14 +329,26 @@ export async function userUpdate(params: {
   }
   try {
     info.processing = true;
-    const data = Object.assign({}, params);
-    if (data.password) {
-      data.password = generatePassword(data.password);
-    }
-    if (data.newPassword) {
-      data.newPassword = generatePassword(data.newPassword);
-    }
-    await request.patch(USERS_ME, data);
+    await request.patch(USERS_ME, params);
+  } finally {
+    info.processing = false;
+  }
+}
+
+// userChangePassword 修改密码，成功后所有的登录均失效
+export async function userChangePassword(params: {
+  password: string;
+  newPassword: string;
+}): Promise<void> {
+  if (info.processing) {
+    return;
+  }
+  try {
+    info.processing = true;
+    await request.patch(USERS_ME_PASSWORD, {
+      password: generatePassword(params.password),
+      newPassword: generatePassword(params.newPassword),
+    });
   } finally {
     info.processing = false;
   }